@@ -0,0 +1,146 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command backtest sweeps regression parameters over the history of a source
+// on a TSViewDB server (see rangecontent.Backtest) and prints the best scores
+// and recommended parameters of each metric.  For example:
+//
+//	backtest -src=mydir/mysrc -known=1372636800000,1375315200000 -tolerance=1d \
+//	    -query=daysOfData=180
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/google/tsviewdb/src/backtest"
+	"github.com/google/tsviewdb/src/common"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+)
+
+var server = flag.String("server", "http://localhost:8080", "TSViewDB server.")
+var src = flag.String("src", "", "Source, with optional metrics, as in range reads.")
+var known = flag.String("known", "", "Comma separated times in milliseconds of known regressions.")
+var nonEvents = flag.String("nonEvents", "", "Comma separated times in milliseconds without a regression.")
+var tolerance = flag.String("tolerance", "", "Distance from a known time at which a regression still matches, e.g. 1h.")
+var labelsComplete = flag.Bool("labelsComplete", false, "Count regressions at no known time as false positives.")
+var thresholds = flag.String("thresholds", "", "Comma separated thresholds to sweep.")
+var windows = flag.String("windows", "", "Comma separated regression windows to sweep.")
+var radii = flag.String("radii", "", "Comma separated regression radii to sweep.")
+var usePercent = flag.String("usePercent", "", "Comma separated 0 (absolute) or 1 (percent) thresholds to sweep.")
+var query = flag.String("query", "", "Other range read and regression parameters, e.g. daysOfData=90&regressIgnoreLT=1.")
+var top = flag.Int("top", 5, "Scores to print per metric.")
+var printJSON = flag.Bool("json", false, "Print the server's JSON results.")
+
+// backtestResults is the part of rangecontent.BacktestResults printed.
+type backtestResults struct {
+	Settings int
+	Metrics  []backtest.Metric
+}
+
+func fatal(v ...interface{}) {
+	fmt.Fprintln(os.Stderr, v...)
+	os.Exit(1)
+}
+
+func backtestQuery() url.Values {
+	q, err := url.ParseQuery(*query)
+	if err != nil {
+		fatal("Bad query:", err)
+	}
+	for name, value := range map[string]string{
+		"src":             *src,
+		"known":           *known,
+		"nonEvents":       *nonEvents,
+		"tolerance":       *tolerance,
+		"sweepThreshold":  *thresholds,
+		"sweepWindow":     *windows,
+		"sweepRadius":     *radii,
+		"sweepUsePercent": *usePercent,
+	} {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+	if *labelsComplete {
+		q.Set("labelsComplete", "1")
+	}
+	q.Set("maxScores", fmt.Sprint(*top))
+	return q
+}
+
+// optional formats a swept parameter which only some detectors have.
+func optional(v *int) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprint(*v)
+}
+
+func printResults(results backtestResults) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "%d settings swept.\n", results.Settings)
+	for _, m := range results.Metrics {
+		recommended := "none (no known regression found)"
+		if m.Recommended != nil {
+			b, _ := json.Marshal(m.Recommended) // As in regression defaults.
+			recommended = string(b)
+		}
+		fmt.Fprintf(w, "\n%s\trecommended: %s\n", m.Column, recommended)
+		fmt.Fprintln(w, "threshold\twindow\tradius\tpercent\tfound\tmissed\tfalse\tunlabeled\tprecision\trecall\tf1")
+		for _, s := range m.Scores {
+			o := s.Setting
+			fmt.Fprintf(w, "%g\t%s\t%s\t%t\t%d\t%d\t%d\t%d\t%.2f\t%.2f\t%.2f\n",
+				*o.Pos, optional(o.Window), optional(o.Radius), *o.UsePercent,
+				s.Found, s.Missed, s.FalsePositives, s.Unlabeled, s.Precision, s.Recall, s.F1)
+		}
+	}
+	w.Flush()
+}
+
+func main() {
+	flag.Parse()
+	if (*src == "") || (*known == "") {
+		fatal("Both -src and -known must be set.")
+	}
+
+	resp, err := http.Get(*server + common.BacktestPath + "?" + backtestQuery().Encode())
+	if err != nil {
+		fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		fatal(resp.Status + ": " + string(body))
+	}
+	if *printJSON {
+		os.Stdout.Write(body)
+		return
+	}
+
+	var results backtestResults
+	if err := json.Unmarshal(body, &results); err != nil {
+		fatal(err)
+	}
+	printResults(results)
+}
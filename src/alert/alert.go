@@ -0,0 +1,248 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package alert evaluates saved alert rules (see db.AlertRule) on a schedule
+// and notifies their recipients of regressions not already notified.
+package alert
+
+import (
+	"errors"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/db/requests"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alert is a regression found by a rule.
+type Alert struct {
+	Rule string `json:"rule"`
+	db.RegressionSegment
+	Link string `json:"link"` // Graph of the rule's read.
+}
+
+// Notifier delivers the new alerts of a rule to each of the rule's recipients
+// it handles, its destinations.  Deliveries are recorded by destination, so a
+// failed one is retried without repeating the others.
+type Notifier interface {
+	Destinations(rule db.AlertRule) []string
+	Notify(rule db.AlertRule, destination string, alerts []Alert) error
+}
+
+// Store keeps the rules and the alerts already fired.  db.DB is a Store.
+type Store interface {
+	ReadAlertRules() (rules []db.AlertRule, err error)
+	ReadFiredAlerts(rule string) (fired map[string]int64, err error)
+	WriteFiredAlert(rule, key string, timestamp int64) (err error)
+}
+
+// Finder returns the regressions found by a range read with regressFormat=segments.
+type Finder func(rawQuery string) ([]db.RegressionSegment, error)
+
+// validName matches rule names, which appear in paths and email headers.
+var validName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Validate returns an error if rule cannot be evaluated or has a recipient
+// which is not a plain email address or http(s) URL.
+func Validate(rule db.AlertRule) error {
+	if !validName.MatchString(rule.Name) {
+		return errors.New("Bad alert rule name, use letters, digits, '.', '_' and '-': " + rule.Name)
+	}
+	if rule.Src == "" {
+		return errors.New("No alert rule src.")
+	}
+	for _, email := range rule.Emails {
+		if addr, err := mail.ParseAddress(email); (err != nil) || (addr.Address != email) {
+			return errors.New("Bad alert rule email: " + email)
+		}
+	}
+	for _, hook := range rule.Webhooks {
+		u, err := url.Parse(hook)
+		if (err != nil) || ((u.Scheme != "http") && (u.Scheme != "https")) || (u.Host == "") ||
+			strings.ContainsAny(hook, " \t\r\n") {
+			return errors.New("Bad alert rule webhook: " + hook)
+		}
+	}
+	if _, err := requests.ParseMillis(rule.Every); err != nil {
+		return errors.New("Bad alert rule every: " + err.Error())
+	}
+	q, err := url.ParseQuery(rule.Query)
+	if err != nil {
+		return errors.New("Bad alert rule query: " + err.Error())
+	}
+	r, err := requests.MakeRegressionParams(q.Encode())
+	if err != nil {
+		return err
+	}
+	if !r.Selected {
+		return errors.New("No regression parameters in alert rule query.")
+	}
+	return nil
+}
+
+// readQuery returns the range read of rule.
+func readQuery(rule db.AlertRule) url.Values {
+	q, _ := url.ParseQuery(rule.Query)
+	q.Set("src", rule.Src)
+	return q
+}
+
+// alertKey identifies a regression across evaluations by its column and the
+// record before it, whose end may move as more records are read.
+func alertKey(seg db.RegressionSegment) string {
+	if seg.Start.Id != "" {
+		return seg.Column + "@" + seg.Start.Id
+	}
+	return seg.Column + "@" + strconv.FormatInt(seg.Start.Timestamp, 10)
+}
+
+// Scheduler evaluates the rules of Store when due.
+type Scheduler struct {
+	Store     Store
+	Find      Finder
+	Notifiers []Notifier
+	LinkBase  string // Prepended to alert links, e.g. "http://tsviewdb:8080".
+
+	lastRun map[string]time.Time // By rule name.
+}
+
+// Evaluate notifies the regressions found by rule which have not been notified
+// before, and returns them.  An alert is recorded as delivered to each
+// destination which accepts it, and as notified once delivered to all, so
+// failed deliveries are retried alone.
+func (s *Scheduler) Evaluate(rule db.AlertRule, now time.Time) ([]Alert, error) {
+	q := readQuery(rule)
+	link := s.LinkBase + common.VizPath + "?" + q.Encode()
+	q.Set("regressFormat", "segments")
+	segs, err := s.Find(q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	fired, err := s.Store.ReadFiredAlerts(rule.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var alerts []Alert
+	var keys []string
+	for _, seg := range segs {
+		key := alertKey(seg)
+		if _, ok := fired[key]; ok {
+			continue
+		}
+		fired[key] = 0 // Segments may repeat a key.
+		alerts = append(alerts, Alert{Rule: rule.Name, RegressionSegment: seg, Link: link})
+		keys = append(keys, key)
+	}
+	if len(alerts) == 0 {
+		return nil, nil
+	}
+
+	timestamp := now.UnixNano() / 1e6 // Millis.
+	var notifyErr error
+	for _, n := range s.Notifiers {
+		for _, dest := range n.Destinations(rule) {
+			var pending []Alert
+			var pendingKeys []string
+			for i, key := range keys {
+				if _, ok := fired[deliveryKey(dest, key)]; !ok {
+					pending = append(pending, alerts[i])
+					pendingKeys = append(pendingKeys, deliveryKey(dest, key))
+				}
+			}
+			if len(pending) == 0 {
+				continue
+			}
+			if err := n.Notify(rule, dest, pending); err != nil {
+				if notifyErr == nil {
+					notifyErr = err
+				}
+				continue
+			}
+			for _, key := range pendingKeys {
+				if err := s.Store.WriteFiredAlert(rule.Name, key, timestamp); err != nil {
+					return alerts, err
+				}
+			}
+		}
+	}
+	if notifyErr != nil {
+		return alerts, notifyErr
+	}
+	for _, key := range keys {
+		if err := s.Store.WriteFiredAlert(rule.Name, key, timestamp); err != nil {
+			return alerts, err
+		}
+	}
+	return alerts, nil
+}
+
+// deliveryKey records the delivery of the alert with key to destination.
+func deliveryKey(destination, key string) string {
+	return destination + "|" + key
+}
+
+// RunDue evaluates each rule not evaluated within its interval before now.  An
+// error in one rule does not stop the others.
+func (s *Scheduler) RunDue(now time.Time) {
+	if s.lastRun == nil {
+		s.lastRun = make(map[string]time.Time)
+	}
+	rules, err := s.Store.ReadAlertRules()
+	if err != nil {
+		glog.Errorln("Reading alert rules:", err)
+		return
+	}
+	for _, rule := range rules {
+		every, err := requests.ParseMillis(rule.Every)
+		if err != nil {
+			glog.Errorf("Alert rule %s: %v", rule.Name, err)
+			continue
+		}
+		if last, ok := s.lastRun[rule.Name]; ok && now.Sub(last) < time.Duration(every)*time.Millisecond {
+			continue
+		}
+		s.lastRun[rule.Name] = now
+
+		t := time.Now()
+		alerts, err := s.Evaluate(rule, now)
+		if err != nil {
+			glog.Errorf("Alert rule %s: %v", rule.Name, err)
+		}
+		glog.V(2).Infof("PERF: alert rule %s evaluation time: %v, %d new alerts\n",
+			rule.Name, time.Now().Sub(t), len(alerts))
+	}
+}
+
+// Run calls RunDue every tick until stop is closed.
+func (s *Scheduler) Run(tick time.Duration, stop <-chan bool) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	s.RunDue(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			s.RunDue(now)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,337 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alert
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/google/tsviewdb/src/db"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memStore struct {
+	rules []db.AlertRule
+	fired map[string]map[string]int64
+}
+
+func (m *memStore) ReadAlertRules() ([]db.AlertRule, error) {
+	return m.rules, nil
+}
+
+func (m *memStore) ReadFiredAlerts(rule string) (map[string]int64, error) {
+	fired := make(map[string]int64)
+	for k, v := range m.fired[rule] {
+		fired[k] = v
+	}
+	return fired, nil
+}
+
+func (m *memStore) WriteFiredAlert(rule, key string, timestamp int64) error {
+	if m.fired == nil {
+		m.fired = make(map[string]map[string]int64)
+	}
+	if m.fired[rule] == nil {
+		m.fired[rule] = make(map[string]int64)
+	}
+	m.fired[rule][key] = timestamp
+	return nil
+}
+
+// recordingNotifier records the alerts notified to each of its destinations,
+// failing for those in errs.
+type recordingNotifier struct {
+	dests    []string
+	notified map[string][][]Alert
+	errs     map[string]error
+}
+
+func (n *recordingNotifier) Destinations(rule db.AlertRule) []string {
+	return n.dests
+}
+
+func (n *recordingNotifier) Notify(rule db.AlertRule, dest string, alerts []Alert) error {
+	if n.notified == nil {
+		n.notified = make(map[string][][]Alert)
+	}
+	n.notified[dest] = append(n.notified[dest], alerts)
+	return n.errs[dest]
+}
+
+func segment(column, startId string) db.RegressionSegment {
+	return db.RegressionSegment{
+		Column:    column,
+		Start:     db.RegressionPoint{Timestamp: 1000, Id: startId},
+		End:       db.RegressionPoint{Timestamp: 2000},
+		Direction: "up",
+		Before:    10,
+		After:     20}
+}
+
+var testRule = db.AlertRule{
+	Name:  "lat",
+	Src:   "a/b:lat.mean",
+	Query: "regressPos=5&daysOfData=7",
+	Every: "1h"}
+
+func TestEvaluateDeduplicates(t *testing.T) {
+	segs := []db.RegressionSegment{segment("lat.mean", "x")}
+	var queries []string
+	n := &recordingNotifier{dests: []string{"hook"}}
+	s := &Scheduler{
+		Store: &memStore{},
+		Find: func(rawQuery string) ([]db.RegressionSegment, error) {
+			queries = append(queries, rawQuery)
+			return segs, nil
+		},
+		Notifiers: []Notifier{n}}
+
+	alerts, err := s.Evaluate(testRule, time.Unix(100, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(alerts) != 1) || (alerts[0].Column != "lat.mean") || (alerts[0].Rule != "lat") {
+		t.Errorf("got %+v, want one alert for lat.mean", alerts)
+	}
+	q, _ := url.ParseQuery(queries[0])
+	if (q.Get("src") != testRule.Src) || (q.Get("regressFormat") != "segments") || (q.Get("regressPos") != "5") {
+		t.Errorf("Unexpected query: %s", queries[0])
+	}
+
+	// The same regression, now longer, is not notified again.
+	segs[0].End.Timestamp = 3000
+	segs = append(segs, segment("lat.mean", "y"))
+	alerts, err = s.Evaluate(testRule, time.Unix(200, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(alerts) != 1) || (alerts[0].Start.Id != "y") {
+		t.Errorf("got %+v, want only the alert starting at y", alerts)
+	}
+	if len(n.notified["hook"]) != 2 {
+		t.Errorf("got %d notifications, want 2", len(n.notified["hook"]))
+	}
+
+	if alerts, _ = s.Evaluate(testRule, time.Unix(300, 0)); alerts != nil {
+		t.Errorf("got %+v, want no new alerts", alerts)
+	}
+	if len(n.notified["hook"]) != 2 {
+		t.Errorf("got %d notifications, want 2", len(n.notified["hook"]))
+	}
+}
+
+func TestEvaluateRetriesFailedNotification(t *testing.T) {
+	n := &recordingNotifier{
+		dests: []string{"good", "bad"},
+		errs:  map[string]error{"bad": errors.New("down")}}
+	s := &Scheduler{
+		Store: &memStore{},
+		Find: func(string) ([]db.RegressionSegment, error) {
+			return []db.RegressionSegment{segment("lat.mean", "x")}, nil
+		},
+		Notifiers: []Notifier{n}}
+
+	if _, err := s.Evaluate(testRule, time.Unix(100, 0)); err == nil {
+		t.Error("Expected notification error.")
+	}
+	n.errs = nil
+	alerts, err := s.Evaluate(testRule, time.Unix(200, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 {
+		t.Errorf("got %+v, want the alert again", alerts)
+	}
+	if alerts, _ = s.Evaluate(testRule, time.Unix(300, 0)); alerts != nil {
+		t.Errorf("got %+v, want no new alerts", alerts)
+	}
+	// Only the failed delivery was repeated.
+	if (len(n.notified["good"]) != 1) || (len(n.notified["bad"]) != 2) {
+		t.Errorf("got notifications %+v, want 1 good and 2 bad", n.notified)
+	}
+}
+
+func TestRunDue(t *testing.T) {
+	var evaluations int
+	s := &Scheduler{
+		Store: &memStore{rules: []db.AlertRule{testRule}},
+		Find: func(string) ([]db.RegressionSegment, error) {
+			evaluations++
+			return nil, nil
+		}}
+
+	start := time.Unix(0, 0)
+	for _, after := range []time.Duration{0, time.Minute, 59 * time.Minute, time.Hour, 90 * time.Minute} {
+		s.RunDue(start.Add(after))
+	}
+	if evaluations != 2 { // At 0 and 1h.
+		t.Errorf("got %d evaluations, want 2", evaluations)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(testRule); err != nil {
+		t.Error(err)
+	}
+	good := testRule
+	good.Emails = []string{"dev@example.com"}
+	good.Webhooks = []string{"https://example.com/hook?x=1"}
+	if err := Validate(good); err != nil {
+		t.Error(err)
+	}
+	bad := []db.AlertRule{
+		{Name: "", Src: "a/b", Query: "regressPos=5", Every: "1h"},
+		{Name: "a/b", Src: "a/b", Query: "regressPos=5", Every: "1h"},
+		{Name: "n\r\nBcc: x@example.com", Src: "a/b", Query: "regressPos=5", Every: "1h"},
+		{Name: "n", Src: "a/b", Query: "regressPos=5", Every: "1h", Emails: []string{"Dev <dev@example.com>"}},
+		{Name: "n", Src: "a/b", Query: "regressPos=5", Every: "1h", Emails: []string{"dev@example.com\r\nBcc: x@example.com"}},
+		{Name: "n", Src: "a/b", Query: "regressPos=5", Every: "1h", Webhooks: []string{"ftp://example.com"}},
+		{Name: "n", Src: "a/b", Query: "regressPos=5", Every: "1h", Webhooks: []string{"http://example.com/a b"}},
+		{Name: "n", Src: "", Query: "regressPos=5", Every: "1h"},
+		{Name: "n", Src: "a/b", Query: "regressPos=5", Every: "often"},
+		{Name: "n", Src: "a/b", Query: "daysOfData=7", Every: "1h"},
+	}
+	for _, rule := range bad {
+		if err := Validate(rule); err == nil {
+			t.Errorf("Expected error for %+v", rule)
+		}
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got []Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Error(err)
+		}
+		got = append(got, n)
+		if r.URL.Path == "/fail" {
+			http.Error(w, "fail", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	rule := testRule
+	rule.Webhooks = []string{server.URL + "/hook"}
+	alerts := []Alert{{Rule: "lat", RegressionSegment: segment("lat.mean", "x"), Link: "/v?src=a"}}
+	n := &WebhookNotifier{}
+	if !reflect.DeepEqual(n.Destinations(rule), rule.Webhooks) {
+		t.Errorf("got destinations %v, want %v", n.Destinations(rule), rule.Webhooks)
+	}
+	if err := n.Notify(rule, server.URL+"/hook", alerts); err != nil {
+		t.Fatal(err)
+	}
+	want := []Notification{{Rule: "lat", Alerts: alerts}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if err := n.Notify(rule, server.URL+"/fail", alerts); err == nil {
+		t.Error("Expected error for failed webhook.")
+	}
+	if webhookClient.Timeout == 0 {
+		t.Error("Webhooks need a timeout, as one blocks every rule.")
+	}
+}
+
+// smtpServer accepts one message on a local port and sends its recipients and
+// data to the returned channel.
+func smtpServer(t *testing.T) (addr string, received <-chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan []string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		var lines []string
+		reply("220 localhost")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					data = strings.TrimRight(data, "\r\n")
+					if data == "." {
+						break
+					}
+					lines = append(lines, data)
+				}
+				reply("250 ok")
+			case "QUIT":
+				reply("221 bye")
+				ch <- lines
+				return
+			default: // MAIL and RCPT.
+				lines = append(lines, line)
+				reply("250 ok")
+			}
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, received := smtpServer(t)
+	rule := testRule
+	rule.Emails = []string{"dev@example.com"}
+	alerts := []Alert{{Rule: "lat", RegressionSegment: segment("lat.mean", "x"), Link: "/v?src=a"}}
+	n := &SMTPNotifier{Addr: addr, From: "tsviewdb@example.com"}
+	if err := n.Notify(rule, "dev@example.com", alerts); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := <-received
+	text := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<tsviewdb@example.com>",
+		"RCPT TO:<dev@example.com>",
+		"Subject: [tsviewdb] 1 new regressions for lat",
+		"lat.mean up 10 -> 20 after",
+		"/v?src=a",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Message missing %q:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"time"
+)
+
+// Notification is the JSON body posted by WebhookNotifier.
+type Notification struct {
+	Rule   string  `json:"rule"`
+	Alerts []Alert `json:"alerts"`
+}
+
+// webhookClient is used by WebhookNotifier without a Client.  Rules are
+// evaluated one at a time, so a hanging webhook must not block the others.
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// WebhookNotifier posts a Notification to each of a rule's webhooks.
+type WebhookNotifier struct {
+	Client *http.Client // webhookClient, with a 30s timeout, if nil.
+}
+
+func (n *WebhookNotifier) Destinations(rule db.AlertRule) []string {
+	return rule.Webhooks
+}
+
+func (n *WebhookNotifier) Notify(rule db.AlertRule, hook string, alerts []Alert) error {
+	body, err := json.Marshal(Notification{Rule: rule.Name, Alerts: alerts})
+	if err != nil {
+		return err
+	}
+	client := n.Client
+	if client == nil {
+		client = webhookClient
+	}
+	resp, err := client.Post(hook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body) // Allow connection reuse.
+	resp.Body.Close()
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+		return fmt.Errorf("Webhook %s returned status: %s", hook, resp.Status)
+	}
+	return nil
+}
+
+// SMTPNotifier mails a plain text summary to each of a rule's emails through
+// the server at Addr, "host:port".
+type SMTPNotifier struct {
+	Addr string
+	From string
+	Auth smtp.Auth // Optional.
+}
+
+func (n *SMTPNotifier) Destinations(rule db.AlertRule) []string {
+	return rule.Emails
+}
+
+func (n *SMTPNotifier) Notify(rule db.AlertRule, email string, alerts []Alert) error {
+	return smtp.SendMail(n.Addr, n.Auth, n.From, []string{email}, message(n.From, email, rule, alerts))
+}
+
+// message formats alerts as an email with a line per alert.
+func message(from, to string, rule db.AlertRule, alerts []Alert) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: [tsviewdb] %d new regressions for %s\r\n", len(alerts), rule.Name)
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	for _, a := range alerts {
+		change := fmt.Sprintf("%g -> %g", a.Before, a.After)
+		if a.Percent != nil {
+			change += fmt.Sprintf(" (%+.1f%%)", *a.Percent)
+		}
+		fmt.Fprintf(&b, "%s %s %s after %s\r\n", a.Column, a.Direction, change,
+			common.FormatMillis(a.Start.Timestamp, true))
+	}
+	if len(alerts) > 0 {
+		fmt.Fprintf(&b, "\r\n%s\r\n", alerts[0].Link)
+	}
+	return b.Bytes()
+}
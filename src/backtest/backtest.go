@@ -0,0 +1,237 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backtest scores regression parameters by the regressions they find
+// in the history of a metric, against regressions known to have happened and
+// times known to be free of them.
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/regress"
+	"sort"
+)
+
+// Labels are the known history of a metric, in milliseconds.
+type Labels struct {
+	Regressions []int64 `json:"regressions"`         // Times of known regressions.
+	NonEvents   []int64 `json:"nonEvents,omitempty"` // Times without a regression.
+	Tolerance   int64   `json:"tolerance"`           // Distance at which a regression still matches a time.
+	Complete    bool    `json:"complete"`            // Regressions matching no label are false positives.
+}
+
+// Grid lists the values swept of each parameter.  Every combination is scored.
+// Window and Radius are left unset without values, as for detectors other than
+// regress.AlgoWindow.
+type Grid struct {
+	Thresholds []float64 // Each sets Pos and, negated, Neg.
+	Windows    []int
+	Radii      []int
+	UsePercent []bool
+}
+
+// MaxSettings bounds the combinations of a Grid, each of which is scored over
+// every column read.
+const MaxSettings = 300
+
+// DefaultGrid holds the values swept of parameters without values.
+var DefaultGrid = Grid{
+	Thresholds: []float64{1, 2, 5, 10, 20, 50},
+	Windows:    []int{1, 2, 4, 8},
+	Radii:      []int{0, 1, 2},
+	UsePercent: []bool{true}}
+
+// Size returns the number of combinations of g.
+func (g Grid) Size() int {
+	return len(g.Thresholds) * len(optionalInts(g.Windows)) * len(optionalInts(g.Radii)) * len(g.UsePercent)
+}
+
+// Validate returns an error if g has a value out of range or too many
+// combinations.
+func (g Grid) Validate() error {
+	if g.Size() > MaxSettings {
+		return fmt.Errorf("Backtest grid has %d settings, more than %d.", g.Size(), MaxSettings)
+	}
+	for _, t := range g.Thresholds {
+		if t <= 0 {
+			return errors.New("Backtest thresholds must be > 0.")
+		}
+	}
+	for _, o := range g.Settings() {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Settings returns every combination of the values of g.
+func (g Grid) Settings() (settings []regress.Override) {
+	for _, t := range g.Thresholds {
+		for _, window := range optionalInts(g.Windows) {
+			for _, radius := range optionalInts(g.Radii) {
+				for _, p := range g.UsePercent {
+					pos, neg, usePercent := t, -t, p
+					settings = append(settings, regress.Override{
+						Pos:        &pos,
+						Neg:        &neg,
+						UsePercent: &usePercent,
+						Window:     window,
+						Radius:     radius})
+				}
+			}
+		}
+	}
+	return settings
+}
+
+// optionalInts returns pointers to copies of values, or a single nil for none.
+func optionalInts(values []int) []*int {
+	if len(values) == 0 {
+		return []*int{nil}
+	}
+	ptrs := make([]*int, len(values))
+	for i := range values {
+		v := values[i]
+		ptrs[i] = &v
+	}
+	return ptrs
+}
+
+// Score is how well a setting finds labeled regressions.
+type Score struct {
+	Setting        regress.Override `json:"setting"`
+	Found          int              `json:"found"`          // Labeled regressions found.
+	Missed         int              `json:"missed"`         // Labeled regressions not found.
+	Matched        int              `json:"matched"`        // Regressions found at a labeled regression.
+	FalsePositives int              `json:"falsePositives"` // Regressions found at a non-event, or unlabeled if Complete.
+	Unlabeled      int              `json:"unlabeled"`      // Regressions found at no label.
+	Precision      float64          `json:"precision"`      // Of matched regressions over those matched or false.
+	Recall         float64          `json:"recall"`         // Of labeled regressions found.
+	F1             float64          `json:"f1"`
+}
+
+// Evaluate scores the regressions found by r in c, whose rows have times x in
+// ascending order.  A regression matches each label within its rows' times
+// widened by the tolerance of labels.
+func Evaluate(x, c *column.Floats, r regress.RegressionParams, labels Labels) (s Score) {
+	found := make([]bool, len(labels.Regressions))
+	for _, reg := range regress.FindRegressions(c, r) {
+		startTime, _ := x.Get(reg.StartRow)
+		endTime, _ := x.Get(reg.EndRow)
+		start, end := int64(startTime)-labels.Tolerance, int64(endTime)+labels.Tolerance
+
+		matched := false
+		for i, t := range labels.Regressions {
+			if (t >= start) && (t <= end) {
+				found[i] = true
+				matched = true
+			}
+		}
+		switch {
+		case matched:
+			s.Matched++
+		case within(labels.NonEvents, start, end):
+			s.FalsePositives++
+		default:
+			s.Unlabeled++
+			if labels.Complete {
+				s.FalsePositives++
+			}
+		}
+	}
+
+	for _, f := range found {
+		if f {
+			s.Found++
+		}
+	}
+	s.Missed = len(found) - s.Found
+	if s.Matched+s.FalsePositives > 0 {
+		s.Precision = float64(s.Matched) / float64(s.Matched+s.FalsePositives)
+	}
+	if len(found) > 0 {
+		s.Recall = float64(s.Found) / float64(len(found))
+	}
+	if s.Precision+s.Recall > 0 {
+		s.F1 = 2 * s.Precision * s.Recall / (s.Precision + s.Recall)
+	}
+	return s
+}
+
+// within returns true if a time in times is within [start, end].
+func within(times []int64, start, end int64) bool {
+	for _, t := range times {
+		if (t >= start) && (t <= end) {
+			return true
+		}
+	}
+	return false
+}
+
+type byQuality []Score
+
+func (s byQuality) Len() int      { return len(s) }
+func (s byQuality) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// Less orders by F1, then precision, then fewest unlabeled regressions.
+func (s byQuality) Less(i, j int) bool {
+	a, b := s[i], s[j]
+	switch {
+	case a.F1 != b.F1:
+		return a.F1 > b.F1
+	case a.Precision != b.Precision:
+		return a.Precision > b.Precision
+	}
+	return a.Unlabeled < b.Unlabeled
+}
+
+// Sweep scores each setting of grid applied to base over c, with times x in
+// ascending order, best first, and in grid order when equal.  Seasonality set
+// in base is removed once for all settings.
+func Sweep(x, c *column.Floats, base regress.RegressionParams, grid Grid, labels Labels) []Score {
+	if base.SeasonMillis != 0 {
+		c, _ = regress.Deseasonalize(c, x, base)
+	}
+	settings := grid.Settings()
+	scores := make([]Score, len(settings))
+	for i := range settings {
+		scores[i] = Evaluate(x, c, settings[i].Apply(base), labels)
+		scores[i].Setting = settings[i]
+	}
+	sort.Stable(byQuality(scores))
+	return scores
+}
+
+// Recommend returns the setting of the best of scores, as sorted by Sweep, or
+// nil if it finds no labeled regression.
+func Recommend(scores []Score) *regress.Override {
+	if (len(scores) == 0) || (scores[0].Found == 0) {
+		return nil
+	}
+	setting := scores[0].Setting
+	return &setting
+}
+
+// Metric holds the scores of a data column, best first, and the setting
+// recommended for it (see Recommend).
+type Metric struct {
+	Column      string            `json:"column"`
+	Recommended *regress.Override `json:"recommended,omitempty"`
+	Scores      []Score           `json:"scores"`
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backtest
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/regress"
+	"testing"
+)
+
+// history returns times 0, 1000, ... and values 100 with steps to 110 at row 10
+// and to 104 at row 20, and a spike of 1% at row 30.
+func history() (x, c *column.Floats) {
+	x, c = column.NewFloats(40), column.NewFloats(40)
+	for i := 0; i < 40; i++ {
+		x.Set(i, float64(i*1000))
+		switch {
+		case i == 30:
+			c.Set(i, 105.05)
+		case i >= 20:
+			c.Set(i, 104)
+		case i >= 10:
+			c.Set(i, 110)
+		default:
+			c.Set(i, 100)
+		}
+	}
+	return x, c
+}
+
+func TestEvaluate(t *testing.T) {
+	x, c := history()
+	labels := Labels{Regressions: []int64{10000, 20000}, NonEvents: []int64{30000}}
+	pos, neg := 0.5, -0.5
+	r := regress.RegressionParams{Window: 1, Pos: &pos, Neg: &neg, UsePercent: true}
+
+	// Both steps, and the spike up and down at the non-event.
+	got := Evaluate(x, c, r, labels)
+	if (got.Found != 2) || (got.Missed != 0) || (got.Matched != 2) || (got.FalsePositives != 2) ||
+		(got.Precision != 0.5) || (got.Recall != 1) {
+		t.Errorf("got %+v", got)
+	}
+
+	// Only the first step.
+	pos, neg = 8, -8
+	got = Evaluate(x, c, r, labels)
+	if (got.Found != 1) || (got.Missed != 1) || (got.FalsePositives != 0) ||
+		(got.Precision != 1) || (got.Recall != 0.5) {
+		t.Errorf("got %+v", got)
+	}
+
+	// Without the non-event the spike is unlabeled, and false if complete.
+	pos, neg = 0.5, -0.5
+	labels.NonEvents = nil
+	if got = Evaluate(x, c, r, labels); (got.Unlabeled != 2) || (got.FalsePositives != 0) {
+		t.Errorf("got %+v", got)
+	}
+	labels.Complete = true
+	if got = Evaluate(x, c, r, labels); (got.Unlabeled != 2) || (got.FalsePositives != 2) {
+		t.Errorf("got %+v", got)
+	}
+
+	// A label just after a regression matches within the tolerance.
+	labels = Labels{Regressions: []int64{12500}}
+	if got = Evaluate(x, c, r, labels); got.Found != 0 {
+		t.Errorf("got %+v, want nothing found", got)
+	}
+	labels.Tolerance = 2500
+	if got = Evaluate(x, c, r, labels); got.Found != 1 {
+		t.Errorf("got %+v, want the label found", got)
+	}
+}
+
+func TestSweepRecommend(t *testing.T) {
+	x, c := history()
+	labels := Labels{Regressions: []int64{10000, 20000}, NonEvents: []int64{30000}}
+	grid := Grid{
+		Thresholds: []float64{0.5, 2, 8},
+		Windows:    []int{1},
+		Radii:      []int{0},
+		UsePercent: []bool{true}}
+	scores := Sweep(x, c, regress.RegressionParams{}, grid, labels)
+	if len(scores) != 3 {
+		t.Fatalf("got %d scores, want 3", len(scores))
+	}
+	if (*scores[0].Setting.Pos != 2) || (*scores[0].Setting.Neg != -2) || (scores[0].F1 != 1) {
+		t.Errorf("got best %+v, want threshold 2", scores[0])
+	}
+	// Thresholds 8 and 0.5 tie on F1; 8 has the better precision.
+	if *scores[1].Setting.Pos != 8 {
+		t.Errorf("got second %+v, want threshold 8", scores[1])
+	}
+	if o := Recommend(scores); (o == nil) || (*o.Pos != 2) || (*o.Window != 1) || !*o.UsePercent {
+		t.Errorf("got recommended %+v", o)
+	}
+
+	if o := Recommend(Sweep(x, c, regress.RegressionParams{}, grid, Labels{Regressions: []int64{5000}})); o != nil {
+		t.Errorf("got recommended %+v, want none when nothing is found", o)
+	}
+}
+
+func TestGridValidate(t *testing.T) {
+	if err := DefaultGrid.Validate(); err != nil {
+		t.Error(err)
+	}
+	if n := len(DefaultGrid.Settings()); n != 6*4*3 {
+		t.Errorf("got %d settings, want %d", n, 6*4*3)
+	}
+
+	// Without windows and radii, as for other detectors, they are left unset.
+	g := Grid{Thresholds: []float64{1, 2}, UsePercent: []bool{true}}
+	if settings := g.Settings(); (len(settings) != 2) || (settings[0].Window != nil) || (settings[1].Radius != nil) {
+		t.Errorf("got %+v, want 2 settings without window and radius", settings)
+	}
+
+	many := make([]float64, MaxSettings)
+	for i := range many {
+		many[i] = float64(i + 1)
+	}
+	for _, g := range []Grid{
+		{Thresholds: many, Windows: []int{1, 2}, Radii: []int{0}, UsePercent: []bool{true}},
+		{Thresholds: []float64{0}, Windows: []int{1}, Radii: []int{0}, UsePercent: []bool{true}},
+		{Thresholds: []float64{1}, Windows: []int{0}, Radii: []int{0}, UsePercent: []bool{true}},
+		{Thresholds: []float64{1}, Windows: []int{1}, Radii: []int{-1}, UsePercent: []bool{true}},
+	} {
+		if err := g.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", g)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cassandradb
+
+import (
+	"encoding/json"
+	"github.com/adilhn/gossie/src/gossie"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/db/dbcommon"
+	"strconv"
+)
+
+// All alert rules are columns of this row.
+const alertRulesKey = "rules"
+
+func (c *CassandraDB) WriteAlertRule(rule db.AlertRule) (err error) {
+	value, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	row := &gossie.Row{[]byte(alertRulesKey), []*gossie.Column{{Name: []byte(rule.Name), Value: value}}}
+	return c.pool.Writer().Insert(dbcommon.CFAlerts, row).Run()
+}
+
+func (c *CassandraDB) ReadAlertRules() (rules []db.AlertRule, err error) {
+	row, err := c.pool.Reader().Cf(dbcommon.CFAlerts).Get([]byte(alertRulesKey))
+	if (err != nil) || (row == nil) {
+		return nil, err
+	}
+	for _, column := range row.Columns {
+		var rule db.AlertRule
+		if err := json.Unmarshal(column.Value, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// DeleteAlertRule deletes the rule and the record of the alerts it fired.
+func (c *CassandraDB) DeleteAlertRule(name string) (err error) {
+	return c.pool.Writer().
+		DeleteColumns(dbcommon.CFAlerts, []byte(alertRulesKey), [][]byte{[]byte(name)}).
+		Delete(dbcommon.CFFired, []byte(name)).Run()
+}
+
+func (c *CassandraDB) ReadFiredAlerts(rule string) (fired map[string]int64, err error) {
+	row, err := c.pool.Reader().Cf(dbcommon.CFFired).Get([]byte(rule))
+	if err != nil {
+		return nil, err
+	}
+	fired = make(map[string]int64)
+	if row == nil {
+		return fired, nil
+	}
+	for _, column := range row.Columns {
+		timestamp, err := strconv.ParseInt(string(column.Value), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		fired[string(column.Name)] = timestamp
+	}
+	return fired, nil
+}
+
+func (c *CassandraDB) WriteFiredAlert(rule, key string, timestamp int64) (err error) {
+	row := &gossie.Row{[]byte(rule), []*gossie.Column{{
+		Name:  []byte(key),
+		Value: []byte(strconv.FormatInt(timestamp, 10))}}}
+	return c.pool.Writer().Insert(dbcommon.CFFired, row).Run()
+}
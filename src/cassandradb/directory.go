@@ -25,9 +25,13 @@ import (
 	"github.com/google/tsviewdb/src/db"
 	"github.com/google/tsviewdb/src/db/dbcommon"
 	pb "github.com/google/tsviewdb/src/proto"
+	"github.com/google/tsviewdb/src/regress"
 	"strings"
 )
 
+// Directory rows read per RangeGet.
+const dirPageSize = 100
+
 func match(req db.DirectorySearchRequest, columnName []byte) bool {
 	return (req.FileRestrict == "") ||
 		req.FilePrefixMatch && strings.HasPrefix(string(columnName), req.FileRestrict) ||
@@ -43,12 +47,28 @@ func (c *CassandraDB) ReadDir(req db.DirectorySearchRequest) (sInfo db.SourceInf
 		prefixPlusOne = prefix
 	}
 
-	rows, err := c.pool.Reader().Cf(dbcommon.CFChildren).RangeGet(
-		&gossie.Range{Start: []byte(prefix), End: []byte(prefixPlusOne), Count: 100})
-	if err != nil {
-		return db.SourceInfoUncomp{}, err
+	// Page over the directory rows, starting each page just past the last key
+	// read.
+	for start := []byte(prefix); ; {
+		rows, err := c.pool.Reader().Cf(dbcommon.CFChildren).RangeGet(
+			&gossie.Range{Start: start, End: []byte(prefixPlusOne), Count: dirPageSize})
+		if err != nil {
+			return db.SourceInfoUncomp{}, err
+		}
+		if err := readDirRows(req, rows, &sInfo); err != nil {
+			return db.SourceInfoUncomp{}, err
+		}
+		if len(rows) < dirPageSize {
+			break
+		}
+		start = append(append([]byte{}, rows[len(rows)-1].Key...), 0)
 	}
 
+	return sInfo, nil
+}
+
+// readDirRows appends the entries of directory rows matching req to sInfo.
+func readDirRows(req db.DirectorySearchRequest, rows []*gossie.Row, sInfo *db.SourceInfoUncomp) error {
 	for _, row := range rows {
 		rowName := row.Key[1:]
 		for _, column := range row.Columns {
@@ -57,7 +77,7 @@ func (c *CassandraDB) ReadDir(req db.DirectorySearchRequest) (sInfo db.SourceInf
 			}
 			s := new(pb.SourceInfo)
 			if err := proto.Unmarshal(column.Value, s); err != nil {
-				return db.SourceInfoUncomp{}, err
+				return err
 			}
 			if req.ReturnMetrics || req.ReturnUnits {
 				for nameIndex, metricName := range s.MetricNames {
@@ -77,6 +97,13 @@ func (c *CassandraDB) ReadDir(req db.DirectorySearchRequest) (sInfo db.SourceInf
 					if req.ReturnSelectForDefaults && (selectForDefaultsConsistent) {
 						sInfo.SelectForDefaults = append(sInfo.SelectForDefaults, s.SelectForDefaults[nameIndex])
 					}
+					if req.ReturnRegressionDefaults { // Kept parallel to Names.
+						var o *regress.Override
+						if len(s.RegressionDefaults) == len(s.MetricNames) {
+							o = dbcommon.RegressionDefaultsFromProto(s.RegressionDefaults[nameIndex])
+						}
+						sInfo.RegressionDefaults = append(sInfo.RegressionDefaults, o)
+					}
 
 				}
 			} else {
@@ -85,8 +112,7 @@ func (c *CassandraDB) ReadDir(req db.DirectorySearchRequest) (sInfo db.SourceInf
 			}
 		}
 	}
-
-	return sInfo, nil
+	return nil
 }
 
 func (c *CassandraDB) WriteDir(si db.SourceInfoUncomp, src string) (err error) {
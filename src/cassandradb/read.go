@@ -19,8 +19,10 @@ package cassandradb
 import (
 	"code.google.com/p/goprotobuf/proto"
 	"errors"
+	"github.com/adilhn/gossie/src/gossie"
 	"github.com/golang/glog"
 	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/configfilter"
 	"github.com/google/tsviewdb/src/db"
 	"github.com/google/tsviewdb/src/db/dbcommon"
 	pb "github.com/google/tsviewdb/src/proto"
@@ -31,6 +33,7 @@ import (
 
 type dtablePtrErr struct {
 	*db.DataTable
+	idx int // Index of source.
 	err error
 }
 
@@ -38,23 +41,39 @@ func (c *CassandraDB) ReadRows(req db.RowRangeRequests) (returnVal *db.DataTable
 	numTables := len(req.FilteredSources)
 	dTables := make([]*db.DataTable, numTables)
 	resultsChan := make(chan dtablePtrErr, numTables)
+
+	sourceReq := req
+	joinOnConfig := (req.JoinOnConfig != "") && (numTables > 1)
+	if joinOnConfig {
+		sourceReq.ReturnConfigs = true // Needed to join.
+	}
+
 	// Start all requests in parallel.
 	for i := range req.FilteredSources {
 		go func(j int) {
 			glog.V(3).Infoln("Starting req", j)
 			var err error
-			tmpDTable, err := c.readRowRange(req, j) // Read one of the sources.
-			resultsChan <- dtablePtrErr{tmpDTable, err}
+			tmpDTable, err := c.readRowRange(sourceReq, j) // Read one of the sources.
+			resultsChan <- dtablePtrErr{tmpDTable, j, err}
 		}(i)
 	}
 	// Gather results.
 	for i := 0; i < numTables; i++ {
-		var err error
 		dp := <-resultsChan
-		dTables[i], err = dp.DataTable, dp.err
-		if err != nil {
-			return nil, err
+		if dp.err != nil {
+			return nil, dp.err
 		}
+		dTables[dp.idx] = dp.DataTable
+	}
+
+	if req.BucketMillis > 0 {
+		t0 := time.Now()
+		for _, dTable := range dTables {
+			if err := dTable.BucketRows(req.BucketMillis, req.BucketReducer); err != nil {
+				return nil, err
+			}
+		}
+		glog.V(2).Infof("PERF: bucket time: %v\n", time.Now().Sub(t0))
 	}
 
 	if len(dTables) == 1 { // Optimization for common case.
@@ -67,7 +86,15 @@ func (c *CassandraDB) ReadRows(req db.RowRangeRequests) (returnVal *db.DataTable
 	for i := 0; i < numTables; i++ {
 		srcs = append(srcs, req.FilteredSources[i].Source)
 	}
-	resultTable := db.MergeDataTables(dTables, srcs, req.ReturnIds, req.ReturnConfigs)
+	if joinOnConfig {
+		return db.MergeDataTablesOnConfig(dTables, srcs, req.JoinOnConfig, req.InnerJoin,
+			req.ReturnIds, req.ReturnConfigs), nil
+	}
+	if req.NearestMillis > 0 {
+		return db.MergeDataTablesNearest(dTables, srcs, req.NearestMillis, req.InnerJoin,
+			req.ReturnIds, req.ReturnConfigs), nil
+	}
+	resultTable := db.MergeDataTables(dTables, srcs, req.InnerJoin, req.ReturnIds, req.ReturnConfigs)
 	return resultTable, nil
 }
 
@@ -77,6 +104,7 @@ func (c *CassandraDB) readRowRange(req db.RowRangeRequests, reqNum int) (returnV
 	metricsFilter := fs.MetricsFilter
 	aggregatesFilter := fs.AggregatesFilter
 	configsFilter := fs.ConfigsFilter
+	groupBy := fs.GroupByConfigs
 
 	startPrefix, endPrefix := dbcommon.MakeRowPrefixes(src, req.StartTimestamp,
 		req.EndTimestamp, true)
@@ -89,8 +117,10 @@ func (c *CassandraDB) readRowRange(req db.RowRangeRequests, reqNum int) (returnV
 	if !req.NoReturnAggregates {
 		aggregationResultChan = getColumnFamilyRange(dbcommon.CFAggregates, c.pool, startPrefix, endPrefix, req.MaxResults)
 	}
+	// Configs are also needed to filter and group rows.
+	readConfigs := req.ReturnConfigs || (configsFilter != nil) || (groupBy != nil)
 	var cfgResultChan <-chan rowResults
-	if req.ReturnConfigs {
+	if readConfigs {
 		cfgResultChan = getColumnFamilyRange(dbcommon.CFConfigs, c.pool, startPrefix, endPrefix, req.MaxResults)
 	}
 
@@ -99,10 +129,18 @@ func (c *CassandraDB) readRowRange(req db.RowRangeRequests, reqNum int) (returnV
 	/////////////////////////////////////////////////////////////////////////////
 	// Read configs.
 
-	var excludeIdSet map[string]bool
-	if req.ReturnConfigs {
+	var matchIdSet map[string]bool      // Filter results for rows with configs.
+	var groupSuffixes map[string]string // Column name suffixes for rows with configs.
+	// Configs in read order, with a row id for every row so rows without
+	// configs are counted.
+	cfgTable := new(db.DataTable)
+	cfgRowIdx := make(map[string]int) // Map from row id to cfgTable row.
+	if readConfigs {
 		if configsFilter != nil {
-			excludeIdSet = make(map[string]bool)
+			matchIdSet = make(map[string]bool)
+		}
+		if groupBy != nil {
+			groupSuffixes = make(map[string]string)
 		}
 		cfgResult := <-cfgResultChan
 		if cfgResult.err != nil {
@@ -111,50 +149,51 @@ func (c *CassandraDB) readRowRange(req db.RowRangeRequests, reqNum int) (returnV
 		cfgRows := cfgResult.Rows
 		glog.V(3).Infoln("len(cfgRows)", len(cfgRows))
 
-		// Map from name to data slot to write data in data row.
+		// Map from name to config column.
 		columnNameReverseMap := make(map[string]int)
 
 		for _, cfgRow := range cfgRows {
 			if cfgRow == nil {
 				continue
 			}
-			// Created at least as much space as we know we'll use.  For data that
-			// contains the same config names for every record (typical) this space
-			// allocation will not change after the first row read.
-			ctrow := make([]*string, len(dataTable.ConfigsColumnNames))
-
-			var rowMatch bool // Used only when configsFilter is set.
-			for _, column := range cfgRow.Columns {
-				columnName := string(column.Name)
-				valueStr := string(column.Value)
-				if (configsFilter != nil) && (configsFilter[columnName] == valueStr) {
-					rowMatch = true
+			if (configsFilter != nil) || (groupBy != nil) {
+				configs := configsMap(cfgRow.Columns)
+				if configsFilter != nil {
+					match := configsFilter.Match(configs)
+					matchIdSet[string(cfgRow.Key)] = match // Mark row for aggregates.
+					if !match {
+						continue
+					}
 				}
-				if columnNameIndex, ok := columnNameReverseMap[columnName]; !ok { // Which slot to write data.
-					columnNameReverseMap[columnName] = len(dataTable.ConfigsColumnNames)
-					dataTable.ConfigsColumnNames = append(dataTable.ConfigsColumnNames, columnName)
-					ctrow = append(ctrow, &valueStr)
-				} else {
-					ctrow[columnNameIndex] = &valueStr
+				if groupBy != nil {
+					groupSuffixes[string(cfgRow.Key)] = common.GroupSuffix(groupBy, configs)
 				}
 			}
-
-			if (configsFilter != nil) && !rowMatch { // If not match, dump row and continue.
-				excludeIdSet[string(cfgRow.Key)] = true // Mark row as excluded for aggregates.
-				ctrow = nil                             // Mark as garbage
+			if !req.ReturnConfigs {
 				continue
 			}
 
-			dataTable.Configs = append(dataTable.Configs, &ctrow)
-
-			if req.NoReturnAggregates && req.ReturnIds {
-				dataTable.IdColumn = append(dataTable.IdColumn, string(cfgRow.Key))
+			row := cfgTable.AppendRow()
+			cfgTable.IdColumn = append(cfgTable.IdColumn, string(cfgRow.Key))
+			cfgRowIdx[string(cfgRow.Key)] = row
+			for _, column := range cfgRow.Columns {
+				columnName := string(column.Name)
+				columnNameIndex, ok := columnNameReverseMap[columnName]
+				if !ok {
+					columnNameIndex = len(cfgTable.ConfigsColumnNames)
+					columnNameReverseMap[columnName] = columnNameIndex
+					cfgTable.AddConfigColumn(columnName)
+				}
+				cfgTable.Configs[columnNameIndex].Set(row, string(column.Value))
 			}
+		}
 
+		if req.NoReturnAggregates {
+			dataTable = cfgTable
+			if !req.ReturnIds {
+				dataTable.IdColumn = nil
+			}
 		}
-		t2 := time.Now()
-		dataTable.SortConfigsColumns()
-		glog.V(2).Infof("PERF: Config sort time: %v\n", time.Now().Sub(t2))
 	}
 
 	/////////////////////////////////////////////////////////////////////////////
@@ -169,72 +208,137 @@ func (c *CassandraDB) readRowRange(req db.RowRangeRequests, reqNum int) (returnV
 		glog.V(3).Infoln("len(aggregateRows) = ", len(aggregateRows))
 
 		var totalAggregationTime time.Duration
+		// For rows without configs.
+		noConfigsMatch := configsMatch(configsFilter, nil)
+		var noConfigsSuffix string
+		if groupBy != nil {
+			noConfigsSuffix = common.GroupSuffix(groupBy, nil)
+		}
 
-		// Map from name to data slot to write data in data row.
+		// Map from name to data column.
 		columnNameReverseMap := make(map[string]int)
 
-		dataTable.ColumnNames = append(dataTable.ColumnNames, common.TimeName) // First column.
+		x := dataTable.AddColumn(common.TimeName) // First column.
+		var cfgOrder []int                        // cfgTable row of each row, or -1.
 
 		for _, aggregatesRow := range aggregateRows {
 			if aggregatesRow == nil {
 				continue
 			}
-			if (configsFilter != nil) && excludeIdSet[string(aggregatesRow.Key)] {
-				continue
+			if configsFilter != nil {
+				match, ok := matchIdSet[string(aggregatesRow.Key)]
+				if (ok && !match) || (!ok && !noConfigsMatch) {
+					continue
+				}
 			}
-			// Created at least as much space as we know we'll use.  For data that
-			// contains the same metrics for every record (typical) this space
-			// allocation will not change after the first row read.
-			dtrow := make([]*float64, len(dataTable.ColumnNames))
 
-			dataTable.Data = append(dataTable.Data, &dtrow)
-			dtrow[0] = proto.Float64(float64(dbcommon.GetTimestamp(aggregatesRow.Key)))
+			row := dataTable.AppendRow()
+			x.Set(row, float64(dbcommon.GetTimestamp(aggregatesRow.Key)))
 			if req.ReturnIds {
 				dataTable.IdColumn = append(dataTable.IdColumn, string(aggregatesRow.Key))
 			}
+			if req.ReturnConfigs {
+				cfgIdx, ok := cfgRowIdx[string(aggregatesRow.Key)]
+				if !ok {
+					cfgIdx = -1
+				}
+				cfgOrder = append(cfgOrder, cfgIdx)
+			}
+
+			var suffix string
+			if groupBy != nil {
+				var ok bool
+				if suffix, ok = groupSuffixes[string(aggregatesRow.Key)]; !ok {
+					suffix = noConfigsSuffix
+				}
+			}
 
 			for _, column := range aggregatesRow.Columns {
 				if (metricsFilter != nil) && !metricsFilter[string(column.Name)] {
 					continue
 				}
 
-				aggregation := new(pb.Aggregation)
-
-				if err := proto.Unmarshal(column.Value, aggregation); err != nil {
-					return nil, errors.New("An error occured during aggregation unmarshalling.")
-				}
-
 				t0 := time.Now()
-				aggregation.MakeDouble()
-
-				fields, values := pb.GetDoubleFieldsAndValuesFiltered(aggregation,
-					aggregatesFilter, req.SetAggregateIfMissing)
+				err := decodeAggregates(column, aggregatesFilter, req.SetAggregateIfMissing,
+					func(columnName string, val *float64) {
+						columnName += suffix
+						columnNameIndex, ok := columnNameReverseMap[columnName]
+						if !ok {
+							columnNameIndex = len(dataTable.ColumnNames)
+							columnNameReverseMap[columnName] = columnNameIndex
+							dataTable.AddColumn(columnName)
+						}
+						dataTable.Data[columnNameIndex].SetPtr(row, val)
+					})
 				totalAggregationTime += time.Now().Sub(t0)
-
-				for fieldIndex, field := range fields {
-					columnName := strings.Join([]string{string(column.Name), field}, ".")
-					val := values[fieldIndex]
-					if columnNameIndex, ok := columnNameReverseMap[columnName]; !ok { // Which slot to write data.
-						columnNameReverseMap[columnName] = len(dataTable.ColumnNames)
-						dataTable.ColumnNames = append(dataTable.ColumnNames, columnName)
-						dtrow = append(dtrow, val)
-					} else {
-						dtrow[columnNameIndex] = val
-					}
+				if err != nil {
+					return nil, err
 				}
 			}
 
 		}
 		if len(dataTable.ColumnNames) == 1 {
-			return nil, errors.New("No results for: " + req.FilteredSources[reqNum].Source)
+			return nil, &db.NoResultsError{Source: req.FilteredSources[reqNum].Source}
+		}
+
+		// Line up configs with the aggregates rows.
+		if req.ReturnConfigs {
+			dataTable.ConfigsColumnNames = cfgTable.ConfigsColumnNames
+			for _, c := range cfgTable.Configs {
+				dataTable.Configs = append(dataTable.Configs, c.Take(cfgOrder))
+			}
 		}
 
 		glog.V(3).Infof("PERF: accumulated aggregate unpacking time: %v\n", totalAggregationTime)
 	}
 
+	if req.ReturnConfigs {
+		t2 := time.Now()
+		dataTable.SortConfigsColumns()
+		glog.V(2).Infof("PERF: Config sort time: %v\n", time.Now().Sub(t2))
+	}
+
 	return dataTable, nil
 }
 
+// configsMatch returns true if a row with the given config columns passes
+// configsFilter.  A row without a config row (nil columns) is matched as having
+// no configs.
+func configsMatch(configsFilter configfilter.Filter, columns []*gossie.Column) bool {
+	if configsFilter == nil {
+		return true
+	}
+	return configsFilter.Match(configsMap(columns))
+}
+
+// configsMap returns the config key/value pairs of a config row.
+func configsMap(columns []*gossie.Column) map[string]string {
+	configs := make(map[string]string, len(columns))
+	for _, column := range columns {
+		configs[string(column.Name)] = string(column.Value)
+	}
+	return configs
+}
+
+// decodeAggregates unpacks a single metric's aggregates column and calls set
+// with the full column name ("metric.aggregate") and value of every aggregate
+// passing aggregatesFilter.
+func decodeAggregates(column *gossie.Column, aggregatesFilter map[string]bool,
+	setAggregateIfMissing bool, set func(columnName string, val *float64)) error {
+	aggregation := new(pb.Aggregation)
+	if err := proto.Unmarshal(column.Value, aggregation); err != nil {
+		return errors.New("An error occured during aggregation unmarshalling.")
+	}
+	aggregation.MakeDouble()
+
+	fields, values := pb.GetDoubleFieldsAndValuesFiltered(aggregation,
+		aggregatesFilter, setAggregateIfMissing)
+	for fieldIndex, field := range fields {
+		set(strings.Join([]string{string(column.Name), field}, "."), values[fieldIndex])
+	}
+	return nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////////////////////
 
@@ -0,0 +1,177 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cassandradb
+
+import (
+	"flag"
+	"github.com/adilhn/gossie/src/gossie"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/db/dbcommon"
+)
+
+var streamPageSize = flag.Int("cassandradb.streamPageSize", 1000,
+	"Number of rows read per DB request for streamed range reads.")
+
+// StreamRows reads sources one after the other, a page of rows at a time, and
+// calls w for every row as soon as its page is decoded.  Rows of a source are
+// returned in DB order (most recent first) and are not merged across sources.
+func (c *CassandraDB) StreamRows(req db.RowRangeRequests, w db.RowWriter) (err error) {
+	for i := range req.FilteredSources {
+		if err = c.streamRowRange(req, i, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CassandraDB) streamRowRange(req db.RowRangeRequests, reqNum int, w db.RowWriter) error {
+	fs := req.FilteredSources[reqNum]
+
+	startPrefix, endPrefix := dbcommon.MakeRowPrefixes(fs.Source, req.StartTimestamp,
+		req.EndTimestamp, true)
+
+	// Page over the column family that determines which rows are returned.
+	pageCF := dbcommon.CFAggregates
+	if req.NoReturnAggregates {
+		pageCF = dbcommon.CFConfigs
+	}
+	readConfigs := req.ReturnConfigs || (fs.ConfigsFilter != nil) || (fs.GroupByConfigs != nil)
+
+	start := []byte(startPrefix)
+	remaining := req.MaxResults
+	for remaining > 0 {
+		count := *streamPageSize
+		if count > remaining {
+			count = remaining
+		}
+		rows, err := c.pool.Reader().Cf(pageCF).ReturnNilRows(true).RangeGet(
+			&gossie.Range{Start: start, End: []byte(endPrefix), Count: count})
+		if err != nil {
+			return err
+		}
+		glog.V(3).Infoln("Streaming page of", len(rows), "rows for", fs.Source)
+
+		var keys [][]byte
+		for _, row := range rows {
+			if row != nil {
+				keys = append(keys, row.Key)
+			}
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		// Configs are stored in a different column family, so read those
+		// matching the page's keys.
+		var cfgRows map[string]*gossie.Row
+		if readConfigs {
+			if pageCF == dbcommon.CFConfigs {
+				cfgRows = make(map[string]*gossie.Row, len(rows))
+				for _, row := range rows {
+					if row != nil {
+						cfgRows[string(row.Key)] = row
+					}
+				}
+			} else if cfgRows, err = c.multiGetRows(dbcommon.CFConfigs, keys); err != nil {
+				return err
+			}
+		}
+
+		for _, row := range rows {
+			if row == nil {
+				continue
+			}
+			if err := streamRow(req, fs, row, cfgRows, w); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < count { // No more rows in range.
+			return nil
+		}
+		remaining -= len(rows)
+		// Start just past the last key read.
+		start = append(append([]byte{}, keys[len(keys)-1]...), 0)
+	}
+	return nil
+}
+
+func (c *CassandraDB) multiGetRows(cf string, keys [][]byte) (map[string]*gossie.Row, error) {
+	rows, err := c.pool.Reader().Cf(cf).MultiGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	rowMap := make(map[string]*gossie.Row, len(rows))
+	for _, row := range rows {
+		if row != nil {
+			rowMap[string(row.Key)] = row
+		}
+	}
+	return rowMap, nil
+}
+
+// streamRow decodes a single row and passes it to w unless it is excluded by
+// the configs filter.  Aggregate names have a group suffix when grouping.
+func streamRow(req db.RowRangeRequests, fs db.FilteredSource, row *gossie.Row,
+	cfgRows map[string]*gossie.Row, w db.RowWriter) error {
+	var cfgColumns []*gossie.Column
+	if cfgRow := cfgRows[string(row.Key)]; cfgRow != nil {
+		cfgColumns = cfgRow.Columns
+	}
+	if !configsMatch(fs.ConfigsFilter, cfgColumns) {
+		return nil
+	}
+	var suffix string
+	if fs.GroupByConfigs != nil {
+		suffix = common.GroupSuffix(fs.GroupByConfigs, configsMap(cfgColumns))
+	}
+
+	sRow := &db.StreamRow{
+		Source:    fs.Source,
+		Timestamp: dbcommon.GetTimestamp(row.Key)}
+	if req.ReturnIds {
+		sRow.Id = string(row.Key)
+	}
+	if req.ReturnConfigs && (len(cfgColumns) > 0) {
+		sRow.Configs = make(map[string]string, len(cfgColumns))
+		for _, column := range cfgColumns {
+			sRow.Configs[string(column.Name)] = string(column.Value)
+		}
+	}
+
+	if !req.NoReturnAggregates {
+		sRow.Aggregates = make(map[string]float64)
+		for _, column := range row.Columns {
+			if (fs.MetricsFilter != nil) && !fs.MetricsFilter[string(column.Name)] {
+				continue
+			}
+			err := decodeAggregates(column, fs.AggregatesFilter, req.SetAggregateIfMissing,
+				func(columnName string, val *float64) {
+					if val != nil {
+						sRow.Aggregates[columnName+suffix] = *val
+					}
+				})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return w(sRow)
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cassandradb
+
+import (
+	"encoding/json"
+	"github.com/adilhn/gossie/src/gossie"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/db/dbcommon"
+)
+
+// WriteTriage saves t in a column of the row of its source, named by t.Key().
+func (c *CassandraDB) WriteTriage(t db.Triage) (err error) {
+	value, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	row := &gossie.Row{[]byte(t.Source), []*gossie.Column{{Name: []byte(t.Key()), Value: value}}}
+	return c.pool.Writer().Insert(dbcommon.CFTriage, row).Run()
+}
+
+func (c *CassandraDB) ReadTriages(source string) (triages []db.Triage, err error) {
+	row, err := c.pool.Reader().Cf(dbcommon.CFTriage).Get([]byte(source))
+	if (err != nil) || (row == nil) {
+		return nil, err
+	}
+	for _, column := range row.Columns {
+		var t db.Triage
+		if err := json.Unmarshal(column.Value, &t); err != nil {
+			return nil, err
+		}
+		triages = append(triages, t)
+	}
+	return triages, nil
+}
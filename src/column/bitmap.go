@@ -0,0 +1,70 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package column holds table columns as contiguous values with a validity
+// bitmap, so that a missing value costs one bit rather than a pointer.
+package column
+
+// Bitmap has one bit per row, set if the row has a value.
+type Bitmap []uint64
+
+func bitmapWords(n int) int {
+	return (n + 63) >> 6
+}
+
+func (b Bitmap) Get(i int) bool {
+	w := i >> 6
+	return (w < len(b)) && ((b[w] & (1 << uint(i&63))) != 0)
+}
+
+func (b Bitmap) Set(i int) {
+	b[i>>6] |= 1 << uint(i&63)
+}
+
+func (b Bitmap) Clear(i int) {
+	b[i>>6] &^= 1 << uint(i&63)
+}
+
+// resize returns b with room for n bits, clearing any bits from n on.
+func (b Bitmap) resize(n int) Bitmap {
+	words := bitmapWords(n)
+	if words <= cap(b) {
+		old := len(b)
+		b = b[:words]
+		for i := old; i < words; i++ {
+			b[i] = 0
+		}
+	} else {
+		newB := make(Bitmap, words, 2*words)
+		copy(newB, b)
+		b = newB
+	}
+	if (n & 63) != 0 {
+		b[words-1] &= (1 << uint(n&63)) - 1
+	}
+	return b
+}
+
+// take returns a bitmap whose bit i is bit idx[i] of b, or clear if idx[i] < 0.
+func (b Bitmap) take(idx []int) Bitmap {
+	result := make(Bitmap, bitmapWords(len(idx)))
+	for i, j := range idx {
+		if (j >= 0) && b.Get(j) {
+			result.Set(i)
+		}
+	}
+	return result
+}
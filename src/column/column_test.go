@@ -0,0 +1,105 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package column
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func f(v float64) *float64 { return &v }
+func s(v string) *string   { return &v }
+
+func TestFloatsAppendResize(t *testing.T) {
+	c := NewFloats(0)
+	for i := 0; i < 130; i++ {
+		if i%3 == 0 {
+			c.AppendNull()
+		} else {
+			c.Append(float64(i))
+		}
+	}
+	c.Resize(65)
+	c.Resize(70) // Extended values must be null.
+	for i := 0; i < c.Len(); i++ {
+		v, ok := c.Get(i)
+		wantOK := (i < 65) && (i%3 != 0)
+		if ok != wantOK {
+			t.Fatalf("row %d: got valid %v, want %v", i, ok, wantOK)
+		}
+		if ok && (v != float64(i)) {
+			t.Errorf("row %d: got %v", i, v)
+		}
+	}
+	if !reflect.DeepEqual(c, FloatsFromPtrs(c.Ptrs())) {
+		t.Errorf("Ptrs round trip differs: %v", c)
+	}
+}
+
+func TestFloatsTakeSwap(t *testing.T) {
+	c := FloatsFromPtrs([]*float64{f(1), nil, f(3)})
+	got := c.Take([]int{2, -1, 1, 0})
+	want := FloatsFromPtrs([]*float64{f(3), nil, nil, f(1)})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Take got: %v, want: %v", got.Ptrs(), want.Ptrs())
+	}
+	c.Swap(0, 1)
+	want = FloatsFromPtrs([]*float64{nil, f(1), f(3)})
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Swap got: %v, want: %v", c.Ptrs(), want.Ptrs())
+	}
+}
+
+func TestFloatsJSON(t *testing.T) {
+	p := []*float64{f(0), nil, f(-1.5), f(1e-7), f(123456789), f(1e21), f(3.14159)}
+	want, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := FloatsFromPtrs(p)
+	got, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	var decoded Floats
+	if err := json.Unmarshal(got, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, c) {
+		t.Errorf("decoded: %v, want: %v", decoded.Ptrs(), p)
+	}
+}
+
+func TestStringsJSON(t *testing.T) {
+	p := []*string{s("a"), nil, s(`<"b">`)}
+	want, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(StringsFromPtrs(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package column
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// Floats is a column of float64 values, any of which may be null.  Null
+// values are stored as 0 so equal columns are deeply equal.
+type Floats struct {
+	Values []float64
+	Valid  Bitmap
+}
+
+// NewFloats returns a column of n nulls.
+func NewFloats(n int) *Floats {
+	return &Floats{Values: make([]float64, n), Valid: make(Bitmap, bitmapWords(n))}
+}
+
+// FloatsFromPtrs returns a column with the values of p, nil for null.
+func FloatsFromPtrs(p []*float64) *Floats {
+	c := NewFloats(len(p))
+	for i, v := range p {
+		c.SetPtr(i, v)
+	}
+	return c
+}
+
+func (c *Floats) Len() int {
+	return len(c.Values)
+}
+
+func (c *Floats) IsNull(i int) bool {
+	return !c.Valid.Get(i)
+}
+
+// Get returns value i and whether it is not null.
+func (c *Floats) Get(i int) (float64, bool) {
+	return c.Values[i], c.Valid.Get(i)
+}
+
+// Ptr returns a pointer to a copy of value i, or nil if null.
+func (c *Floats) Ptr(i int) *float64 {
+	if !c.Valid.Get(i) {
+		return nil
+	}
+	v := c.Values[i]
+	return &v
+}
+
+// Ptrs returns the column as pointers, nil for null.
+func (c *Floats) Ptrs() []*float64 {
+	result := make([]*float64, len(c.Values))
+	for i := range result {
+		result[i] = c.Ptr(i)
+	}
+	return result
+}
+
+func (c *Floats) Set(i int, v float64) {
+	c.Values[i] = v
+	c.Valid.Set(i)
+}
+
+func (c *Floats) SetNull(i int) {
+	c.Values[i] = 0
+	c.Valid.Clear(i)
+}
+
+// SetPtr sets value i to *v, or null if v is nil.
+func (c *Floats) SetPtr(i int, v *float64) {
+	if v == nil {
+		c.SetNull(i)
+		return
+	}
+	c.Set(i, *v)
+}
+
+func (c *Floats) Append(v float64) {
+	c.Values = append(c.Values, v)
+	c.Valid = c.Valid.resize(len(c.Values))
+	c.Valid.Set(len(c.Values) - 1)
+}
+
+func (c *Floats) AppendNull() {
+	c.Values = append(c.Values, 0)
+	c.Valid = c.Valid.resize(len(c.Values))
+}
+
+// Resize truncates the column, or extends it with nulls, to n values.
+func (c *Floats) Resize(n int) {
+	old := len(c.Values)
+	if n <= cap(c.Values) {
+		c.Values = c.Values[:n]
+		for i := old; i < n; i++ {
+			c.Values[i] = 0
+		}
+	} else {
+		c.Values = append(c.Values, make([]float64, n-old)...)
+	}
+	c.Valid = c.Valid.resize(n)
+}
+
+func (c *Floats) Swap(i, j int) {
+	c.Values[i], c.Values[j] = c.Values[j], c.Values[i]
+	vi, vj := c.Valid.Get(i), c.Valid.Get(j)
+	if vi != vj {
+		if vi {
+			c.Valid.Clear(i)
+			c.Valid.Set(j)
+		} else {
+			c.Valid.Set(i)
+			c.Valid.Clear(j)
+		}
+	}
+}
+
+// Take returns a new column whose value i is value idx[i] of c, or null if
+// idx[i] < 0.
+func (c *Floats) Take(idx []int) *Floats {
+	result := &Floats{Values: make([]float64, len(idx)), Valid: c.Valid.take(idx)}
+	for i, j := range idx {
+		if (j >= 0) && c.Valid.Get(j) {
+			result.Values[i] = c.Values[j]
+		}
+	}
+	return result
+}
+
+func (c *Floats) Clone() *Floats {
+	result := &Floats{Values: make([]float64, len(c.Values)), Valid: make(Bitmap, len(c.Valid))}
+	copy(result.Values, c.Values)
+	copy(result.Valid, c.Valid)
+	return result
+}
+
+// AppendJSON appends value i to b as JSON, null if null.  Values are formatted
+// as encoding/json does.
+func (c *Floats) AppendJSON(b []byte, i int) ([]byte, error) {
+	if !c.Valid.Get(i) {
+		return append(b, "null"...), nil
+	}
+	return appendJSONFloat(b, c.Values[i])
+}
+
+func appendJSONFloat(b []byte, f float64) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return b, &json.UnsupportedValueError{Str: strconv.FormatFloat(f, 'g', -1, 64)}
+	}
+	abs := math.Abs(f)
+	format := byte('f')
+	if (abs != 0) && ((abs < 1e-6) || (abs >= 1e21)) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' { // Clean up e-09 to e-9.
+		n := len(b)
+		if (n >= 4) && (b[n-4] == 'e') && (b[n-3] == '-') && (b[n-2] == '0') {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b, nil
+}
+
+// MarshalJSON encodes the column as an array with null for null values.
+func (c *Floats) MarshalJSON() ([]byte, error) {
+	b := append(make([]byte, 0, 8*len(c.Values)), '[')
+	for i := range c.Values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		var err error
+		if b, err = c.AppendJSON(b, i); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, ']'), nil
+}
+
+func (c *Floats) UnmarshalJSON(data []byte) error {
+	var p []*float64
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*c = *FloatsFromPtrs(p)
+	return nil
+}
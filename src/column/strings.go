@@ -0,0 +1,186 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package column
+
+import (
+	"encoding/json"
+)
+
+// Strings is a column of string values, any of which may be null.  Null
+// values are stored as "" so equal columns are deeply equal.
+type Strings struct {
+	Values []string
+	Valid  Bitmap
+}
+
+// NewStrings returns a column of n nulls.
+func NewStrings(n int) *Strings {
+	return &Strings{Values: make([]string, n), Valid: make(Bitmap, bitmapWords(n))}
+}
+
+// StringsFromPtrs returns a column with the values of p, nil for null.
+func StringsFromPtrs(p []*string) *Strings {
+	c := NewStrings(len(p))
+	for i, v := range p {
+		c.SetPtr(i, v)
+	}
+	return c
+}
+
+func (c *Strings) Len() int {
+	return len(c.Values)
+}
+
+func (c *Strings) IsNull(i int) bool {
+	return !c.Valid.Get(i)
+}
+
+// Get returns value i and whether it is not null.
+func (c *Strings) Get(i int) (string, bool) {
+	return c.Values[i], c.Valid.Get(i)
+}
+
+// Ptr returns a pointer to a copy of value i, or nil if null.
+func (c *Strings) Ptr(i int) *string {
+	if !c.Valid.Get(i) {
+		return nil
+	}
+	v := c.Values[i]
+	return &v
+}
+
+// Ptrs returns the column as pointers, nil for null.
+func (c *Strings) Ptrs() []*string {
+	result := make([]*string, len(c.Values))
+	for i := range result {
+		result[i] = c.Ptr(i)
+	}
+	return result
+}
+
+func (c *Strings) Set(i int, v string) {
+	c.Values[i] = v
+	c.Valid.Set(i)
+}
+
+func (c *Strings) SetNull(i int) {
+	c.Values[i] = ""
+	c.Valid.Clear(i)
+}
+
+// SetPtr sets value i to *v, or null if v is nil.
+func (c *Strings) SetPtr(i int, v *string) {
+	if v == nil {
+		c.SetNull(i)
+		return
+	}
+	c.Set(i, *v)
+}
+
+func (c *Strings) Append(v string) {
+	c.Values = append(c.Values, v)
+	c.Valid = c.Valid.resize(len(c.Values))
+	c.Valid.Set(len(c.Values) - 1)
+}
+
+func (c *Strings) AppendNull() {
+	c.Values = append(c.Values, "")
+	c.Valid = c.Valid.resize(len(c.Values))
+}
+
+// Resize truncates the column, or extends it with nulls, to n values.
+func (c *Strings) Resize(n int) {
+	old := len(c.Values)
+	if n <= cap(c.Values) {
+		c.Values = c.Values[:n]
+		for i := old; i < n; i++ {
+			c.Values[i] = ""
+		}
+	} else {
+		c.Values = append(c.Values, make([]string, n-old)...)
+	}
+	c.Valid = c.Valid.resize(n)
+}
+
+func (c *Strings) Swap(i, j int) {
+	c.Values[i], c.Values[j] = c.Values[j], c.Values[i]
+	vi, vj := c.Valid.Get(i), c.Valid.Get(j)
+	if vi != vj {
+		if vi {
+			c.Valid.Clear(i)
+			c.Valid.Set(j)
+		} else {
+			c.Valid.Set(i)
+			c.Valid.Clear(j)
+		}
+	}
+}
+
+// Take returns a new column whose value i is value idx[i] of c, or null if
+// idx[i] < 0.
+func (c *Strings) Take(idx []int) *Strings {
+	result := &Strings{Values: make([]string, len(idx)), Valid: c.Valid.take(idx)}
+	for i, j := range idx {
+		if (j >= 0) && c.Valid.Get(j) {
+			result.Values[i] = c.Values[j]
+		}
+	}
+	return result
+}
+
+func (c *Strings) Clone() *Strings {
+	result := &Strings{Values: make([]string, len(c.Values)), Valid: make(Bitmap, len(c.Valid))}
+	copy(result.Values, c.Values)
+	copy(result.Valid, c.Valid)
+	return result
+}
+
+// AppendJSON appends value i to b as JSON, null if null.
+func (c *Strings) AppendJSON(b []byte, i int) ([]byte, error) {
+	if !c.Valid.Get(i) {
+		return append(b, "null"...), nil
+	}
+	s, err := json.Marshal(c.Values[i])
+	if err != nil {
+		return b, err
+	}
+	return append(b, s...), nil
+}
+
+// MarshalJSON encodes the column as an array with null for null values.
+func (c *Strings) MarshalJSON() ([]byte, error) {
+	b := []byte{'['}
+	for i := range c.Values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		var err error
+		if b, err = c.AppendJSON(b, i); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, ']'), nil
+}
+
+func (c *Strings) UnmarshalJSON(data []byte) error {
+	var p []*string
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*c = *StringsFromPtrs(p)
+	return nil
+}
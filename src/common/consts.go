@@ -17,14 +17,21 @@ limitations under the License.
 package common
 
 const (
-	SrcPath    = "/src/v1/"    // PUT, POST
-	SrcsPath   = "/srcs/v1"    // GET
-	RecordPath = "/record/v1/" // GET, DELETE
-	DirPath    = "/dir/v1/"    // GET
-	SearchPath = "/search"     // GET
-	VizPath    = "/v"          // GET
+	SrcPath      = "/src/v1/"     // PUT, POST
+	SrcsPath     = "/srcs/v1"     // GET
+	RecordPath   = "/record/v1/"  // GET, DELETE
+	DirPath      = "/dir/v1/"     // GET
+	SearchPath   = "/search"      // GET
+	ScanPath     = "/scan/v1"     // GET
+	AlertPath    = "/alert/v1/"   // GET, PUT, DELETE
+	TriagePath   = "/triage/v1/"  // GET, PUT
+	CulpritPath  = "/culprit/v1"  // GET
+	BacktestPath = "/backtest/v1" // GET
+	VizPath      = "/v"           // GET
 
-	TimeName          = "_Time"
-	RecordNumName     = "_RecordNum"
-	RegressNamePrefix = "REGRESSION_"
+	TimeName           = "_Time"
+	RecordNumName      = "_RecordNum"
+	GroupName          = "_Group"
+	RegressNamePrefix  = "REGRESSION_"
+	SeasonalNamePrefix = "SEASONAL_"
 )
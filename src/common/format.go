@@ -0,0 +1,45 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// HumanTimeLayout is used for human-readable timestamps in text output.
+	// Times are always UTC.
+	HumanTimeLayout = "2006-01-02 15:04:05.000"
+)
+
+// FormatFloatPtr returns the shortest representation of *f, or "" if f is nil.
+func FormatFloatPtr(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'g', -1, 64)
+}
+
+// FormatMillis formats epoch milliseconds as a number, or as a UTC time using
+// HumanTimeLayout if human is set.
+func FormatMillis(millis int64, human bool) string {
+	if !human {
+		return strconv.FormatInt(millis, 10)
+	}
+	return time.Unix(millis/1000, (millis%1000)*1e6).UTC().Format(HumanTimeLayout)
+}
@@ -20,12 +20,47 @@ import (
 	"strings"
 )
 
+// GetMetricComponents splits a metric.aggregate column name.  Aggregate names
+// never contain ".", so metric names may.  A group suffix stays with the
+// metric: latency.p50[machine=a] splits into latency[machine=a] and p50.
 func GetMetricComponents(name string) (metric, aggregate string) {
+	name, suffix := SplitGroupSuffix(name)
 	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return name + suffix, ""
+	}
+	return name[:i] + suffix, name[i+1:]
+}
+
+// JoinMetricComponents is the reverse of GetMetricComponents.
+func JoinMetricComponents(metric, aggregate string) string {
+	metric, suffix := SplitGroupSuffix(metric)
+	return metric + "." + aggregate + suffix
+}
+
+// GroupSuffix returns the suffix naming the columns of records with configs
+// when grouping by keys, e.g. "[machine=a,branch=main]".  Missing keys have
+// empty values.
+func GroupSuffix(keys []string, configs map[string]string) string {
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + configs[k]
+	}
+	return "[" + strings.Join(pairs, ",") + "]"
+}
+
+// SplitGroupSuffix splits a column or metric name into its base name and group
+// suffix (see GroupSuffix), if any.  Names with a group suffix cannot otherwise
+// contain "[".
+func SplitGroupSuffix(name string) (base, suffix string) {
+	if !strings.HasSuffix(name, "]") {
+		return name, ""
+	}
+	i := strings.Index(name, "[")
 	if i < 0 {
 		return name, ""
 	}
-	return name[:i], name[i+1:]
+	return name[:i], name[i:]
 }
 
 func GetSrcComponents(src string) (path, file string) {
@@ -39,3 +39,12 @@ func PrependFloatPtrSlice(a *[]*float64, element *float64) *[]*float64 {
 	ReverseFloatPtrSlice(*a)
 	return a
 }
+
+func StringInSlice(s string, a []string) bool {
+	for _, element := range a {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
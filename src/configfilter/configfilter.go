@@ -0,0 +1,192 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configfilter selects records by their config key/value pairs.
+//
+// A Filter is a conjunction of Clauses and a Clause a disjunction of Terms, so
+// (branch=main | branch=release) AND threads>=8 is:
+//
+//	Filter{
+//		Clause{branchMain, branchRelease},
+//		Clause{threadsGE8}}
+//
+// See srcparse for the text syntax.
+package configfilter
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+)
+
+type Op int
+
+const (
+	Eq            Op = iota // Value equals.
+	Ne                      // Value not equal, or key missing.
+	RegexMatch              // Value contains a match of the regular expression.
+	RegexNotMatch           // Value does not contain a match, or key missing.
+	Gt                      // Numeric value greater than.
+	Ge                      // Numeric value greater than or equal.
+	Lt                      // Numeric value less than.
+	Le                      // Numeric value less than or equal.
+	Exists                  // Key present with any value.
+)
+
+var opStrings = []string{"=", "!=", "=~", "!~", ">", ">=", "<", "<=", "?"}
+
+func (o Op) String() string {
+	if (o < 0) || (int(o) >= len(opStrings)) {
+		return "Op(" + strconv.Itoa(int(o)) + ")"
+	}
+	return opStrings[o]
+}
+
+func (o Op) numeric() bool {
+	return (o == Gt) || (o == Ge) || (o == Lt) || (o == Le)
+}
+
+// Term compares the value of a single config key.  Terms should be made with
+// NewTerm; others are checked on each match.
+type Term struct {
+	Key   string
+	Op    Op
+	Value string // Unused for Exists.
+
+	compiled bool
+	re       *regexp.Regexp
+	num      float64
+}
+
+// NewTerm returns a Term, checking that value is a valid regular expression or
+// number when op needs one.
+func NewTerm(key string, op Op, value string) (Term, error) {
+	t := Term{Key: key, Op: op, Value: value}
+	err := t.compile()
+	return t, err
+}
+
+func (t Term) String() string {
+	if t.Op == Exists {
+		return t.Key + t.Op.String()
+	}
+	return t.Key + t.Op.String() + t.Value
+}
+
+// Equal returns true if t and u have the same key, operator and value.
+func (t Term) Equal(u Term) bool {
+	return (t.Key == u.Key) && (t.Op == u.Op) && (t.Value == u.Value)
+}
+
+// Match returns true if configs pass the term.  Values which are not numbers
+// never pass numeric comparisons.
+func (t Term) Match(configs map[string]string) bool {
+	if !t.compiled && (t.compile() != nil) {
+		return false
+	}
+	v, ok := configs[t.Key]
+	switch t.Op {
+	case Eq:
+		return ok && (v == t.Value)
+	case Ne:
+		return !ok || (v != t.Value)
+	case RegexMatch:
+		return ok && t.re.MatchString(v)
+	case RegexNotMatch:
+		return !ok || !t.re.MatchString(v)
+	case Exists:
+		return ok
+	}
+	if !ok {
+		return false
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+	switch t.Op {
+	case Gt:
+		return f > t.num
+	case Ge:
+		return f >= t.num
+	case Lt:
+		return f < t.num
+	case Le:
+		return f <= t.num
+	}
+	return false
+}
+
+// compile fills in the regular expression or number needed by the operator.
+func (t *Term) compile() (err error) {
+	switch {
+	case (t.Op == RegexMatch) || (t.Op == RegexNotMatch):
+		if t.re, err = regexp.Compile(t.Value); err != nil {
+			return errors.New("Bad regular expression for config " + t.Key + ": " + err.Error())
+		}
+	case t.Op.numeric():
+		if t.num, err = strconv.ParseFloat(t.Value, 64); err != nil {
+			return errors.New("Numeric comparison for config " + t.Key + " needs a number: " + t.Value)
+		}
+	case (t.Op < 0) || (t.Op > Exists):
+		return errors.New("Unknown config operator: " + t.Op.String())
+	}
+	t.compiled = true
+	return nil
+}
+
+// Clause matches if any of its Terms match.
+type Clause []Term
+
+func (c Clause) Match(configs map[string]string) bool {
+	for _, t := range c {
+		if t.Match(configs) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter matches if all of its Clauses match.  An empty Filter matches all
+// configs.
+type Filter []Clause
+
+func (f Filter) Match(configs map[string]string) bool {
+	for _, c := range f {
+		if !c.Match(configs) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if f and g have equal Terms in the same order.
+func (f Filter) Equal(g Filter) bool {
+	if len(f) != len(g) {
+		return false
+	}
+	for i := range f {
+		if len(f[i]) != len(g[i]) {
+			return false
+		}
+		for j := range f[i] {
+			if !f[i][j].Equal(g[i][j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configfilter
+
+import (
+	"testing"
+)
+
+func mustTerm(key string, op Op, value string) Term {
+	t, err := NewTerm(key, op, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+type matchCase struct {
+	term    Term
+	configs map[string]string
+	want    bool
+}
+
+var matchCases = []matchCase{
+	matchCase{mustTerm("k", Eq, "v"), map[string]string{"k": "v"}, true},
+	matchCase{mustTerm("k", Eq, "v"), map[string]string{"k": "w"}, false},
+	matchCase{mustTerm("k", Eq, "v"), nil, false},
+	matchCase{mustTerm("k", Ne, "v"), map[string]string{"k": "w"}, true},
+	matchCase{mustTerm("k", Ne, "v"), map[string]string{"k": "v"}, false},
+	matchCase{mustTerm("k", Ne, "v"), nil, true},
+	matchCase{mustTerm("k", RegexMatch, "^rel"), map[string]string{"k": "release"}, true},
+	matchCase{mustTerm("k", RegexMatch, "^rel"), map[string]string{"k": "prerelease"}, false},
+	matchCase{mustTerm("k", RegexMatch, "rel"), nil, false},
+	matchCase{mustTerm("k", RegexNotMatch, "^rel"), map[string]string{"k": "prerelease"}, true},
+	matchCase{mustTerm("k", RegexNotMatch, "^rel"), nil, true},
+	matchCase{mustTerm("k", Gt, "8"), map[string]string{"k": "16"}, true},
+	matchCase{mustTerm("k", Gt, "8"), map[string]string{"k": "8"}, false},
+	matchCase{mustTerm("k", Ge, "8"), map[string]string{"k": "8.0"}, true},
+	matchCase{mustTerm("k", Lt, "8"), map[string]string{"k": "-1e3"}, true},
+	matchCase{mustTerm("k", Le, "8"), map[string]string{"k": "9"}, false},
+	matchCase{mustTerm("k", Lt, "8"), map[string]string{"k": "seven"}, false},
+	matchCase{mustTerm("k", Lt, "8"), nil, false},
+	matchCase{mustTerm("k", Exists, ""), map[string]string{"k": ""}, true},
+	matchCase{mustTerm("k", Exists, ""), map[string]string{"j": "v"}, false},
+	matchCase{Term{Key: "k", Op: Gt, Value: "8"}, map[string]string{"k": "9"}, true}, // Not from NewTerm.
+}
+
+func TestTermMatch(t *testing.T) {
+	for i, tc := range matchCases {
+		if got := tc.term.Match(tc.configs); got != tc.want {
+			t.Errorf("TC:%d %v on %v got: %v want: %v", i, tc.term, tc.configs, got, tc.want)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	// (branch=main | branch=~^release) AND threads>=8
+	f := Filter{
+		Clause{mustTerm("branch", Eq, "main"), mustTerm("branch", RegexMatch, "^release")},
+		Clause{mustTerm("threads", Ge, "8")}}
+	cases := []struct {
+		configs map[string]string
+		want    bool
+	}{
+		{map[string]string{"branch": "main", "threads": "8"}, true},
+		{map[string]string{"branch": "release-1", "threads": "16"}, true},
+		{map[string]string{"branch": "dev", "threads": "16"}, false},
+		{map[string]string{"branch": "main", "threads": "4"}, false},
+		{map[string]string{"branch": "main"}, false},
+	}
+	for i, tc := range cases {
+		if got := f.Match(tc.configs); got != tc.want {
+			t.Errorf("TC:%d %v got: %v want: %v", i, tc.configs, got, tc.want)
+		}
+	}
+	if !(Filter{}).Match(nil) {
+		t.Errorf("Empty filter should match.")
+	}
+}
+
+func TestNewTermErrors(t *testing.T) {
+	if _, err := NewTerm("k", RegexMatch, "("); err == nil {
+		t.Errorf("Expected error for bad regular expression.")
+	}
+	if _, err := NewTerm("k", Ge, "eight"); err == nil {
+		t.Errorf("Expected error for non-numeric value.")
+	}
+}
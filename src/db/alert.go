@@ -0,0 +1,28 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+// AlertRule is a saved range read with regression detection, evaluated
+// periodically with notifications of new regressions (see package alert).
+type AlertRule struct {
+	Name     string   `json:"name"`
+	Src      string   `json:"src"`             // As the src parameter of a range read.
+	Query    string   `json:"query,omitempty"` // Other range read parameters, e.g. "regressPos=5&daysOfData=7".
+	Every    string   `json:"every"`           // Evaluation interval, e.g. "1h" or "1d".
+	Webhooks []string `json:"webhooks,omitempty"`
+	Emails   []string `json:"emails,omitempty"`
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"errors"
+	"strings"
+)
+
+// ApplyAliases renames the data columns read from each source in fSrcs which
+// has an alias.  A source with a single column gets the alias as its name.
+// Otherwise the alias replaces the source in merged column names of the form
+// "source:metric.aggregate", and prefixes "metric.aggregate" when there was
+// only one source.  Regression columns computed afterwards use the new names,
+// as do RegressionDefaults.  Unaliased records the old names.
+func (d *DataTable) ApplyAliases(fSrcs []FilteredSource) error {
+	merged := len(fSrcs) > 1
+	aliasSources := make(map[string]string)
+	for _, fSrc := range fSrcs {
+		if fSrc.Alias == "" {
+			continue
+		}
+		if src, ok := aliasSources[fSrc.Alias]; ok && (src != fSrc.Source) {
+			return errors.New("Alias names more than one source: " + fSrc.Alias)
+		}
+		aliasSources[fSrc.Alias] = fSrc.Source
+
+		prefix := fSrc.Source + ":"
+		var idx []int
+		for i := 1; i < len(d.ColumnNames); i++ { // Skip X column.
+			name := d.ColumnNames[i]
+			if isNonData(name) || (merged && !strings.HasPrefix(name, prefix)) {
+				continue
+			}
+			idx = append(idx, i)
+		}
+		for _, i := range idx {
+			oldName := d.ColumnNames[i]
+			switch {
+			case len(idx) == 1:
+				d.ColumnNames[i] = fSrc.Alias
+			case merged:
+				d.ColumnNames[i] = fSrc.Alias + ":" + oldName[len(prefix):]
+			default:
+				d.ColumnNames[i] = fSrc.Alias + ":" + oldName
+			}
+			if d.Unaliased == nil {
+				d.Unaliased = make(map[string]string)
+			}
+			d.Unaliased[d.ColumnNames[i]] = oldName
+			if o, ok := d.RegressionDefaults[oldName]; ok {
+				delete(d.RegressionDefaults, oldName)
+				d.RegressionDefaults[d.ColumnNames[i]] = o
+			}
+		}
+	}
+	return nil
+}
+
+// columnOrigin returns the source in fSrcs a data column was read from, or ""
+// if unknown, and its metric.aggregate (see TriageColumn), undoing ApplyAliases.
+func (d *DataTable) columnOrigin(name string, fSrcs []FilteredSource) (source, metric string) {
+	if oldName, ok := d.Unaliased[name]; ok {
+		name = oldName
+	}
+	return columnSource(name, fSrcs), TriageColumn(name)
+}
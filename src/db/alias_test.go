@@ -0,0 +1,52 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyAliases(t *testing.T) {
+	d := &DataTable{ColumnNames: []string{"_Time", "a/b:lat.p50", "a/b:lat.p90", "c:lat.p50", "d:ops.sum"}}
+	fSrcs := []FilteredSource{
+		{Source: "a/b", Alias: "write"},
+		{Source: "c", Alias: "read p50"},
+		{Source: "d"},
+	}
+	if err := d.ApplyAliases(fSrcs); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"_Time", "write:lat.p50", "write:lat.p90", "read p50", "d:ops.sum"}
+	if !reflect.DeepEqual(d.ColumnNames, want) {
+		t.Errorf("got: %v want: %v", d.ColumnNames, want)
+	}
+
+	d = &DataTable{ColumnNames: []string{"_Time", "lat.p50", "lat.p90"}}
+	if err := d.ApplyAliases(fSrcs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"_Time", "write:lat.p50", "write:lat.p90"}
+	if !reflect.DeepEqual(d.ColumnNames, want) {
+		t.Errorf("single source got: %v want: %v", d.ColumnNames, want)
+	}
+
+	fSrcs[1].Alias = "write"
+	if err := d.ApplyAliases(fSrcs); err == nil {
+		t.Error("Expected error for alias of two sources.")
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"errors"
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/common"
+	"math"
+	"sort"
+)
+
+// Reducers for BucketRows.
+const (
+	BucketLast = "last" // Latest value.
+	BucketMean = "mean"
+	BucketMin  = "min"
+	BucketMax  = "max"
+)
+
+var BucketReducers = map[string]bool{
+	BucketLast: true,
+	BucketMean: true,
+	BucketMin:  true,
+	BucketMax:  true,
+}
+
+// BucketRows replaces the rows of d, whose X-axis is time, with one row per
+// bucketMillis interval containing any rows.  Each column is reduced
+// separately over the values present in the bucket, and X is the start of the
+// bucket.  Ids and configs are those of the latest row in the bucket.  Rows
+// are in ascending X order.
+func (d *DataTable) BucketRows(bucketMillis int64, reducer string) error {
+	if bucketMillis <= 0 {
+		return errors.New("Bucket size must be > 0.")
+	}
+	if !BucketReducers[reducer] {
+		return errors.New("Unknown bucket reducer: " + reducer)
+	}
+	if len(d.Data) == 0 {
+		return nil
+	}
+	x := d.Data[0]
+	haveIds := len(d.IdColumn) == x.Len()
+
+	buckets := make(map[int64][]int) // Map from bucket start to row indices.
+	var starts []int64
+	for i := 0; i < x.Len(); i++ {
+		v, ok := x.Get(i)
+		if !ok {
+			continue
+		}
+		xi := int64(v)
+		start := xi - xi%bucketMillis
+		if xi < 0 && (xi%bucketMillis != 0) {
+			start -= bucketMillis
+		}
+		if _, ok := buckets[start]; !ok {
+			starts = append(starts, start)
+		}
+		buckets[start] = append(buckets[start], i)
+	}
+	sort.Sort(common.Int64Slice(starts))
+
+	data := make(Columns, len(d.Data))
+	for j := range data {
+		data[j] = column.NewFloats(len(starts))
+	}
+	latestRows := make([]int, len(starts))
+	for b, start := range starts {
+		rowIdxs := buckets[start]
+		latest := rowIdxs[0]
+		for _, i := range rowIdxs[1:] {
+			if x.Values[i] > x.Values[latest] {
+				latest = i
+			}
+		}
+		latestRows[b] = latest
+
+		data[0].Set(b, float64(start))
+		for j := 1; j < len(d.Data); j++ {
+			if v, ok := reduceColumn(d.Data[j], x, rowIdxs, reducer); ok {
+				data[j].Set(b, v)
+			}
+		}
+	}
+
+	if haveIds {
+		ids := make([]string, len(latestRows))
+		for b, i := range latestRows {
+			ids[b] = d.IdColumn[i]
+		}
+		d.IdColumn = ids
+	}
+	for j, c := range d.Configs {
+		d.Configs[j] = c.Take(latestRows)
+	}
+	d.Data = data
+	return nil
+}
+
+// reduceColumn returns rows rowIdxs of c reduced with reducer, and false if
+// there are no values.
+func reduceColumn(c, x *column.Floats, rowIdxs []int, reducer string) (float64, bool) {
+	var result, latestX float64
+	var count int
+	for _, i := range rowIdxs {
+		v, ok := c.Get(i)
+		if !ok {
+			continue
+		}
+		xi := x.Values[i]
+		switch {
+		case count == 0:
+			result = v
+			latestX = xi
+		case reducer == BucketLast:
+			if xi > latestX {
+				result = v
+				latestX = xi
+			}
+		case reducer == BucketMean:
+			result += v
+		case reducer == BucketMin:
+			result = math.Min(result, v)
+		case reducer == BucketMax:
+			result = math.Max(result, v)
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, false
+	}
+	if reducer == BucketMean {
+		result /= float64(count)
+	}
+	return result, true
+}
+
+type nearestRow struct {
+	x         float64
+	row       int // Result row.
+	count     int // Number of tables joined.
+	lastTable int // Last table (plus one) joined.
+}
+
+type nearestRows []*nearestRow
+
+func (p nearestRows) Len() int           { return len(p) }
+func (p nearestRows) Less(i, j int) bool { return p[i].x < p[j].x }
+func (p nearestRows) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// MergeDataTablesNearest returns a single DataTable from multiple ones whose
+// X-axis is time, joining each row to the row with the nearest X value within
+// toleranceMillis.  Tables are joined in order: a row joins the nearest
+// unjoined row from earlier tables (the earlier on a tie), or else starts a new
+// row.  A joined row's X value is from the first table.  If
+// inner is set only rows joined from every table are kept.  Rows are in
+// ascending X order and columns are not in any defined order.
+func MergeDataTablesNearest(dTables []*DataTable, srcs []string, toleranceMillis int64,
+	inner, returnIds, returnConfigs bool) (resultTable *DataTable) {
+	m := newTableMerger(returnIds, returnConfigs)
+	tolerance := float64(toleranceMillis)
+
+	var rows nearestRows // Ascending X order.
+
+	for i, dTable := range dTables {
+		var newRows nearestRows
+		xs := dTable.xColumn()
+		for rowIdx := 0; rowIdx < xs.Len(); rowIdx++ {
+			x, ok := xs.Get(rowIdx)
+			if !ok {
+				continue
+			}
+
+			// Find nearest unjoined row on each side within tolerance.
+			var best *nearestRow
+			k := sort.Search(len(rows), func(n int) bool { return rows[n].x >= x })
+			for l := k - 1; (l >= 0) && (x-rows[l].x <= tolerance); l-- {
+				if rows[l].lastTable != i+1 {
+					best = rows[l]
+					break
+				}
+			}
+			for r := k; (r < len(rows)) && (rows[r].x-x <= tolerance); r++ {
+				if rows[r].lastTable != i+1 {
+					if (best == nil) || (rows[r].x-x < x-best.x) {
+						best = rows[r]
+					}
+					break
+				}
+			}
+
+			if best == nil {
+				best = &nearestRow{x: x, row: m.newRow()}
+				newRows = append(newRows, best)
+			}
+			best.count++
+			best.lastTable = i + 1
+			m.addRow(best.row, dTable, srcs[i], rowIdx)
+		}
+		rows = append(rows, newRows...)
+		sort.Sort(rows)
+	}
+
+	var resultRows []int
+	for _, r := range rows {
+		if inner && (r.count != len(dTables)) {
+			continue
+		}
+		resultRows = append(resultRows, r.row)
+	}
+	return m.finish(resultRows)
+}
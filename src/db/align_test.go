@@ -0,0 +1,109 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/davecgh/go-spew/spew"
+	"github.com/google/tsviewdb/src/common"
+	"reflect"
+	"testing"
+)
+
+func makeBucketTable() *DataTable {
+	d := NewDataTableFromRows([]string{common.TimeName, "a.max", "b.max"},
+		[]*[]*float64{ // Read order, descending time.
+			floatRow(f(250), f(5), nil),
+			floatRow(f(120), f(4), f(40)),
+			floatRow(f(110), f(3)), // Short row.
+			floatRow(f(100), f(2), f(20)),
+			floatRow(f(-5), f(1), nil),
+		})
+	d.IdColumn = []string{"i250", "i120", "i110", "i100", "i-5"}
+	return d
+}
+
+func TestBucketRows(t *testing.T) {
+	tests := []struct {
+		reducer string
+		want    []*[]*float64
+	}{
+		{BucketLast, []*[]*float64{
+			floatRow(f(-100), f(1), nil),
+			floatRow(f(100), f(4), f(40)),
+			floatRow(f(200), f(5), nil)}},
+		{BucketMean, []*[]*float64{
+			floatRow(f(-100), f(1), nil),
+			floatRow(f(100), f(3), f(30)),
+			floatRow(f(200), f(5), nil)}},
+		{BucketMin, []*[]*float64{
+			floatRow(f(-100), f(1), nil),
+			floatRow(f(100), f(2), f(20)),
+			floatRow(f(200), f(5), nil)}},
+		{BucketMax, []*[]*float64{
+			floatRow(f(-100), f(1), nil),
+			floatRow(f(100), f(4), f(40)),
+			floatRow(f(200), f(5), nil)}},
+	}
+	for _, tc := range tests {
+		d := makeBucketTable()
+		if err := d.BucketRows(100, tc.reducer); err != nil {
+			t.Fatal(err)
+		}
+		if got := d.Rows(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s got: %s\nwant: %s\n", tc.reducer, spew.Sdump(got), spew.Sdump(tc.want))
+		}
+		if want := []string{"i-5", "i120", "i250"}; !reflect.DeepEqual(d.IdColumn, want) {
+			t.Errorf("%s got ids: %v want: %v", tc.reducer, d.IdColumn, want)
+		}
+	}
+
+	if err := makeBucketTable().BucketRows(100, "median"); err == nil {
+		t.Errorf("Expected error for unknown reducer.")
+	}
+}
+
+func TestMergeDataTablesNearest(t *testing.T) {
+	dTables := []*DataTable{
+		NewDataTableFromRows([]string{common.TimeName, "m"},
+			[]*[]*float64{floatRow(f(1000), f(1)), floatRow(f(2000), f(2))}),
+		NewDataTableFromRows([]string{common.TimeName, "m"},
+			[]*[]*float64{
+				floatRow(f(1003), f(10)),
+				floatRow(f(1004), f(11)), // Nearest already joined.
+				floatRow(f(1995), f(20)),
+				floatRow(f(5000), f(50))}), // Too far.
+	}
+	got := MergeDataTablesNearest(dTables, []string{"s1", "s2"}, 10, false, false, false)
+	got.SortDataColumns()
+	wantRows := []*[]*float64{
+		floatRow(f(1000), f(1), f(10)),
+		floatRow(f(1004), nil, f(11)),
+		floatRow(f(2000), f(2), f(20)),
+		floatRow(f(5000), nil, f(50)),
+	}
+	want := NewDataTableFromRows([]string{common.TimeName, "s1:m", "s2:m"}, wantRows)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %s\nwant: %s\n", spew.Sdump(got), spew.Sdump(want))
+	}
+
+	got = MergeDataTablesNearest(dTables, []string{"s1", "s2"}, 10, true, false, false)
+	got.SortDataColumns()
+	want = NewDataTableFromRows(want.ColumnNames, []*[]*float64{wantRows[0], wantRows[2]})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("inner got: %s\nwant: %s\n", spew.Sdump(got), spew.Sdump(want))
+	}
+}
@@ -18,6 +18,7 @@ package db
 
 import (
 	"errors"
+	"github.com/google/tsviewdb/src/column"
 	"github.com/google/tsviewdb/src/common"
 	"sort"
 )
@@ -74,75 +75,6 @@ func (p *parallelStringsFloatTable) addRecordNumColumn() {
 	}
 }
 
-// addColumn adds a column to the left-most row.
-func (p *parallelStringsFloatTable) addColumn(colName string, col []*float64) {
-	*p.names = append(*p.names, colName)
-	for i := range p.data {
-		*p.data[i] = append(*p.data[i], col[i])
-	}
-}
-
-// copyColumnToX copies the given column name to the 0 position and returns the
-// original in an array.  This is used for changing the X axis to an arbitrary
-// column and returning the original X axis as an array.
-func (p *parallelStringsFloatTable) copyColumnToX(colIdx int, newColName string,
-	savedX *[]*float64) {
-	*savedX = make([]*float64, len(p.data))
-
-	(*p.names)[0] = newColName
-	for i := range p.data {
-		(*savedX)[i] = (*p.data[i])[0]
-		(*p.data[i])[0] = (*p.data[i])[colIdx]
-	}
-}
-
-func deleteFloatPtrSliceItem(a []*float64, i int) []*float64 {
-	copy(a[i:], a[i+1:])
-	a[len(a)-1] = nil
-	return a[:len(a)-1]
-}
-
-func deleteStrSliceItem(a []string, i int) []string {
-	copy(a[i:], a[i+1:])
-	a[len(a)-1] = ""
-	return a[:len(a)-1]
-}
-
-func (p *parallelStringsFloatTable) deleteColumnbyIdx(colIdx int) {
-	*p.names = deleteStrSliceItem(*p.names, colIdx)
-	for i := range p.data {
-		*p.data[i] = deleteFloatPtrSliceItem(*p.data[i], colIdx)
-	}
-}
-
-func (p *parallelStringsFloatTable) deleteColumn(colName string) error {
-	// Find which column contains colName.
-	var idx int
-	lenNames := len(*p.names)
-	for ; idx < lenNames; idx++ {
-		if (*p.names)[idx] == colName {
-			break
-		}
-	}
-	if idx == lenNames {
-		return errors.New("Non-existent column name for deleteColumn: " + colName)
-	}
-
-	p.deleteColumnbyIdx(idx)
-	return nil
-}
-
-func (p *parallelStringsFloatTable) FixRowLengths() {
-	requiredLength := len(*p.names)
-	for _, row := range p.data {
-		if len(*row) != requiredLength {
-			newRow := make([]*float64, requiredLength)
-			copy(newRow, *row)
-			*row = newRow // Free old row
-		}
-	}
-}
-
 func (p *parallelStringsFloatTable) SortDataColumns() {
 	var ps positionString
 	ps.Init(p.names)
@@ -152,68 +84,51 @@ func (p *parallelStringsFloatTable) SortDataColumns() {
 
 /////////////////////////////////////////////////////////////////////////////
 
-type parallelStringsStringTable struct {
-	names []string
-	data  []*[]*string
-}
-
-func (p *parallelStringsStringTable) FixRowLengths() {
-	requiredLength := len(p.names)
-	for _, row := range p.data {
-		if len(*row) != requiredLength {
-			newRow := make([]*string, requiredLength)
-			copy(newRow, *row)
-			*row = newRow // Free old row
-		}
-	}
-}
+// rowSort sorts rows by a column, in increasing order with nulls first.
+type rowSort []rowKey
 
-func (p *parallelStringsStringTable) SortDataColumns() {
-	var ps positionString
-	ps.Init(&p.names)
-	sort.Sort(&ps)
-	ps.TemplateSortString(p.data)
+type rowKey struct {
+	val   float64
+	valid bool
+	row   int
 }
 
-/////////////////////////////////////////////////////////////////////////////
-
-// tableSort attaches the methods of sort.Interface to []*[]*float64, sorting in
-// increasing order by the first column.
-type tableSort struct {
-	v         []*[]*float64
-	extraSwap func(i, j int) // Additional swap function.
-	sortIdx   int
+func newRowSort(keys *column.Floats, numRows int) rowSort {
+	r := make(rowSort, numRows)
+	for i := range r {
+		r[i].val, r[i].valid = keys.Get(i)
+		r[i].row = i
+	}
+	return r
 }
 
-func (d tableSort) Len() int { return len(d.v) }
-func (d tableSort) Less(i, j int) bool {
-	di := d.v[i]
-	dj := d.v[j]
-	if di == nil {
+func (r rowSort) Len() int      { return len(r) }
+func (r rowSort) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r rowSort) Less(i, j int) bool {
+	if !r[i].valid {
 		return true
 	}
-	if dj == nil {
+	if !r[j].valid {
 		return false
 	}
-	di0 := (*di)[d.sortIdx]
-	dj0 := (*dj)[d.sortIdx]
-	if di0 == nil {
-		return true
-	}
-	if dj0 == nil {
-		return false
-	}
-	return *di0 < *dj0
-}
-func (d tableSort) Swap(i, j int) {
-	d.v[i], d.v[j] = d.v[j], d.v[i]
-	d.extraSwap(i, j)
+	return r[i].val < r[j].val
 }
 
-func (d tableSort) ReverseRows() {
-	for i, j := 0, len(d.v)-1; i < j; i, j = i+1, j-1 {
-		d.Swap(i, j)
+// order returns the sorted row indices, or nil if rows are in order.
+func (r rowSort) order() []int {
+	var order []int
+	for i, k := range r {
+		if (k.row != i) && (order == nil) {
+			order = make([]int, len(r))
+			for j := 0; j < i; j++ {
+				order[j] = j
+			}
+		}
+		if order != nil {
+			order[i] = k.row
+		}
 	}
+	return order
 }
 
 /////////////////////////////////////////////////////////////////////////////
@@ -246,18 +161,28 @@ func (p *positionString) TemplateSortFloat(data []*[]*float64) {
 	}
 }
 
-func (p *positionString) TemplateSortString(data []*[]*string) {
-	tmpRow := make([]*string, len(*p.strings))
-	for _, row := range data {
-		// To avoid garbage, first copy to reused tmpRow putting in correct position.
-		for i := 0; i < len(*row); i++ {
-			tmpRow[i] = (*row)[p.positions[i]]
-		}
-		// Now copy back to original.
-		for columnNum, value := range tmpRow {
-			(*row)[columnNum] = value
-		}
+// reorderFloats returns columns in the sorted order of the strings.
+func (p *positionString) reorderFloats(columns Columns) Columns {
+	if columns == nil {
+		return nil
+	}
+	result := make(Columns, len(columns))
+	for i, pos := range p.positions {
+		result[i] = columns[pos]
+	}
+	return result
+}
+
+// reorderStrings returns columns in the sorted order of the strings.
+func (p *positionString) reorderStrings(columns ConfigColumns) ConfigColumns {
+	if columns == nil {
+		return nil
+	}
+	result := make(ConfigColumns, len(columns))
+	for i, pos := range p.positions {
+		result[i] = columns[pos]
 	}
+	return result
 }
 
 func (p *positionString) Len() int {
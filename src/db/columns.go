@@ -0,0 +1,234 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"github.com/google/tsviewdb/src/column"
+)
+
+// Columns are the data columns of a DataTable.  They are encoded to JSON by
+// row, as arrays of values with null for missing values.
+type Columns []*column.Floats
+
+func (c Columns) numRows() int {
+	if len(c) == 0 {
+		return 0
+	}
+	return c[0].Len()
+}
+
+func (c Columns) MarshalJSON() ([]byte, error) {
+	numRows := c.numRows()
+	b := append(make([]byte, 0, numRows*(len(c)*8+2)+2), '[')
+	for i := 0; i < numRows; i++ {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '[')
+		for j, col := range c {
+			if j > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = col.AppendJSON(b, i); err != nil {
+				return nil, err
+			}
+		}
+		b = append(b, ']')
+	}
+	return append(b, ']'), nil
+}
+
+// ConfigColumns are the config columns of a DataTable.  They are encoded to
+// JSON by row, as arrays of values with null for missing values.
+type ConfigColumns []*column.Strings
+
+func (c ConfigColumns) numRows() int {
+	if len(c) == 0 {
+		return 0
+	}
+	return c[0].Len()
+}
+
+func (c ConfigColumns) MarshalJSON() ([]byte, error) {
+	numRows := c.numRows()
+	b := []byte{'['}
+	for i := 0; i < numRows; i++ {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '[')
+		for j, col := range c {
+			if j > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = col.AppendJSON(b, i); err != nil {
+				return nil, err
+			}
+		}
+		b = append(b, ']')
+	}
+	return append(b, ']'), nil
+}
+
+// rowsDataTable is the JSON form of a DataTable, for decoding.
+type rowsDataTable struct {
+	ColumnNames        []string            `json:"aggregatesColumnNames"`
+	Data               []*[]*float64       `json:"aggregates"`
+	IdColumn           []string            `json:"ids"`
+	ConfigsColumnNames []string            `json:"configsColumnNames"`
+	Configs            []*[]*string        `json:"configs"`
+	Timestamps         []*float64          `json:"timestamps"`
+	Sources            []string            `json:"sources"`
+	Regressions        []RegressionSegment `json:"regressions"`
+}
+
+// AppendJSON appends d to b as a JSON object with data and configs by row.
+// Empty fields are omitted.  Unlike MarshalJSON, the result is not copied and
+// validated by encoding/json, which matters for large tables.
+func (d *DataTable) AppendJSON(b []byte) ([]byte, error) {
+	start := len(b)
+	b = append(b, '{')
+	var err error
+	add := func(name string, empty bool, v json.Marshaler) {
+		if empty || (err != nil) {
+			return
+		}
+		var data []byte
+		if data, err = v.MarshalJSON(); err != nil {
+			return
+		}
+		if len(b) > start+1 {
+			b = append(b, ',')
+		}
+		b = append(append(append(b, '"'), name...), `":`...)
+		b = append(b, data...)
+	}
+	add("aggregatesColumnNames", len(d.ColumnNames) == 0, stringsMarshaler(d.ColumnNames))
+	add("aggregates", d.Data.numRows() == 0, d.Data)
+	add("ids", len(d.IdColumn) == 0, stringsMarshaler(d.IdColumn))
+	add("configsColumnNames", len(d.ConfigsColumnNames) == 0, stringsMarshaler(d.ConfigsColumnNames))
+	add("configs", d.Configs.numRows() == 0, d.Configs)
+	add("timestamps", (d.Timestamps == nil) || (d.Timestamps.Len() == 0), d.Timestamps)
+	add("sources", len(d.Sources) == 0, stringsMarshaler(d.Sources))
+	add("regressions", len(d.Regressions) == 0, regressionsMarshaler(d.Regressions))
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '}'), nil
+}
+
+// stringsMarshaler encodes a string slice as usual.
+type stringsMarshaler []string
+
+func (s stringsMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string(s))
+}
+
+type regressionsMarshaler []RegressionSegment
+
+func (r regressionsMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]RegressionSegment(r))
+}
+
+func (d *DataTable) MarshalJSON() ([]byte, error) {
+	return d.AppendJSON(nil)
+}
+
+func (d *DataTable) UnmarshalJSON(data []byte) error {
+	var r rowsDataTable
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	*d = *NewDataTableFromRows(r.ColumnNames, r.Data)
+	d.IdColumn = r.IdColumn
+	d.SetConfigRows(r.ConfigsColumnNames, r.Configs)
+	if r.Timestamps != nil {
+		d.Timestamps = column.FloatsFromPtrs(r.Timestamps)
+	}
+	d.Sources = r.Sources
+	d.Regressions = r.Regressions
+	return nil
+}
+
+// NewDataTableFromRows returns a DataTable with rows of data by column.  Rows
+// may be nil or shorter than columnNames, with missing values null.
+func NewDataTableFromRows(columnNames []string, rows []*[]*float64) *DataTable {
+	d := &DataTable{ColumnNames: columnNames}
+	for i := 0; i < len(columnNames); i++ {
+		d.Data = append(d.Data, column.NewFloats(len(rows)))
+	}
+	for i, row := range rows {
+		if row == nil {
+			continue
+		}
+		for j, val := range *row {
+			if j < len(d.Data) {
+				d.Data[j].SetPtr(i, val)
+			}
+		}
+	}
+	return d
+}
+
+// SetConfigRows replaces the configs of d with rows of configs by column.
+// Rows may be nil or shorter than columnNames, with missing values null.
+func (d *DataTable) SetConfigRows(columnNames []string, rows []*[]*string) {
+	d.ConfigsColumnNames = columnNames
+	d.Configs = nil
+	for i := 0; i < len(columnNames); i++ {
+		d.Configs = append(d.Configs, column.NewStrings(len(rows)))
+	}
+	for i, row := range rows {
+		if row == nil {
+			continue
+		}
+		for j, val := range *row {
+			if j < len(d.Configs) {
+				d.Configs[j].SetPtr(i, val)
+			}
+		}
+	}
+}
+
+// Rows returns the data of d by row.
+func (d *DataTable) Rows() []*[]*float64 {
+	rows := make([]*[]*float64, d.Data.numRows())
+	for i := range rows {
+		row := make([]*float64, len(d.Data))
+		for j, c := range d.Data {
+			row[j] = c.Ptr(i)
+		}
+		rows[i] = &row
+	}
+	return rows
+}
+
+// ConfigRows returns the configs of d by row.
+func (d *DataTable) ConfigRows() []*[]*string {
+	rows := make([]*[]*string, d.Configs.numRows())
+	for i := range rows {
+		row := make([]*string, len(d.Configs))
+		for j, c := range d.Configs {
+			row[j] = c.Ptr(i)
+		}
+		rows[i] = &row
+	}
+	return rows
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/expr"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// rowDataTable is the row-based DataTable replaced by columns, kept to check
+// the JSON encoding and for comparison in benchmarks.
+type rowDataTable struct {
+	ColumnNames        []string      `json:"aggregatesColumnNames,omitempty"`
+	Data               []*[]*float64 `json:"aggregates,omitempty"`
+	IdColumn           []string      `json:"ids,omitempty"`
+	ConfigsColumnNames []string      `json:"configsColumnNames,omitempty"`
+	Configs            []*[]*string  `json:"configs,omitempty"`
+	Timestamps         []*float64    `json:"timestamps,omitempty"`
+	Sources            []string      `json:"sources,omitempty"`
+}
+
+func makeRowDataTable() *rowDataTable {
+	return &rowDataTable{
+		ColumnNames: []string{common.TimeName, "m.max", "m.min"},
+		Data: []*[]*float64{
+			floatRow(f(300), f(3.5), nil),
+			floatRow(f(100), nil, f(-1e-9)),
+			floatRow(f(200), f(2), f(1e21)),
+		},
+		IdColumn:           []string{"i300", "i100", "i200"},
+		ConfigsColumnNames: []string{"k"},
+		Configs:            []*[]*string{stringRow(s("<a>")), stringRow(nil), stringRow(s("b"))},
+		Timestamps:         []*float64{f(1), nil, f(3)},
+		Sources:            []string{"s"},
+	}
+}
+
+func (r *rowDataTable) dataTable() *DataTable {
+	d := rowTable(r.ColumnNames, r.Data, r.ConfigsColumnNames, r.Configs)
+	d.IdColumn = r.IdColumn
+	if r.Timestamps != nil {
+		d.Timestamps = column.FloatsFromPtrs(r.Timestamps)
+	}
+	d.Sources = r.Sources
+	return d
+}
+
+func TestDataTableJSON(t *testing.T) {
+	for _, r := range []*rowDataTable{makeRowDataTable(), &rowDataTable{}} {
+		want, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := r.dataTable()
+		got, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("got: %s\nwant: %s", got, want)
+		}
+
+		decoded := new(DataTable)
+		if err := json.Unmarshal(got, decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, d) {
+			t.Errorf("decoded: %s\nwant: %s", spew.Sdump(decoded), spew.Sdump(d))
+		}
+	}
+}
+
+func TestSortRows(t *testing.T) {
+	d := makeRowDataTable().dataTable()
+	d.SortRows(0)
+	want := &rowDataTable{
+		ColumnNames: []string{common.TimeName, "m.max", "m.min"},
+		Data: []*[]*float64{
+			floatRow(f(100), nil, f(-1e-9)),
+			floatRow(f(200), f(2), f(1e21)),
+			floatRow(f(300), f(3.5), nil),
+		},
+		IdColumn:           []string{"i100", "i200", "i300"},
+		ConfigsColumnNames: []string{"k"},
+		Configs:            []*[]*string{stringRow(nil), stringRow(s("b")), stringRow(s("<a>"))},
+		Timestamps:         []*float64{nil, f(3), f(1)},
+		Sources:            []string{"s"},
+	}
+	if !reflect.DeepEqual(d, want.dataTable()) {
+		t.Errorf("got: %s\nwant: %s", spew.Sdump(d.Rows()), spew.Sdump(want.Data))
+	}
+
+	d.ReverseRows()
+	if got := d.IdColumn; !reflect.DeepEqual(got, []string{"i300", "i200", "i100"}) {
+		t.Errorf("reversed ids: %v", got)
+	}
+}
+
+func TestChangeXAxis(t *testing.T) {
+	d := makeRowDataTable().dataTable()
+	d.Timestamps = nil
+	if err := d.ChangeXAxisToColumnFromTime("m.max"); err != nil {
+		t.Fatal(err)
+	}
+	want := []*float64{f(300), f(100), f(200)}
+	if got := d.Timestamps.Ptrs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("timestamps got: %s want: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+	want = []*float64{f(3.5), nil, f(2)}
+	if got := d.Data[0].Ptrs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("X got: %s want: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+
+	if err := d.ChangeXAxisToConfigColumn("k", false); err != nil {
+		t.Fatal(err)
+	}
+	want = []*float64{f(0), nil, f(0)} // Unparsable configs are 0.
+	if got := d.Data[0].Ptrs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("config X got: %s want: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestAddExprColumn(t *testing.T) {
+	d := makeRowDataTable().dataTable()
+	e, err := expr.Parse("spread = m.max - m.min")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddExprColumn(e); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.ColumnNames[len(d.ColumnNames)-1], "spread"; got != want {
+		t.Errorf("name got: %s want: %s", got, want)
+	}
+	want := []*float64{nil, nil, f(2 - 1e21)}
+	if got := d.Data[len(d.Data)-1].Ptrs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("spread got: %s want: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+	if err := d.AddExprColumn(e); err == nil {
+		t.Error("Expected error for duplicate column name.")
+	}
+	if e, err = expr.Parse("m.mean * 2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddExprColumn(e); err == nil {
+		t.Error("Expected error for unknown column.")
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Row-based and columnar tables compared, for 100k rows of 10 columns.
+
+const benchRows, benchColumns = 100000, 10
+
+func benchColumnNames() []string {
+	names := []string{common.TimeName}
+	for j := 1; j < benchColumns; j++ {
+		names = append(names, "m"+string('a'+rune(j))+".mean")
+	}
+	return names
+}
+
+// benchValue returns the value of a cell.  Column 1 is shuffled relative to
+// X, and every seventh cell of other columns is missing.
+func benchValue(i, j int) (float64, bool) {
+	switch j {
+	case 0:
+		return float64(benchRows - i), true
+	case 1:
+		return float64((i * 7919) % benchRows), true
+	}
+	return float64(i * j), (i*j)%7 != 0
+}
+
+func makeRowBenchTable() *rowDataTable {
+	r := &rowDataTable{ColumnNames: benchColumnNames()}
+	for i := 0; i < benchRows; i++ {
+		row := make([]*float64, benchColumns)
+		for j := range row {
+			if v, ok := benchValue(i, j); ok {
+				row[j] = &v
+			}
+		}
+		r.Data = append(r.Data, &row)
+	}
+	return r
+}
+
+func makeColumnBenchTable() *DataTable {
+	d := &DataTable{}
+	for _, name := range benchColumnNames() {
+		d.AddColumn(name)
+	}
+	for i := 0; i < benchRows; i++ {
+		row := d.AppendRow()
+		for j, c := range d.Data {
+			if v, ok := benchValue(i, j); ok {
+				c.Set(row, v)
+			}
+		}
+	}
+	return d
+}
+
+type rowSortByColumn struct {
+	rows []*[]*float64
+	col  int
+}
+
+func (r rowSortByColumn) Len() int      { return len(r.rows) }
+func (r rowSortByColumn) Swap(i, j int) { r.rows[i], r.rows[j] = r.rows[j], r.rows[i] }
+func (r rowSortByColumn) Less(i, j int) bool {
+	vi, vj := (*r.rows[i])[r.col], (*r.rows[j])[r.col]
+	if vi == nil {
+		return true
+	}
+	if vj == nil {
+		return false
+	}
+	return *vi < *vj
+}
+
+func BenchmarkBuildRowTable(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		makeRowBenchTable()
+	}
+}
+
+func BenchmarkBuildColumnTable(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		makeColumnBenchTable()
+	}
+}
+
+func BenchmarkSortRowTable(b *testing.B) {
+	r := makeRowBenchTable()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sort.Sort(rowSortByColumn{r.Data, 1})
+		sort.Sort(rowSortByColumn{r.Data, 0})
+	}
+}
+
+func BenchmarkSortColumnTable(b *testing.B) {
+	d := makeColumnBenchTable()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.SortRows(1)
+		d.SortRows(0)
+	}
+}
+
+func BenchmarkJSONRowTable(b *testing.B) {
+	r := makeRowBenchTable()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONColumnTable(b *testing.B) {
+	d := makeColumnBenchTable()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.AppendJSON(nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"errors"
+)
+
+// CulpritRange returns the rows bounding a regression in column col of d,
+// sorted by time: lastGood, the last row with a value before the regression,
+// and firstBad, the first row with a value in it.  The regression starts after
+// the row with id startId if set (see RegressionSegment.Start), otherwise at
+// timestamp.
+func (d *DataTable) CulpritRange(col int, startId string, timestamp int64) (lastGood, firstBad int, err error) {
+	c := d.Data[col]
+	lastGood, firstBad = -1, -1
+	if startId != "" {
+		if len(d.IdColumn) != d.NumRows() {
+			return -1, -1, errors.New("No ids read.")
+		}
+		for row, id := range d.IdColumn {
+			if id == startId {
+				lastGood = row
+				break
+			}
+		}
+		if lastGood < 0 {
+			return -1, -1, errors.New("Unknown startId: " + startId)
+		}
+		for row := lastGood + 1; row < c.Len(); row++ {
+			if !c.IsNull(row) {
+				firstBad = row
+				break
+			}
+		}
+	} else {
+		for row := 0; row < c.Len(); row++ {
+			t, _ := d.Data[0].Get(row)
+			if c.IsNull(row) {
+				continue
+			}
+			if int64(t) < timestamp {
+				lastGood = row
+			} else {
+				firstBad = row
+				break
+			}
+		}
+	}
+
+	switch {
+	case lastGood < 0:
+		return -1, -1, errors.New("No record before the regression.")
+	case firstBad < 0:
+		return -1, -1, errors.New("No record after the regression start.")
+	}
+	return lastGood, firstBad, nil
+}
+
+// DistinctConfigValues returns the distinct values of config key in the rows
+// after row from up to row to, in row order.
+func (d *DataTable) DistinctConfigValues(key string, from, to int) []string {
+	k, err := d.IndexForConfigName(key)
+	if err != nil {
+		return nil
+	}
+	var values []string
+	seen := make(map[string]bool)
+	for row := from + 1; row <= to; row++ {
+		if v, ok := d.Configs[k].Get(row); ok && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
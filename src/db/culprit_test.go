@@ -0,0 +1,70 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/google/tsviewdb/src/common"
+	"reflect"
+	"testing"
+)
+
+func TestCulpritRange(t *testing.T) {
+	d := rowTable([]string{common.TimeName, "lat"}, []*[]*float64{
+		floatRow(f(100), f(10)),
+		floatRow(f(200), f(10)),
+		floatRow(f(300), nil), // Metric not recorded.
+		floatRow(f(400), f(15)),
+		floatRow(f(500), f(15)),
+	}, []string{"commit"}, []*[]*string{
+		stringRow(s("a")),
+		stringRow(s("b")),
+		stringRow(s("c")),
+		stringRow(s("d")),
+		stringRow(s("d")),
+	})
+	d.IdColumn = []string{"r1", "r2", "r3", "r4", "r5"}
+
+	for _, test := range []struct {
+		startId   string
+		timestamp int64
+	}{
+		{startId: "r2"},
+		{timestamp: 250},
+		{timestamp: 400},
+	} {
+		good, bad, err := d.CulpritRange(1, test.startId, test.timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (good != 1) || (bad != 3) {
+			t.Errorf("%+v: got rows %d to %d, want 1 to 3", test, good, bad)
+		}
+	}
+	if got, want := d.DistinctConfigValues("commit", 1, 3), []string{"c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got values %v, want %v", got, want)
+	}
+
+	if _, _, err := d.CulpritRange(1, "", 100); err == nil {
+		t.Error("Expected error without a record before.")
+	}
+	if _, _, err := d.CulpritRange(1, "r5", 0); err == nil {
+		t.Error("Expected error without a record after.")
+	}
+	if _, _, err := d.CulpritRange(1, "r9", 0); err == nil {
+		t.Error("Expected error for unknown id.")
+	}
+}
@@ -17,8 +17,13 @@ limitations under the License.
 package db
 
 import (
+	"errors"
+	"github.com/google/tsviewdb/src/column"
 	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/configfilter"
+	"github.com/google/tsviewdb/src/expr"
 	"github.com/google/tsviewdb/src/regress"
+	"github.com/google/tsviewdb/src/transform"
 	"sort"
 	"strconv"
 	"strings"
@@ -27,9 +32,12 @@ import (
 // src:metric.aggregate$key1=value1$key2=value2 decomposes into below.
 type FilteredSource struct {
 	Source           string
+	Pattern          bool // Source is a pattern to expand (see srcparse.Match).
 	MetricsFilter    map[string]bool
 	AggregatesFilter map[string]bool
-	ConfigsFilter    map[string]string // Setting key only will separate into different configs.
+	ConfigsFilter    configfilter.Filter // Records must match; nil for all.
+	GroupByConfigs   []string            // Split columns by these config values.
+	Alias            string              // Replaces the source in column names.
 }
 
 type Qualifier struct {
@@ -47,6 +55,17 @@ type Qualifier struct {
 	ReturnIds          bool
 	ReturnConfigs      bool
 	NoReturnAggregates bool
+
+	// Multiple sources are merged on X values unless JoinOnConfig is set, when
+	// they are merged on values of that config key.
+	JoinOnConfig string
+	InnerJoin    bool // Only keep rows found in every source.
+
+	// Sources are bucketed by time before merging if BucketMillis is set, or
+	// merged on nearest X values within NearestMillis if that is set.
+	BucketMillis  int64
+	BucketReducer string
+	NearestMillis int64
 }
 
 type RowRangeRequests struct {
@@ -54,37 +73,104 @@ type RowRangeRequests struct {
 	Qualifier
 }
 
+// DataTable is stored by column.  Every data and config column has one value,
+// possibly null, per row.  It is encoded to JSON by row (see AppendJSON).
 type DataTable struct {
-	ColumnNames        []string      `json:"aggregatesColumnNames,omitempty"`
-	Data               []*[]*float64 `json:"aggregates,omitempty"`
-	IdColumn           []string      `json:"ids,omitempty"`
-	ConfigsColumnNames []string      `json:"configsColumnNames,omitempty"`
-	Configs            []*[]*string  `json:"configs,omitempty"`
-	Timestamps         []*float64    `json:"timestamps,omitempty"`
+	ColumnNames        []string
+	Data               Columns // Data[0] is the X-axis.
+	IdColumn           []string
+	ConfigsColumnNames []string
+	Configs            ConfigColumns
+	Timestamps         *column.Floats      // Set when the X-axis is no longer time.
+	Sources            []string            // Set when source patterns were expanded.
+	Regressions        []RegressionSegment // Set for regress.FormatSegments.
+
+	// By column name, for regress.RegressionParams.UseDefaults.
+	RegressionDefaults map[string]*regress.Override
+
+	// Data column names before ApplyAliases, by new name.
+	Unaliased map[string]string
+}
+
+// NumRows returns the number of rows, which is the length of any column.
+func (d *DataTable) NumRows() int {
+	switch {
+	case len(d.Data) > 0:
+		return d.Data[0].Len()
+	case len(d.Configs) > 0:
+		return d.Configs[0].Len()
+	}
+	return len(d.IdColumn)
+}
+
+// AddColumn adds a data column of nulls and returns it.
+func (d *DataTable) AddColumn(colName string) *column.Floats {
+	c := column.NewFloats(d.NumRows())
+	d.ColumnNames = append(d.ColumnNames, colName)
+	d.Data = append(d.Data, c)
+	return c
+}
+
+// AddConfigColumn adds a config column of nulls and returns it.
+func (d *DataTable) AddConfigColumn(colName string) *column.Strings {
+	c := column.NewStrings(d.NumRows())
+	d.ConfigsColumnNames = append(d.ConfigsColumnNames, colName)
+	d.Configs = append(d.Configs, c)
+	return c
+}
+
+// AppendRow adds a row of nulls to every data and config column and returns
+// its index.  Ids are not changed.
+func (d *DataTable) AppendRow() int {
+	row := d.NumRows()
+	for _, c := range d.Data {
+		c.AppendNull()
+	}
+	for _, c := range d.Configs {
+		c.AppendNull()
+	}
+	return row
+}
+
+// selectRows replaces the rows of d with rows idx of d, in order.
+func (d *DataTable) selectRows(idx []int) {
+	numRows := d.NumRows()
+	for i, c := range d.Data {
+		d.Data[i] = c.Take(idx)
+	}
+	for i, c := range d.Configs {
+		d.Configs[i] = c.Take(idx)
+	}
+	if (d.IdColumn != nil) && (len(d.IdColumn) == numRows) {
+		ids := make([]string, len(idx))
+		for i, j := range idx {
+			ids[i] = d.IdColumn[j]
+		}
+		d.IdColumn = ids
+	}
+	if (d.Timestamps != nil) && (d.Timestamps.Len() == numRows) {
+		d.Timestamps = d.Timestamps.Take(idx)
+	}
 }
 
 func (d *DataTable) SortDataColumns() {
-	p := parallelStringsFloatTable{names: &d.ColumnNames, data: d.Data}
-	p.FixRowLengths()
-	p.SortDataColumns()
+	var ps positionString
+	ps.Init(&d.ColumnNames)
+	sort.Sort(&ps)
+	d.Data = ps.reorderFloats(d.Data)
 }
 
 func (d *DataTable) OverwriteXAxisWithRecordNum() {
 	d.ColumnNames[0] = common.RecordNumName
-	for i, _ := range d.Data {
-		fi := float64(i)
-		(*d.Data[i])[0] = &fi
+	x := d.Data[0]
+	for i := 0; i < x.Len(); i++ {
+		x.Set(i, float64(i))
 	}
 }
 
 func (d *DataTable) ChangeXAxisToRecordNumFromTime() {
-	d.Timestamps = make([]*float64, len(d.Data))
-	d.ColumnNames[0] = common.RecordNumName
-	for i, _ := range d.Data {
-		fi := float64(i)
-		d.Timestamps[i] = (*d.Data[i])[0]
-		(*d.Data[i])[0] = &fi
-	}
+	d.Timestamps = d.Data[0].Clone()
+	d.OverwriteXAxisWithRecordNum()
 }
 
 func (d *DataTable) ChangeXAxisToColumnFromTime(colName string) error {
@@ -92,9 +178,9 @@ func (d *DataTable) ChangeXAxisToColumnFromTime(colName string) error {
 	if err != nil {
 		return err
 	}
-	p := parallelStringsFloatTable{names: &d.ColumnNames, data: d.Data}
-	d.Timestamps = make([]*float64, len(d.Data))
-	p.copyColumnToX(colIdx, colName, &d.Timestamps)
+	d.Timestamps = d.Data[0]
+	d.ColumnNames[0] = colName
+	d.Data[0] = d.Data[colIdx].Clone()
 	return nil
 }
 
@@ -105,70 +191,109 @@ func (d *DataTable) ChangeXAxisToConfigColumn(colName string, fromTime bool) err
 	}
 	d.ColumnNames[0] = colName
 	if fromTime {
-		d.Timestamps = make([]*float64, len(d.Data))
+		d.Timestamps = d.Data[0].Clone() // Copy timestamps out.
 	}
 
-	for i, _ := range d.Data {
-		if fromTime {
-			d.Timestamps[i] = (*d.Data[i])[0] // Copy timestamps out.
-		}
-		configsRow := d.Configs[i]
-		if configsRow == nil {
-			continue
-		}
-		sPtr := (*configsRow)[colIdx]
-		if sPtr == nil {
+	x := d.Data[0]
+	configs := d.Configs[colIdx]
+	for i := 0; i < x.Len(); i++ {
+		s, ok := configs.Get(i)
+		if !ok {
 			continue
 		}
-		f, _ := strconv.ParseFloat(*sPtr, 64) // Swallow errors.
-		(*d.Data[i])[0] = &f
+		f, _ := strconv.ParseFloat(s, 64) // Swallow errors.
+		x.Set(i, f)
 	}
 	return nil
 }
 
 func (d *DataTable) DeleteColumn(colName string) error {
-	p := parallelStringsFloatTable{names: &d.ColumnNames, data: d.Data}
-	return p.deleteColumn(colName)
+	colIdx, err := d.IndexForName(colName)
+	if err != nil {
+		return errors.New("Non-existent column name for deleteColumn: " + colName)
+	}
+	d.ColumnNames = append(d.ColumnNames[:colIdx], d.ColumnNames[colIdx+1:]...)
+	d.Data = append(d.Data[:colIdx], d.Data[colIdx+1:]...)
+	return nil
 }
 
-func isNonData(name string) bool {
-	return (name == common.TimeName) || (name == common.RecordNumName) ||
-		(strings.Index(name, common.RegressNamePrefix) == 0)
+// AddExprColumn appends a column named e.Name holding e evaluated over the
+// data columns.
+func (d *DataTable) AddExprColumn(e *expr.Expr) error {
+	if _, err := d.IndexForName(e.Name); err == nil {
+		return errors.New("Expression column name already exists: " + e.Name)
+	}
+	lookup := func(name string) *column.Floats {
+		if i, err := d.IndexForName(name); err == nil {
+			return d.Data[i]
+		}
+		return nil
+	}
+	result, err := e.Eval(lookup, d.NumRows())
+	if err != nil {
+		return err
+	}
+	d.ColumnNames = append(d.ColumnNames, e.Name)
+	d.Data = append(d.Data, result)
+	return nil
 }
 
-func (d *DataTable) GetVerifiedRegression(rParams regress.RegressionParams) {
-	p := parallelStringsFloatTable{names: &d.ColumnNames, data: d.Data}
-
-	t := regress.NewTable(d.Data)
-	for i := range d.ColumnNames {
-		if isNonData(d.ColumnNames[i]) { // Don't compute regressions over known non-data columns.
+// Transform applies p to each data column in place.  Rates use the saved
+// timestamps if the X-axis is no longer time.  With regressSegments, regression
+// columns hold the values of their data columns on regression rows (see
+// regress.RegressionParams.ReturnSegments) and get the transformed values, so
+// they stay on the transformed lines.
+func (d *DataTable) Transform(p transform.Pipeline, regressSegments bool) {
+	if len(p) == 0 || len(d.Data) == 0 {
+		return
+	}
+	x := d.Data[0]
+	if d.Timestamps != nil {
+		x = d.Timestamps
+	}
+	for i := 1; i < len(d.Data); i++ {
+		if isNonData(d.ColumnNames[i]) {
 			continue
 		}
-		result := t.GetVerifiedRegression(i, rParams)
-		if result != nil {
-			p.addColumn(common.RegressNamePrefix+d.ColumnNames[i], result)
+		d.Data[i] = p.Apply(d.Data[i], x)
+	}
+	if !regressSegments {
+		return
+	}
+	for i := 1; i < len(d.Data); i++ {
+		name := d.ColumnNames[i]
+		if !strings.HasPrefix(name, common.RegressNamePrefix) {
+			continue
+		}
+		col, err := d.IndexForName(name[len(common.RegressNamePrefix):])
+		if err != nil {
+			continue
+		}
+		for row := 0; row < d.Data[i].Len(); row++ {
+			if !d.Data[i].IsNull(row) {
+				d.Data[i].SetPtr(row, d.Data[col].Ptr(row))
+			}
 		}
 	}
 }
 
+func isNonData(name string) bool {
+	return (name == common.TimeName) || (name == common.RecordNumName) ||
+		(strings.Index(name, common.RegressNamePrefix) == 0) ||
+		(strings.Index(name, common.SeasonalNamePrefix) == 0)
+}
+
+// GetVerifiedRegression adds a regression column for each data column with a
+// regression, or with regress.FormatSegments adds to Regressions instead.
+// Rows must be in ascending time order with time as the X-axis.
+func (d *DataTable) GetVerifiedRegression(rParams regress.RegressionParams) {
+	d.getRegression(rParams, nil) // Only significance tests fail.
+}
+
 var haveStableSort bool
 
 func (d *DataTable) baseSortRows(idx int, reverse bool, stable bool) {
-	ds := tableSort{
-		v: d.Data,
-		extraSwap: func(i, j int) {
-			if len(d.IdColumn) == len(d.Data) {
-				d.IdColumn[i], d.IdColumn[j] = d.IdColumn[j], d.IdColumn[i]
-			}
-			if len(d.Configs) == len(d.Data) {
-				d.Configs[i], d.Configs[j] = d.Configs[j], d.Configs[i]
-			}
-			if len(d.Timestamps) == len(d.Data) {
-				d.Timestamps[i], d.Timestamps[j] = d.Timestamps[j], d.Timestamps[i]
-			}
-		},
-		sortIdx: 0,
-	}
+	ds := newRowSort(d.Data[idx], d.NumRows())
 	var sortFunc func(sort.Interface)
 	if stable {
 		// TODO: uncomment once go1.2 is widely available.
@@ -183,21 +308,18 @@ func (d *DataTable) baseSortRows(idx int, reverse bool, stable bool) {
 	} else {
 		sortFunc(ds)
 	}
+	if order := ds.order(); order != nil {
+		d.selectRows(order)
+	}
 }
 
 func (d *DataTable) ReverseRows() {
-	ds := tableSort{
-		v: d.Data,
-		extraSwap: func(i, j int) {
-			if len(d.IdColumn) == len(d.Data) {
-				d.IdColumn[i], d.IdColumn[j] = d.IdColumn[j], d.IdColumn[i]
-			}
-			if len(d.Configs) == len(d.Data) {
-				d.Configs[i], d.Configs[j] = d.Configs[j], d.Configs[i]
-			}
-		},
+	numRows := d.NumRows()
+	order := make([]int, numRows)
+	for i := range order {
+		order[i] = numRows - 1 - i
 	}
-	ds.ReverseRows()
+	d.selectRows(order)
 }
 
 func (d *DataTable) IndexForName(colName string) (int, error) {
@@ -225,113 +347,8 @@ func (d *DataTable) ReverseSortRowsStable(colIdx int) {
 }
 
 func (d *DataTable) SortConfigsColumns() {
-	p := parallelStringsStringTable{names: d.ConfigsColumnNames, data: d.Configs}
-	p.FixRowLengths()
-	p.SortDataColumns()
-}
-
-type fullRow struct {
-	data    *[]*float64
-	configs *[]*string
-	id      string
-}
-
-// MergeDataTables returns a single DataTable from multiple ones.  Rows and
-// columns are not in any defined order.  To sort columns use: SortDataColumns()
-// To sort rows use: SortRows(colNum) or ReverseSortRows(colNum)
-func MergeDataTables(dTables []*DataTable, srcs []string, returnIds,
-	returnConfigs bool) (resultTable *DataTable) {
-	resultTable = &DataTable{}
-
-	rowMap := make(map[float64]*fullRow) // Map from X value to row.
-
-	// Map from name to data slot to write data in data row.
-	columnNameReverseMap := make(map[string]int)
-	configColumnNameReverseMap := make(map[string]int)
-
-	for i, dTable := range dTables {
-		src := srcs[i]
-		for rowIdx, rowp := range dTable.Data {
-			if rowp == nil {
-				continue
-			}
-			row := *rowp
-			xp := row[0]
-			if xp == nil {
-				continue
-			}
-			xVal := *xp
-
-			dtrow, ok := rowMap[xVal]
-			if !ok {
-				// Created at least as much space as we know we'll use.  Will be
-				// increased through the append function for following tables.
-				newDTRow := &fullRow{}
-				data := make([]*float64, len(resultTable.ColumnNames))
-				newDTRow.data = &data
-				configs := make([]*string, len(resultTable.ConfigsColumnNames))
-				newDTRow.configs = &configs
-				dtrow = newDTRow
-				rowMap[xVal] = dtrow
-			}
-
-			// Handle data.
-			for j, colName := range dTable.ColumnNames {
-				var columnName string
-				if colName == common.TimeName {
-					if (len(*(*dtrow).data) > 0) && ((*(*dtrow).data)[0] != nil) { // Don't write X column more than once.
-						continue
-					}
-					columnName = colName
-				} else {
-					columnName = strings.Join([]string{src, colName}, ":")
-				}
-
-				val := row[j]
-				if columnNameIndex, ok := columnNameReverseMap[columnName]; !ok { // Which slot to write data.
-					columnNameReverseMap[columnName] = len(resultTable.ColumnNames)
-					resultTable.ColumnNames = append(resultTable.ColumnNames, columnName)
-					*(*dtrow).data = append(*(*dtrow).data, val)
-				} else {
-					(*dtrow.data)[columnNameIndex] = val
-				}
-			}
-
-			// Handle Ids.
-			if returnIds {
-				(*dtrow).id = dTable.IdColumn[rowIdx]
-			}
-
-			// Handle configs.
-			if returnConfigs {
-				configRow := dTable.Configs[rowIdx]
-				if configRow == nil {
-					continue
-				}
-				for j, columnName := range dTable.ConfigsColumnNames {
-					val := (*configRow)[j]
-					if columnNameIndex, ok := configColumnNameReverseMap[columnName]; !ok { // Which slot to write data.
-						configColumnNameReverseMap[columnName] = len(resultTable.ConfigsColumnNames)
-						resultTable.ConfigsColumnNames = append(resultTable.ConfigsColumnNames, columnName)
-						*(*dtrow).configs = append(*(*dtrow).configs, val)
-					} else {
-						(*dtrow.configs)[columnNameIndex] = val
-					}
-				}
-			}
-
-		} // end row processing
-	} // end table processing
-
-	for _, row := range rowMap {
-		resultTable.Data = append(resultTable.Data, row.data)
-		if returnIds {
-			resultTable.IdColumn = append(resultTable.IdColumn, row.id)
-		}
-		if returnConfigs {
-			resultTable.Configs = append(resultTable.Configs, row.configs)
-		}
-	}
-
-	return
+	var ps positionString
+	ps.Init(&d.ConfigsColumnNames)
+	sort.Sort(&ps)
+	d.Configs = ps.reorderStrings(d.Configs)
 }
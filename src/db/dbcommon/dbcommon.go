@@ -24,6 +24,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/google/tsviewdb/src/db"
 	pb "github.com/google/tsviewdb/src/proto"
+	"github.com/google/tsviewdb/src/regress"
 	"io"
 )
 
@@ -54,6 +55,9 @@ const (
 	CFPoints     = "points"
 	CFConfigs    = "configs"
 	CFSource     = "source"
+	CFAlerts     = "alerts"
+	CFFired      = "firedalerts"
+	CFTriage     = "triage"
 )
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -129,7 +133,56 @@ func SerializeSourceInfoUncomp(si db.SourceInfoUncomp) []byte {
 
 	s.MetricNames = si.Names
 	s.SelectForDefaults = si.SelectForDefaults
+	if len(si.RegressionDefaults) > 0 {
+		s.RegressionDefaults = make([]*pb.RegressionDefaults, len(si.RegressionDefaults))
+		for i, o := range si.RegressionDefaults {
+			s.RegressionDefaults[i] = regressionDefaultsToProto(o)
+		}
+	}
 
 	data, _ := proto.Marshal(s)
 	return data
 }
+
+func regressionDefaultsToProto(o *regress.Override) *pb.RegressionDefaults {
+	d := &pb.RegressionDefaults{}
+	if o == nil {
+		return d
+	}
+	d.Pos = o.Pos
+	d.Neg = o.Neg
+	d.UsePercent = o.UsePercent
+	d.IgnoreLt = o.IgnoreLT
+	if o.Window != nil {
+		d.Window = proto.Int32(int32(*o.Window))
+	}
+	if o.Radius != nil {
+		d.Radius = proto.Int32(int32(*o.Radius))
+	}
+	if o.SeasonBins != nil {
+		d.SeasonBins = proto.Int32(int32(*o.SeasonBins))
+	}
+	return d
+}
+
+// RegressionDefaultsFromProto is the reverse of the conversion made by
+// SerializeSourceInfoUncomp.  An empty message is nil.
+func RegressionDefaultsFromProto(d *pb.RegressionDefaults) *regress.Override {
+	o := &regress.Override{Pos: d.Pos, Neg: d.Neg, UsePercent: d.UsePercent, IgnoreLT: d.IgnoreLt}
+	if d.Window != nil {
+		window := int(*d.Window)
+		o.Window = &window
+	}
+	if d.Radius != nil {
+		radius := int(*d.Radius)
+		o.Radius = &radius
+	}
+	if d.SeasonBins != nil {
+		seasonBins := int(*d.SeasonBins)
+		o.SeasonBins = &seasonBins
+	}
+	if *o == (regress.Override{}) {
+		return nil
+	}
+	return o
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/regress"
+	"strings"
+)
+
+// RegressionDefaultsLoader returns the regression defaults of the metrics of
+// source by metric name.
+type RegressionDefaultsLoader func(source string) (map[string]*regress.Override, error)
+
+// SetRegressionDefaults sets RegressionDefaults for each data column read from
+// fSrcs to the defaults of its metric, if any.  Call before ApplyAliases.
+func (d *DataTable) SetRegressionDefaults(fSrcs []FilteredSource, load RegressionDefaultsLoader) error {
+	defaults := make(map[string]map[string]*regress.Override) // By source.
+
+	for i := 1; i < len(d.ColumnNames); i++ { // Skip X column.
+		name := d.ColumnNames[i]
+		source := columnSource(name, fSrcs)
+		if isNonData(name) || (source == "") {
+			continue
+		}
+		bySource, ok := defaults[source]
+		if !ok {
+			var err error
+			if bySource, err = load(source); err != nil {
+				return err
+			}
+			defaults[source] = bySource
+		}
+
+		if len(fSrcs) > 1 { // Merged column.
+			name = name[strings.Index(name, ":")+1:]
+		}
+		metric, _ := common.GetMetricComponents(name)
+		metric, _ = common.SplitGroupSuffix(metric)
+		if o := bySource[metric]; o != nil {
+			if d.RegressionDefaults == nil {
+				d.RegressionDefaults = make(map[string]*regress.Override)
+			}
+			d.RegressionDefaults[d.ColumnNames[i]] = o
+		}
+	}
+	return nil
+}
+
+// columnRegressionParams returns rParams for column col: with UseDefaults, the
+// defaults of the column then the explicit parameters are applied.  It returns
+// false if the column then has neither a threshold nor a detector.
+func (d *DataTable) columnRegressionParams(col int, rParams regress.RegressionParams) (regress.RegressionParams, bool) {
+	if !rParams.UseDefaults {
+		return rParams, true
+	}
+	rParams = d.RegressionDefaults[d.ColumnNames[col]].Apply(rParams)
+	rParams = rParams.Explicit.Apply(rParams)
+	return rParams, (rParams.Pos != nil) || (rParams.Neg != nil) || (rParams.Algo != "")
+}
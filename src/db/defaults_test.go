@@ -0,0 +1,72 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/regress"
+	"reflect"
+	"testing"
+)
+
+func TestRegressionDefaults(t *testing.T) {
+	d := rowTable([]string{common.TimeName, "a/b:lat.mean", "a/b:qps.mean", "a/c:lat.mean"}, []*[]*float64{
+		floatRow(f(100), f(10), f(10), f(10)),
+		floatRow(f(200), f(10), f(10), f(10)),
+		floatRow(f(300), f(13), f(13), f(13)),
+		floatRow(f(400), f(13), f(13), f(13)),
+	}, nil, nil)
+	d.IdColumn = []string{"1", "2", "3", "4"}
+	fSrcs := []FilteredSource{{Source: "a/b", Alias: "b"}, {Source: "a/c"}}
+	two, four := 2.0, 4.0
+	load := func(source string) (map[string]*regress.Override, error) {
+		if source == "a/b" {
+			return map[string]*regress.Override{"lat": {Pos: &two}}, nil
+		}
+		return map[string]*regress.Override{"lat": {Pos: &four}}, nil
+	}
+	if err := d.SetRegressionDefaults(fSrcs, load); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ApplyAliases(fSrcs); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only b:lat.mean has a default threshold crossed; qps has none.
+	r := regress.RegressionParams{Selected: true, UseDefaults: true, Window: 1, Format: regress.FormatSegments}
+	d.GetVerifiedRegression(r)
+	var got []string
+	for _, seg := range d.Regressions {
+		got = append(got, seg.Column)
+	}
+	if want := []string{"b:lat.mean"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got regressions in %v, want %v", got, want)
+	}
+
+	// An explicit threshold applies to every column.
+	d.Regressions = nil
+	one := 1.0
+	r.Explicit.Pos = &one
+	d.GetVerifiedRegression(r)
+	got = nil
+	for _, seg := range d.Regressions {
+		got = append(got, seg.Column)
+	}
+	if want := []string{"b:lat.mean", "b:qps.mean", "a/c:lat.mean"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got regressions in %v, want %v", got, want)
+	}
+}
@@ -16,19 +16,27 @@ limitations under the License.
 
 package db
 
+import (
+	"github.com/google/tsviewdb/src/regress"
+)
+
 type DirectorySearchRequest struct {
-	Prefix                  string
-	FileRestrict            string
-	ReturnMetrics           bool
-	ReturnUnits             bool
-	ReturnSelectForDefaults bool
-	DefaultsOnly            bool
-	DirPrefixMatch          bool
-	FilePrefixMatch         bool
+	Prefix                   string
+	FileRestrict             string
+	ReturnMetrics            bool
+	ReturnUnits              bool
+	ReturnSelectForDefaults  bool
+	ReturnRegressionDefaults bool
+	DefaultsOnly             bool
+	DirPrefixMatch           bool
+	FilePrefixMatch          bool
 }
 
 type SourceInfoUncomp struct {
 	Names             []string `json:"names,omitempty"`
 	Units             []string `json:"units,omitempty"`
 	SelectForDefaults []bool   `json:"selectForDefaults,omitempty"`
+
+	// Parallel to Names when set, nil for metrics without.
+	RegressionDefaults []*regress.Override `json:"regressionDefaults,omitempty"`
 }
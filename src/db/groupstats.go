@@ -0,0 +1,146 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"errors"
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/common"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Statistics computed by GroupStats for each data column.
+const (
+	StatCount  = "count"
+	StatMean   = "mean"
+	StatStdev  = "stdev"
+	StatMin    = "min"
+	StatMax    = "max"
+	StatMedian = "median"
+)
+
+var groupStatNames = []string{StatCount, StatMean, StatStdev, StatMin, StatMax, StatMedian}
+
+// GroupStats returns a table with a row for each distinct combination of the
+// values of the config columns keys, which are the returned config columns.
+// For each data column "c" it has the columns "c.count", "c.mean", "c.stdev",
+// "c.min", "c.max" and "c.median" over the non-null values in the group.  The
+// X column is the group number, with groups ordered by key values and null
+// values first.  Rows without a key value form their own groups.  Stdev is the
+// sample standard deviation, null for fewer than two values.
+func (d *DataTable) GroupStats(keys []string) (*DataTable, error) {
+	keyColumns := make([]*column.Strings, len(keys))
+	for i, key := range keys {
+		idx, err := d.IndexForConfigName(key)
+		if err != nil {
+			return nil, errors.New("Non-existent config name for group statistics: " + key)
+		}
+		keyColumns[i] = d.Configs[idx]
+	}
+
+	groups := make(map[string][]int) // Rows by group key.
+	var groupKeys []string
+	for i := 0; i < d.NumRows(); i++ {
+		key := groupKey(keyColumns, i)
+		if _, ok := groups[key]; !ok {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+	sort.Strings(groupKeys)
+
+	result := &DataTable{Sources: d.Sources, Regressions: d.Regressions}
+	x := result.AddColumn(common.GroupName)
+	for _, key := range keys {
+		result.AddConfigColumn(key)
+	}
+	var dataColumns, statColumns []*column.Floats
+	for i := 1; i < len(d.Data); i++ { // Skip X column.
+		if isNonData(d.ColumnNames[i]) {
+			continue
+		}
+		dataColumns = append(dataColumns, d.Data[i])
+		for _, stat := range groupStatNames {
+			statColumns = append(statColumns, result.AddColumn(d.ColumnNames[i]+"."+stat))
+		}
+	}
+
+	var values []float64
+	for g, key := range groupKeys {
+		rows := groups[key]
+		row := result.AppendRow()
+		x.Set(row, float64(g))
+		for k, c := range keyColumns {
+			result.Configs[k].SetPtr(row, c.Ptr(rows[0]))
+		}
+		for j, c := range dataColumns {
+			values = values[:0]
+			for _, i := range rows {
+				if v, ok := c.Get(i); ok {
+					values = append(values, v)
+				}
+			}
+			setStats(statColumns[j*len(groupStatNames):], row, values)
+		}
+	}
+	return result, nil
+}
+
+// groupKey encodes the key values of row so that encoded keys sort like their
+// values, with null first.
+func groupKey(keyColumns []*column.Strings, row int) string {
+	parts := make([]string, len(keyColumns))
+	for i, c := range keyColumns {
+		if v, ok := c.Get(row); ok {
+			parts[i] = "\x01" + v
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// setStats sets row of the statistics columns, in groupStatNames order, from
+// values, which it sorts.
+func setStats(statColumns []*column.Floats, row int, values []float64) {
+	n := len(values)
+	statColumns[0].Set(row, float64(n))
+	if n == 0 {
+		return
+	}
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(n)
+	statColumns[1].Set(row, mean)
+	if n > 1 {
+		var sumSq float64
+		for _, v := range values {
+			sumSq += (v - mean) * (v - mean)
+		}
+		statColumns[2].Set(row, math.Sqrt(sumSq/float64(n-1)))
+	}
+	statColumns[3].Set(row, values[0])
+	statColumns[4].Set(row, values[n-1])
+	median := values[n/2]
+	if n%2 == 0 {
+		median = (values[n/2-1] + median) / 2
+	}
+	statColumns[5].Set(row, median)
+}
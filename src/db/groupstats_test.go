@@ -0,0 +1,69 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/davecgh/go-spew/spew"
+	"github.com/google/tsviewdb/src/common"
+	"reflect"
+	"testing"
+)
+
+func TestGroupStats(t *testing.T) {
+	d := rowTable([]string{common.TimeName, "lat", common.RegressNamePrefix + "lat"},
+		[]*[]*float64{
+			floatRow(f(1), f(5), f(0)),
+			floatRow(f(2), f(1), f(0)),
+			floatRow(f(3), f(3), f(0)),
+			floatRow(f(4), nil, f(0)),
+			floatRow(f(5), f(7), f(0)),
+			floatRow(f(6), f(8), f(0)),
+		},
+		[]string{"cc", "opt"},
+		[]*[]*string{
+			stringRow(s("gcc"), s("O2")),
+			stringRow(s("gcc"), s("O2")),
+			stringRow(s("gcc"), s("O2")),
+			stringRow(s("clang"), s("O2")),
+			stringRow(s("clang"), s("O3")),
+			stringRow(nil, s("O2")),
+		})
+	result, err := d.GroupStats([]string{"cc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNames := []string{common.GroupName, "lat.count", "lat.mean", "lat.stdev", "lat.min", "lat.max", "lat.median"}
+	if !reflect.DeepEqual(result.ColumnNames, wantNames) {
+		t.Errorf("names got: %v want: %v", result.ColumnNames, wantNames)
+	}
+	if got, want := result.Configs[0].Ptrs(), []*string{nil, s("clang"), s("gcc")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("groups got: %s want: %s", spew.Sdump(got), spew.Sdump(want))
+	}
+	want := rowTable(wantNames, []*[]*float64{
+		floatRow(f(0), f(1), f(8), nil, f(8), f(8), f(8)),
+		floatRow(f(1), f(1), f(7), nil, f(7), f(7), f(7)),
+		floatRow(f(2), f(3), f(3), f(2), f(1), f(5), f(3)),
+	}, nil, nil)
+	if !reflect.DeepEqual(result.Data, want.Data) {
+		t.Errorf("stats got: %s want: %s", spew.Sdump(result.Rows()), spew.Sdump(want.Rows()))
+	}
+
+	if _, err := d.GroupStats([]string{"missing"}); err == nil {
+		t.Error("Expected error for missing config.")
+	}
+}
@@ -21,8 +21,26 @@ type DB interface {
 	WriteRow(wRecord WriteRecord, src string) (rowKey string, err error)
 	ReadRow(req RowRequest) (returnVal *ReadRecord, err error)
 	ReadRows(req RowRangeRequests) (returnVal *DataTable, err error)
+	StreamRows(req RowRangeRequests, w RowWriter) (err error)
 	DeleteRow(rowKey string) (err error)
 	WriteDir(si SourceInfoUncomp, src string) (err error)
 	ReadDir(req DirectorySearchRequest) (result SourceInfoUncomp, err error)
 	DeleteDir(path, file string) (err error)
+	WriteAlertRule(rule AlertRule) (err error)
+	ReadAlertRules() (rules []AlertRule, err error)
+	DeleteAlertRule(name string) (err error)
+	ReadFiredAlerts(rule string) (fired map[string]int64, err error)
+	WriteFiredAlert(rule, key string, timestamp int64) (err error)
+	WriteTriage(t Triage) (err error)
+	ReadTriages(source string) (triages []Triage, err error)
+}
+
+// NoResultsError is returned by ReadRows when a source has no records in the
+// range read.
+type NoResultsError struct {
+	Source string
+}
+
+func (e *NoResultsError) Error() string {
+	return "No results for: " + e.Source
 }
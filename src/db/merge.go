@@ -0,0 +1,314 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/common"
+	"math"
+	"strings"
+)
+
+// MergeDataTables returns a single DataTable from multiple ones, joining rows
+// with equal X values.  If inner is set only X values found in every table are
+// kept.  Tables are expected in read order (descending X); others are sorted
+// first.
+//
+// Rows are in descending X order.  Columns are X followed by the data columns
+// of each table in order, named "src:column", and config columns are in order
+// of first appearance.  Rows of one table with equal X values are combined,
+// with later values overwriting earlier ones.  Rows without X are dropped.  A
+// row's id is from the last table with the row.
+func MergeDataTables(dTables []*DataTable, srcs []string, inner, returnIds,
+	returnConfigs bool) (resultTable *DataTable) {
+	resultTable = &DataTable{}
+	x := resultTable.AddColumn(common.TimeName)
+
+	// Map each table's columns to result columns.
+	offsets := make([]int, len(dTables)) // Result index of table column 0.
+	configIndices := make([][]int, len(dTables))
+	configColumnNameReverseMap := make(map[string]int)
+	xs := make([]*column.Floats, len(dTables))
+	for i, dTable := range dTables {
+		if !isDescendingX(dTable.xColumn()) {
+			dTable.ReverseSortRows(0)
+		}
+		xs[i] = dTable.xColumn()
+		offsets[i] = len(resultTable.ColumnNames) - 1
+		if len(dTable.ColumnNames) > 1 {
+			for _, colName := range dTable.ColumnNames[1:] {
+				resultTable.AddColumn(strings.Join([]string{srcs[i], colName}, ":"))
+			}
+		}
+		if !returnConfigs {
+			continue
+		}
+		configIndices[i] = make([]int, len(dTable.ConfigsColumnNames))
+		for j, columnName := range dTable.ConfigsColumnNames {
+			columnNameIndex, ok := configColumnNameReverseMap[columnName]
+			if !ok {
+				columnNameIndex = len(resultTable.ConfigsColumnNames)
+				configColumnNameReverseMap[columnName] = columnNameIndex
+				resultTable.AddConfigColumn(columnName)
+			}
+			configIndices[i][j] = columnNameIndex
+		}
+	}
+
+	// Merge the heads of each table.  The number of tables is small, so they
+	// are scanned rather than kept in a heap.
+	positions := make([]int, len(dTables))
+	for {
+		var xVal float64
+		haveX := false
+		for i := range dTables {
+			positions[i] = nextXRow(xs[i], positions[i])
+			if positions[i] < xs[i].Len() {
+				if v, _ := xs[i].Get(positions[i]); !haveX || (v > xVal) {
+					xVal = v
+					haveX = true
+				}
+			}
+		}
+		if !haveX {
+			break
+		}
+
+		row := resultTable.AppendRow()
+		x.Set(row, xVal)
+		var id string
+		var numTables int
+		for i, dTable := range dTables {
+			found := false
+			for ; positions[i] < xs[i].Len(); positions[i] = nextXRow(xs[i], positions[i]+1) {
+				pos := positions[i]
+				if v, _ := xs[i].Get(pos); v != xVal {
+					break
+				}
+				found = true
+				for j := 1; j < len(dTable.Data); j++ {
+					if v, ok := dTable.Data[j].Get(pos); ok {
+						resultTable.Data[offsets[i]+j].Set(row, v)
+					}
+				}
+				if returnIds && (pos < len(dTable.IdColumn)) {
+					id = dTable.IdColumn[pos]
+				}
+				if returnConfigs {
+					for j, c := range dTable.Configs {
+						if v, ok := c.Get(pos); ok && (j < len(configIndices[i])) {
+							resultTable.Configs[configIndices[i][j]].Set(row, v)
+						}
+					}
+				}
+			}
+			if found {
+				numTables++
+			}
+		}
+
+		if inner && (numTables != len(dTables)) {
+			resultTable.truncateRows(row)
+			continue
+		}
+		if returnIds {
+			resultTable.IdColumn = append(resultTable.IdColumn, id)
+		}
+	}
+
+	return resultTable
+}
+
+// xColumn returns the X column of d, which is empty if d has no data.
+func (d *DataTable) xColumn() *column.Floats {
+	if len(d.Data) == 0 {
+		return column.NewFloats(0)
+	}
+	return d.Data[0]
+}
+
+// truncateRows removes data and config rows from n on.
+func (d *DataTable) truncateRows(n int) {
+	for _, c := range d.Data {
+		c.Resize(n)
+	}
+	for _, c := range d.Configs {
+		c.Resize(n)
+	}
+}
+
+// nextXRow returns the index of the first row from i on with an X value.
+func nextXRow(x *column.Floats, i int) int {
+	for ; i < x.Len(); i++ {
+		if v, ok := x.Get(i); ok && !math.IsNaN(v) {
+			break
+		}
+	}
+	return i
+}
+
+// isDescendingX returns true if rows with X values are in descending X order.
+func isDescendingX(x *column.Floats) bool {
+	var previous float64
+	for i, n := nextXRow(x, 0), 0; i < x.Len(); i, n = nextXRow(x, i+1), n+1 {
+		v, _ := x.Get(i)
+		if (n > 0) && (v > previous) {
+			return false
+		}
+		previous = v
+	}
+	return true
+}
+
+// tableMerger accumulates rows from multiple DataTables into one, prefixing
+// data column names with their source.  Used for merges which are not on X.
+type tableMerger struct {
+	result        *DataTable
+	returnIds     bool
+	returnConfigs bool
+
+	// Map from name to result column.
+	columnNameReverseMap       map[string]int
+	configColumnNameReverseMap map[string]int
+}
+
+func newTableMerger(returnIds, returnConfigs bool) *tableMerger {
+	m := &tableMerger{
+		result:                     &DataTable{},
+		returnIds:                  returnIds,
+		returnConfigs:              returnConfigs,
+		columnNameReverseMap:       make(map[string]int),
+		configColumnNameReverseMap: make(map[string]int)}
+	m.result.AddColumn(common.TimeName)
+	return m
+}
+
+// newRow adds a row of nulls to the result and returns its index.
+func (m *tableMerger) newRow() int {
+	if m.returnIds {
+		m.result.IdColumn = append(m.result.IdColumn, "")
+	}
+	return m.result.AppendRow()
+}
+
+// addRow writes row rowIdx of dTable, read from src, into result row row.  The
+// X value of row is only set by the first row added.
+func (m *tableMerger) addRow(row int, dTable *DataTable, src string, rowIdx int) {
+	// Handle data.
+	for j, colName := range dTable.ColumnNames {
+		v, ok := dTable.Data[j].Get(rowIdx)
+		if j == 0 {
+			if ok && m.result.Data[0].IsNull(row) { // Don't write X column more than once.
+				m.result.Data[0].Set(row, v)
+			}
+			continue
+		}
+
+		columnName := strings.Join([]string{src, colName}, ":")
+		columnNameIndex, found := m.columnNameReverseMap[columnName]
+		if !found {
+			columnNameIndex = len(m.result.ColumnNames)
+			m.columnNameReverseMap[columnName] = columnNameIndex
+			m.result.AddColumn(columnName)
+		}
+		if ok {
+			m.result.Data[columnNameIndex].Set(row, v)
+		}
+	}
+
+	// Handle Ids.
+	if m.returnIds && (rowIdx < len(dTable.IdColumn)) {
+		m.result.IdColumn[row] = dTable.IdColumn[rowIdx]
+	}
+
+	// Handle configs.
+	if m.returnConfigs {
+		for j, columnName := range dTable.ConfigsColumnNames {
+			columnNameIndex, found := m.configColumnNameReverseMap[columnName]
+			if !found {
+				columnNameIndex = len(m.result.ConfigsColumnNames)
+				m.configColumnNameReverseMap[columnName] = columnNameIndex
+				m.result.AddConfigColumn(columnName)
+			}
+			if v, ok := dTable.Configs[j].Get(rowIdx); ok {
+				m.result.Configs[columnNameIndex].Set(row, v)
+			} else {
+				m.result.Configs[columnNameIndex].SetNull(row)
+			}
+		}
+	}
+}
+
+// finish returns the result with rows in the order of rows.
+func (m *tableMerger) finish(rows []int) *DataTable {
+	m.result.selectRows(rows)
+	return m.result
+}
+
+// MergeDataTablesOnConfig returns a single DataTable from multiple ones,
+// joining rows with equal values of config key.  Every table must have
+// configs.  Only the latest (first read) row of each table for a value is
+// used, and rows without key are dropped.  A joined row's X value is from the
+// first table with the value.  If inner is set only values found in every
+// table are kept.  Rows are ordered by first appearance and columns are not in
+// any defined order.
+func MergeDataTablesOnConfig(dTables []*DataTable, srcs []string, key string,
+	inner, returnIds, returnConfigs bool) (resultTable *DataTable) {
+	m := newTableMerger(returnIds, returnConfigs)
+
+	rowMap := make(map[string]int)    // Map from config value to result row.
+	rowCount := make(map[string]int)  // Number of tables with config value.
+	lastTable := make(map[string]int) // Last table (plus one) with config value.
+	var order []string                // Config values by first appearance.
+
+	for i, dTable := range dTables {
+		src := srcs[i]
+		keyIdx, err := StringSlice(dTable.ConfigsColumnNames).IndexForName(key)
+		if err != nil {
+			continue // No rows with key.
+		}
+		keys := dTable.Configs[keyIdx]
+		for rowIdx := 0; rowIdx < keys.Len(); rowIdx++ {
+			val, ok := keys.Get(rowIdx)
+			if !ok {
+				continue
+			}
+			if lastTable[val] == i+1 { // Already have a later row from this table.
+				continue
+			}
+			lastTable[val] = i + 1
+			rowCount[val]++
+
+			row, ok := rowMap[val]
+			if !ok {
+				row = m.newRow()
+				rowMap[val] = row
+				order = append(order, val)
+			}
+			m.addRow(row, dTable, src, rowIdx)
+		}
+	}
+
+	var rows []int
+	for _, val := range order {
+		if inner && (rowCount[val] != len(dTables)) {
+			continue
+		}
+		rows = append(rows, rowMap[val])
+	}
+	return m.finish(rows)
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/davecgh/go-spew/spew"
+	"github.com/google/tsviewdb/src/common"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func f(v float64) *float64 { return &v }
+func s(v string) *string   { return &v }
+
+func floatRow(r ...*float64) *[]*float64 { return &r }
+func stringRow(r ...*string) *[]*string  { return &r }
+
+// rowTable returns a DataTable with data and configs given by row.
+func rowTable(columnNames []string, rows []*[]*float64, configsColumnNames []string,
+	configs []*[]*string) *DataTable {
+	d := NewDataTableFromRows(columnNames, rows)
+	if configsColumnNames != nil {
+		d.SetConfigRows(configsColumnNames, configs)
+	}
+	return d
+}
+
+// Two sources with rows in read (descending time) order.
+func makeJoinTables() []*DataTable {
+	return []*DataTable{
+		rowTable([]string{common.TimeName, "m.max"},
+			[]*[]*float64{
+				floatRow(f(300), f(3)),
+				floatRow(f(200), f(2)),
+				floatRow(f(150), f(1.5)), // Older run of commit b.
+				floatRow(f(100), f(1)),
+			},
+			[]string{"commit"},
+			[]*[]*string{
+				stringRow(s("c")),
+				stringRow(s("b")),
+				stringRow(s("b")),
+				stringRow(nil), // No commit.
+			}),
+		rowTable([]string{common.TimeName, "m.max"},
+			[]*[]*float64{
+				floatRow(f(310), f(30)),
+				floatRow(f(210), f(20)),
+				floatRow(f(10), f(0)),
+			},
+			[]string{"commit", "os"},
+			[]*[]*string{
+				stringRow(s("d"), s("linux")),
+				stringRow(s("b"), s("linux")),
+				stringRow(s("a"), s("linux")),
+			}),
+	}
+}
+
+func TestMergeDataTablesOnConfig(t *testing.T) {
+	got := MergeDataTablesOnConfig(makeJoinTables(), []string{"s1", "s2"}, "commit", false, false, true)
+	got.SortDataColumns()
+	got.SortConfigsColumns()
+	want := rowTable([]string{common.TimeName, "s1:m.max", "s2:m.max"},
+		[]*[]*float64{
+			floatRow(f(300), f(3), nil),
+			floatRow(f(200), f(2), f(20)),
+			floatRow(f(310), nil, f(30)),
+			floatRow(f(10), nil, f(0)),
+		},
+		[]string{"commit", "os"},
+		[]*[]*string{
+			stringRow(s("c"), nil),
+			stringRow(s("b"), s("linux")),
+			stringRow(s("d"), s("linux")),
+			stringRow(s("a"), s("linux")),
+		})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %s\nwant: %s\n", spew.Sdump(got), spew.Sdump(want))
+	}
+
+	got = MergeDataTablesOnConfig(makeJoinTables(), []string{"s1", "s2"}, "commit", true, false, false)
+	got.SortDataColumns()
+	want = rowTable([]string{common.TimeName, "s1:m.max", "s2:m.max"},
+		[]*[]*float64{floatRow(f(200), f(2), f(20))}, nil, nil)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("inner got: %s\nwant: %s\n", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestMergeDataTablesInner(t *testing.T) {
+	dTables := []*DataTable{
+		rowTable([]string{common.TimeName, "m.max"},
+			[]*[]*float64{floatRow(f(2), f(20)), floatRow(f(1), f(10))}, nil, nil),
+		rowTable([]string{common.TimeName, "m.max"},
+			[]*[]*float64{floatRow(f(3), f(300)), floatRow(f(2), f(200))}, nil, nil),
+	}
+	got := MergeDataTables(dTables, []string{"s1", "s2"}, true, false, false)
+	got.SortDataColumns()
+	want := rowTable([]string{common.TimeName, "s1:m.max", "s2:m.max"},
+		[]*[]*float64{floatRow(f(2), f(20), f(200))}, nil, nil)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %s\nwant: %s\n", spew.Sdump(got), spew.Sdump(want))
+	}
+
+	got = MergeDataTables(dTables, []string{"s1", "s2"}, false, false, false)
+	xs := append([]float64{}, got.Data[0].Values...)
+	sort.Float64s(xs)
+	if !reflect.DeepEqual(xs, []float64{1, 2, 3}) {
+		t.Errorf("outer got X values: %v", xs)
+	}
+}
+
+// makeBenchTables returns numTables tables of numRows rows in read order, with
+// X values offset so that about half of them are shared.
+func makeBenchTables(numTables, numRows, numColumns int) []*DataTable {
+	var dTables []*DataTable
+	for i := 0; i < numTables; i++ {
+		dTable := &DataTable{}
+		dTable.AddColumn(common.TimeName)
+		for j := 1; j < numColumns; j++ {
+			dTable.AddColumn("m" + strconv.Itoa(j) + ".mean")
+		}
+		for r := numRows - 1; r >= 0; r-- {
+			row := dTable.AppendRow()
+			dTable.Data[0].Set(row, float64(r*2+i%2))
+			for j := 1; j < numColumns; j++ {
+				dTable.Data[j].Set(row, float64(r*j))
+			}
+			dTable.IdColumn = append(dTable.IdColumn, strconv.Itoa(r))
+		}
+		dTables = append(dTables, dTable)
+	}
+	return dTables
+}
+
+func benchSrcs(n int) (srcs []string) {
+	for i := 0; i < n; i++ {
+		srcs = append(srcs, "src"+strconv.Itoa(i))
+	}
+	return srcs
+}
+
+func TestMergeDataTablesOrder(t *testing.T) {
+	got := MergeDataTables(makeBenchTables(3, 50, 3), benchSrcs(3), false, true, false)
+
+	// Even X values are in tables 0 and 2, odd ones in table 1.
+	var rows []*[]*float64
+	var ids []string
+	for x := 99; x >= 0; x-- {
+		r := float64(x / 2)
+		row := []*float64{f(float64(x)), nil, nil, nil, nil, nil, nil}
+		for _, i := range []int{x % 2, x%2 + 2} {
+			if i < 3 {
+				row[1+2*i], row[2+2*i] = f(r), f(r*2)
+			}
+		}
+		rows = append(rows, &row)
+		ids = append(ids, strconv.Itoa(x/2))
+	}
+	want := NewDataTableFromRows([]string{common.TimeName, "src0:m1.mean", "src0:m2.mean",
+		"src1:m1.mean", "src1:m2.mean", "src2:m1.mean", "src2:m2.mean"}, rows)
+	want.IdColumn = ids
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %s\nwant: %s\n", spew.Sdump(got.Rows()), spew.Sdump(want.Rows()))
+	}
+}
+
+func TestMergeDataTablesAscending(t *testing.T) {
+	dTables := makeBenchTables(2, 3, 2)
+	dTables[1].SortRows(0) // Ascending, as after bucketing.
+	got := MergeDataTables(dTables, benchSrcs(2), true, false, false)
+	if got.NumRows() != 0 { // No shared X values.
+		t.Errorf("got: %s", spew.Sdump(got))
+	}
+	got = MergeDataTables(dTables, benchSrcs(2), false, false, false)
+	if !isDescendingX(got.Data[0]) || (got.NumRows() != 6) {
+		t.Errorf("got: %s", spew.Sdump(got))
+	}
+}
+
+func benchmarkMerge(b *testing.B, numTables int) {
+	dTables := makeBenchTables(numTables, 10000, 10)
+	srcs := benchSrcs(numTables)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MergeDataTables(dTables, srcs, false, true, false)
+	}
+}
+
+func BenchmarkMergeDataTables2(b *testing.B) { benchmarkMerge(b, 2) }
+func BenchmarkMergeDataTables8(b *testing.B) { benchmarkMerge(b, 8) }
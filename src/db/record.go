@@ -54,6 +54,20 @@ type ReadRecord struct {
 	Id                    string            `json:"id,omitempty"`
 }
 
+// StreamRow is a single record returned by a streaming range read.  Nil
+// aggregates are omitted.
+type StreamRow struct {
+	Source     string             `json:"source"`
+	Id         string             `json:"id,omitempty"`
+	Timestamp  int64              `json:"timestamp"`
+	Aggregates map[string]float64 `json:"aggregates,omitempty"`
+	Configs    map[string]string  `json:"configs,omitempty"`
+}
+
+// RowWriter is called by DB.StreamRows for each row read.  Returning an error
+// stops the stream.
+type RowWriter func(row *StreamRow) error
+
 func (r *ReadRecord) SortPoints() {
 	p := parallelStringsFloatTable{names: &r.PointsColumnNames, data: r.Points}
 	p.SortDataColumns()
@@ -0,0 +1,235 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/regress"
+	"math"
+)
+
+// RegressionPoint identifies the record at one end of a regression.
+type RegressionPoint struct {
+	Timestamp int64  `json:"timestamp"`
+	Id        string `json:"id,omitempty"` // Set when ids were read.
+}
+
+// RegressionSegment describes one regression found in a data column.
+type RegressionSegment struct {
+	Column    string          `json:"column"`
+	Metric    string          `json:"metric,omitempty"`  // Of Column, set by ApplyTriage (see TriageColumn).
+	Start     RegressionPoint `json:"start"`             // Last record before the regression.
+	End       RegressionPoint `json:"end"`               // Last record of the regression.
+	Direction string          `json:"direction"`         // "up" or "down".
+	Magnitude float64         `json:"magnitude"`         // Largest detector value, in percent with UsePercent.
+	Delta     float64         `json:"delta"`             // After - Before.
+	Percent   *float64        `json:"percent,omitempty"` // Delta in percent of Before, nil if Before is 0.
+	PValue    *float64        `json:"pValue,omitempty"`  // Set when tested for significance.
+	Before    float64         `json:"before"`
+	After     float64         `json:"after"`
+	Triage    *Triage         `json:"triage,omitempty"` // Set by ApplyTriage, if triaged.
+}
+
+func (d *DataTable) regressionSegment(col int, r regress.Regression) RegressionSegment {
+	c := d.Data[col]
+	before, _ := c.Get(r.StartRow)
+	after, _ := c.Get(r.EndRow)
+	seg := RegressionSegment{
+		Column:    d.ColumnNames[col],
+		Start:     d.regressionPoint(r.StartRow),
+		End:       d.regressionPoint(r.EndRow),
+		Direction: "up",
+		Magnitude: r.Magnitude,
+		Delta:     after - before,
+		Before:    before,
+		After:     after}
+	if r.Magnitude < 0 {
+		seg.Direction = "down"
+	}
+	if before != 0 {
+		percent := (seg.Delta / math.Abs(before)) * 100
+		seg.Percent = &percent
+	}
+	return seg
+}
+
+func (d *DataTable) regressionPoint(row int) (p RegressionPoint) {
+	if t, ok := d.Data[0].Get(row); ok {
+		p.Timestamp = int64(t)
+	}
+	if len(d.IdColumn) == d.NumRows() {
+		p.Id = d.IdColumn[row]
+	}
+	return p
+}
+
+// PointsLoader returns the points of metric in the record with id, or none if
+// the record is not from source.  Source is "" when unknown.
+type PointsLoader func(id, source, metric string) ([]float64, error)
+
+// Significance configures testing regressions with the points of the records
+// on either side (see GetSignificantRegression).
+type Significance struct {
+	Test    string  // Name in regress.Tests.
+	Alpha   float64 // Regressions with greater p-values are dropped.
+	Records int     // Number of records to use from each side.
+	Load    PointsLoader
+	Sources []FilteredSource // Read into the table, to find the points of each column.
+}
+
+// GetSignificantRegression is GetVerifiedRegression keeping only regressions
+// where the points of the records before and after differ significantly.
+// Regressions which cannot be tested, because the table has no ids or the
+// records have too few points, are kept.
+func (d *DataTable) GetSignificantRegression(rParams regress.RegressionParams, sig Significance) error {
+	return d.getRegression(rParams, &sig)
+}
+
+func (d *DataTable) getRegression(baseParams regress.RegressionParams, sig *Significance) error {
+	numColumns := len(d.ColumnNames)
+	for i := 0; i < numColumns; i++ {
+		if isNonData(d.ColumnNames[i]) { // Don't compute regressions over known non-data columns.
+			continue
+		}
+		rParams, ok := d.columnRegressionParams(i, baseParams)
+		if !ok {
+			continue
+		}
+		c := d.Data[i] // Values for detection.
+		if rParams.SeasonMillis != 0 {
+			var seasonal *column.Floats
+			if c, seasonal = regress.Deseasonalize(d.Data[i], d.Data[0], rParams); (seasonal != nil) && rParams.ReturnSeasonal {
+				d.ColumnNames = append(d.ColumnNames, common.SeasonalNamePrefix+d.ColumnNames[i])
+				d.Data = append(d.Data, seasonal)
+			}
+		}
+		if (sig == nil) && (rParams.Format != regress.FormatSegments) {
+			if result := d.verifiedRegression(i, c, rParams); result != nil {
+				d.ColumnNames = append(d.ColumnNames, common.RegressNamePrefix+d.ColumnNames[i])
+				d.Data = append(d.Data, result)
+			}
+			continue
+		}
+
+		regressions := regress.FindRegressions(c, rParams)
+		pValues := make([]*float64, len(regressions))
+		if sig != nil {
+			kept := regressions[:0]
+			pValues = pValues[:0]
+			for _, r := range regressions {
+				p, err := d.pValue(i, r, sig)
+				if err != nil {
+					return err
+				}
+				if (p == nil) || (*p <= sig.Alpha) {
+					kept = append(kept, r)
+					pValues = append(pValues, p)
+				}
+			}
+			regressions = kept
+		}
+
+		if rParams.Format == regress.FormatSegments {
+			for j, r := range regressions {
+				seg := d.regressionSegment(i, r)
+				seg.PValue = pValues[j]
+				d.Regressions = append(d.Regressions, seg)
+			}
+			continue
+		}
+
+		// Keep the regression values of significant regressions only.
+		result := d.verifiedRegression(i, c, rParams)
+		if (result == nil) || (len(regressions) == 0) {
+			continue
+		}
+		keep := make([]bool, result.Len())
+		for _, r := range regressions {
+			for row := r.StartRow; row <= r.EndRow; row++ {
+				keep[row] = true
+			}
+		}
+		for row, k := range keep {
+			if !k {
+				result.SetNull(row)
+			}
+		}
+		d.ColumnNames = append(d.ColumnNames, common.RegressNamePrefix+d.ColumnNames[i])
+		d.Data = append(d.Data, result)
+	}
+	return nil
+}
+
+// verifiedRegression returns the regression values of c, the values of column
+// col possibly adjusted for seasonality.  Segments show the column values.
+func (d *DataTable) verifiedRegression(col int, c *column.Floats, rParams regress.RegressionParams) *column.Floats {
+	result := regress.GetVerifiedRegression(c, rParams)
+	if (result != nil) && rParams.ReturnSegments && (c != d.Data[col]) {
+		for row := 0; row < result.Len(); row++ {
+			if !result.IsNull(row) {
+				result.SetPtr(row, d.Data[col].Ptr(row))
+			}
+		}
+	}
+	return result
+}
+
+// pValue tests the points of up to sig.Records records with values in column
+// col up to the start of r against those from its end.  It returns nil if the
+// column has no metric or either side has fewer than two points.
+func (d *DataTable) pValue(col int, r regress.Regression, sig *Significance) (*float64, error) {
+	if len(d.IdColumn) != d.NumRows() {
+		return nil, nil
+	}
+	source, name := d.columnOrigin(d.ColumnNames[col], sig.Sources)
+	metric, aggregate := common.GetMetricComponents(name)
+	if aggregate == "" {
+		return nil, nil
+	}
+	metric, _ = common.SplitGroupSuffix(metric)
+
+	c := d.Data[col]
+	load := func(start, step int) (points []float64, err error) {
+		numRecords := 0
+		for row := start; (row >= 0) && (row < c.Len()) && (numRecords < sig.Records); row += step {
+			if c.IsNull(row) {
+				continue
+			}
+			numRecords++
+			p, err := sig.Load(d.IdColumn[row], source, metric)
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, p...)
+		}
+		return points, nil
+	}
+	before, err := load(r.StartRow, -1)
+	if err != nil {
+		return nil, err
+	}
+	after, err := load(r.EndRow, 1)
+	if err != nil {
+		return nil, err
+	}
+	if (len(before) < 2) || (len(after) < 2) {
+		return nil, nil
+	}
+	p := regress.Tests[sig.Test](before, after)
+	return &p, nil
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"github.com/davecgh/go-spew/spew"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/regress"
+	"github.com/google/tsviewdb/src/transform"
+	"reflect"
+	"testing"
+)
+
+func TestRegressionSegments(t *testing.T) {
+	d := rowTable([]string{common.TimeName, "lat"}, []*[]*float64{
+		floatRow(f(100), f(10)),
+		floatRow(f(200), f(10)),
+		floatRow(f(300), f(15)),
+		floatRow(f(400), f(15)),
+	}, nil, nil)
+	d.IdColumn = []string{"a", "b", "c", "d"}
+	pos := 1.0
+	d.GetVerifiedRegression(regress.RegressionParams{Window: 1, Pos: &pos, Format: regress.FormatSegments})
+
+	if len(d.ColumnNames) != 2 {
+		t.Errorf("Unexpected regression columns: %v", d.ColumnNames)
+	}
+	percent := 50.0
+	want := []RegressionSegment{{
+		Column:    "lat",
+		Start:     RegressionPoint{Timestamp: 200, Id: "b"},
+		End:       RegressionPoint{Timestamp: 300, Id: "c"},
+		Direction: "up",
+		Magnitude: 5,
+		Delta:     5,
+		Percent:   &percent,
+		Before:    10,
+		After:     15}}
+	if !reflect.DeepEqual(d.Regressions, want) {
+		t.Errorf("got: %+v want: %+v", d.Regressions, want)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded DataTable
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Regressions, want) {
+		t.Errorf("decoded got: %+v want: %+v", decoded.Regressions, want)
+	}
+}
+
+func TestSignificantRegression(t *testing.T) {
+	makeTable := func() *DataTable {
+		d := rowTable([]string{common.TimeName, "src:lat.p99"}, []*[]*float64{
+			floatRow(f(100), f(10)),
+			floatRow(f(200), f(10)),
+			floatRow(f(300), f(15)),
+			floatRow(f(400), f(15)),
+			floatRow(f(500), f(10)),
+			floatRow(f(600), f(10)),
+		}, nil, nil)
+		d.IdColumn = []string{"a", "b", "c", "d", "e", "f"}
+		return d
+	}
+	low, high := []float64{10, 11, 10, 11, 10}, []float64{15, 16, 15, 16, 15}
+	points := map[string][]float64{"a": low, "b": low, "c": high, "d": high, "e": high, "f": high}
+	load := func(id, source, metric string) ([]float64, error) {
+		if (source != "src") || (metric != "lat") {
+			t.Errorf("Unexpected source %s and metric %s", source, metric)
+		}
+		return points[id], nil
+	}
+	sig := Significance{Test: regress.TestMannWhitney, Alpha: 0.05, Records: 1, Load: load,
+		Sources: []FilteredSource{{Source: "src"}, {Source: "other"}}}
+	pos, neg := 1.0, -1.0
+	rParams := regress.RegressionParams{Window: 1, Pos: &pos, Neg: &neg, Format: regress.FormatSegments}
+
+	// The fall at e is not significant since d and e have the same points.
+	d := makeTable()
+	if err := d.GetSignificantRegression(rParams, sig); err != nil {
+		t.Fatal(err)
+	}
+	if (len(d.Regressions) != 1) || (d.Regressions[0].End.Id != "c") || (d.Regressions[0].PValue == nil) {
+		t.Fatalf("got: %+v want one regression ending at c", d.Regressions)
+	}
+	if p := *d.Regressions[0].PValue; (p <= 0) || (p > 0.05) {
+		t.Errorf("p-value got: %v", p)
+	}
+
+	d = makeTable()
+	rParams.Format = regress.FormatColumns
+	if err := d.GetSignificantRegression(rParams, sig); err != nil {
+		t.Fatal(err)
+	}
+	want := []*float64{nil, f(0), f(5), nil, nil, nil} // Only rows of the rise.
+	if got := d.Data[len(d.Data)-1].Ptrs(); (len(d.Data) != 3) || !reflect.DeepEqual(got, want) {
+		t.Errorf("columns got: %s want: %s", spew.Sdump(d.Rows()), spew.Sdump(want))
+	}
+
+	// An aliased column loads the points of its source and metric.
+	d = makeTable()
+	d.ColumnNames[1] = "lat.p99"
+	sig.Sources = []FilteredSource{{Source: "src", Alias: "p99"}}
+	if err := d.ApplyAliases(sig.Sources); err != nil {
+		t.Fatal(err)
+	}
+	rParams.Format = regress.FormatSegments
+	if err := d.GetSignificantRegression(rParams, sig); err != nil {
+		t.Fatal(err)
+	}
+	if (len(d.Regressions) != 1) || (d.Regressions[0].Column != "p99") || (d.Regressions[0].PValue == nil) {
+		t.Errorf("aliased got: %+v want one tested regression", d.Regressions)
+	}
+}
+
+func TestTransformRegressionSegments(t *testing.T) {
+	d := rowTable([]string{common.TimeName, "lat"}, []*[]*float64{
+		floatRow(f(100), f(10)),
+		floatRow(f(200), f(10)),
+		floatRow(f(300), f(20)),
+		floatRow(f(400), f(20)),
+	}, nil, nil)
+	pos := 5.0
+	d.GetVerifiedRegression(regress.RegressionParams{Window: 1, Pos: &pos, ReturnSegments: true})
+	d.Transform(transform.Pipeline{transform.Normalize(transform.FirstRow, false)}, true)
+
+	want := []*float64{nil, f(1), f(2), nil} // On the normalized line.
+	if got := d.Data[2].Ptrs(); (d.ColumnNames[2] != common.RegressNamePrefix+"lat") || !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %s want: %s", spew.Sdump(d.Rows()), spew.Sdump(want))
+	}
+}
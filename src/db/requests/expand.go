@@ -0,0 +1,104 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package requests
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/srcparse"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var maxSourceExpansion = flag.Int("maxSourceExpansion", 50,
+	"Maximum number of sources a request's source patterns may expand into.")
+
+// ExpandSources replaces each source pattern in req (see srcparse.Match) with
+// the matching sources from the directory, in sorted order and each with the
+// pattern's filters.  A matching source already selected earlier in the
+// request with the same filters is not repeated.  Returns true if any pattern
+// was expanded.
+func ExpandSources(d db.DB, req *db.RowRangeRequests) (expanded bool, err error) {
+	t := time.Now()
+	var result []db.FilteredSource
+	for _, fSrc := range req.FilteredSources {
+		if !fSrc.Pattern {
+			result = append(result, fSrc)
+			continue
+		}
+		expanded = true
+
+		srcs, err := matchingSources(d, fSrc.Source)
+		if err != nil {
+			return false, err
+		}
+		if len(srcs) == 0 {
+			return false, errors.New("No sources match pattern: " + fSrc.Source)
+		}
+		for _, src := range srcs {
+			newFSrc := fSrc
+			newFSrc.Source = src
+			newFSrc.Pattern = false
+			if !containsSource(result, newFSrc) {
+				result = append(result, newFSrc)
+			}
+		}
+		if len(result) > *maxSourceExpansion {
+			return false, fmt.Errorf("Source patterns match more than %d sources.", *maxSourceExpansion)
+		}
+	}
+
+	if expanded {
+		req.FilteredSources = result
+		glog.V(2).Infof("PERF: source expansion time: %v\n", time.Now().Sub(t))
+	}
+	return expanded, nil
+}
+
+// containsSource returns true if fSrcs has fSrc with the same filters.
+func containsSource(fSrcs []db.FilteredSource, fSrc db.FilteredSource) bool {
+	for _, f := range fSrcs {
+		if reflect.DeepEqual(f, fSrc) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingSources returns the sorted directory sources matching pattern.
+func matchingSources(d db.DB, pattern string) ([]string, error) {
+	sInfo, err := d.ReadDir(db.DirectorySearchRequest{
+		Prefix:         srcparse.PatternPrefix(pattern),
+		DirPrefixMatch: true})
+	if err != nil {
+		return nil, err
+	}
+	var srcs []string
+	for _, name := range sInfo.Names {
+		name = strings.TrimPrefix(name, "/") // Sources at the root.
+		if srcparse.Match(pattern, name) {
+			srcs = append(srcs, name)
+		}
+	}
+	sort.Strings(srcs)
+	return srcs, nil
+}
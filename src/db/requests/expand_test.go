@@ -0,0 +1,68 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package requests
+
+import (
+	"github.com/google/tsviewdb/src/db"
+	"testing"
+)
+
+// fakeDir is a DB serving only a directory listing.
+type fakeDir struct {
+	db.DB
+	names []string
+}
+
+func (f *fakeDir) ReadDir(req db.DirectorySearchRequest) (db.SourceInfoUncomp, error) {
+	return db.SourceInfoUncomp{Names: f.names}, nil
+}
+
+func TestExpandSourcesKeepsFilters(t *testing.T) {
+	d := &fakeDir{names: []string{"d/a", "d/b"}}
+	for _, tt := range []struct {
+		query string
+		want  []string // Source and metrics of each FilteredSource.
+	}{
+		{"src=d/a:lat.mean&src=d/a*:qps.mean", []string{"d/a lat", "d/a qps"}},
+		{"src=d/a:lat.mean&src=d/a:qps.mean", []string{"d/a lat", "d/a qps"}},
+		{"src=d/a:lat.mean&src=d/*:lat.mean", []string{"d/a lat", "d/b lat"}},
+	} {
+		req, err := MakeRowRangeReqs(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ExpandSources(d, &req); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, fSrc := range req.FilteredSources {
+			for metric := range fSrc.MetricsFilter {
+				got = append(got, fSrc.Source+" "+metric)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -22,10 +22,14 @@ import (
 	"fmt"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/backtest"
 	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/configfilter"
 	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/expr"
 	"github.com/google/tsviewdb/src/regress"
 	"github.com/google/tsviewdb/src/srcparse"
+	"github.com/google/tsviewdb/src/transform"
 	"net/url"
 	"strconv"
 	"strings"
@@ -50,6 +54,29 @@ func getEpochMillis(date string) int64 {
 	return t.Unix() * 1000
 }
 
+// ParseMillis parses a positive duration such as "90s", "1h" or "1d" into
+// milliseconds.  A "d" suffix means days.
+func ParseMillis(s string) (int64, error) {
+	var d time.Duration
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		if err != nil {
+			return 0, err
+		}
+		d = time.Duration(days * float64(24*time.Hour))
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, err
+		}
+	}
+	millis := int64(d / time.Millisecond)
+	if millis <= 0 {
+		return 0, errors.New("Must be at least 1ms: " + s)
+	}
+	return millis, nil
+}
+
 func MakeRowReq(rawQuery string) (db.RowRequest, error) {
 	q, _ := url.ParseQuery(rawQuery)
 	id := q.Get("id")
@@ -127,18 +154,19 @@ func MakeRowRangeReqs(rawQuery string) (db.RowRangeRequests, error) {
 		}
 	}
 
-	var configsFilter map[string]string
-	if configsFilterList, ok := q["config"]; ok {
-		configsFilter = make(map[string]string)
-		for _, kvPair := range configsFilterList {
-			kvArray := strings.SplitN(kvPair, "=", 2)
-			k := kvArray[0]
-			var v string
-			if len(kvArray) > 1 {
-				v = kvArray[1]
-			}
-			configsFilter[k] = v
+	// Each config parameter is a clause which must match (see srcparse.Parse).
+	var configsFilter configfilter.Filter
+	for _, config := range q["config"] {
+		clause, err := srcparse.ParseConfigClause(config)
+		if err != nil {
+			return db.RowRangeRequests{}, err
 		}
+		configsFilter = append(configsFilter, clause)
+	}
+
+	var groupBy []string
+	if groupByStr := q.Get("groupBy"); groupByStr != "" {
+		groupBy = strings.Split(groupByStr, ",")
 	}
 
 	equalX := q.Get("equalX") == "1"
@@ -148,15 +176,66 @@ func MakeRowRangeReqs(rawQuery string) (db.RowRangeRequests, error) {
 		sortByColumn = common.TimeName
 	}
 
+	joinOnConfig := q.Get("joinOnConfig")
+	var innerJoin bool
+	switch join := q.Get("join"); join {
+	case "", "outer":
+	case "inner":
+		innerJoin = true
+	default:
+		return db.RowRangeRequests{}, errors.New("Bad join parameter: " + join)
+	}
+
+	var bucketMillis int64
+	if bucket := q.Get("bucket"); bucket != "" {
+		var err error
+		if bucketMillis, err = ParseMillis(bucket); err != nil {
+			return db.RowRangeRequests{}, errors.New("Bad bucket parameter: " + err.Error())
+		}
+	}
+	bucketReducer := q.Get("bucketReducer")
+	if bucketReducer == "" {
+		bucketReducer = db.BucketLast
+	} else if !db.BucketReducers[bucketReducer] {
+		return db.RowRangeRequests{}, errors.New("Bad bucketReducer parameter: " + bucketReducer)
+	}
+
+	var nearestMillis int64
+	if nearest := q.Get("nearest"); nearest != "" {
+		var err error
+		if nearestMillis, err = ParseMillis(nearest); err != nil {
+			return db.RowRangeRequests{}, errors.New("Bad nearest parameter: " + err.Error())
+		}
+	}
+
+	numMergeModes := 0
+	for _, set := range []bool{joinOnConfig != "", bucketMillis > 0, nearestMillis > 0} {
+		if set {
+			numMergeModes++
+		}
+	}
+	if numMergeModes > 1 {
+		return db.RowRangeRequests{}, errors.New("Only one of joinOnConfig, bucket, and nearest may be set.")
+	}
+
 	returnIds := q.Get("returnIds") == "1"
 	returnConfigs := q.Get("returnConfigs") == "1"
 	noReturnAggregates := q.Get("noReturnAggregates") == "1"
 
+	// The nth alias names the columns of the nth source (see db.ApplyAliases).
+	aliases := q["alias"]
+	if len(aliases) > len(srcs) {
+		return db.RowRangeRequests{}, errors.New("More alias than src parameters.")
+	}
+
 	// Now put together request struct.
 
 	filteredSources := make([]db.FilteredSource, len(srcs))
 	for i, s := range srcs {
-		sr := srcparse.Parse(s)
+		sr, err := srcparse.Parse(s)
+		if err != nil {
+			return db.RowRangeRequests{}, err
+		}
 
 		loopMetricsFilter := metricsFilter
 		if sr.Metric != "" {
@@ -166,16 +245,31 @@ func MakeRowRangeReqs(rawQuery string) (db.RowRangeRequests, error) {
 		if sr.Aggregate != "" {
 			loopAggregatesFilter = map[string]bool{sr.Aggregate: true}
 		}
-		loopConfigsFilter := configsFilter
-		if len(sr.Configs) != 0 {
-			loopConfigsFilter = sr.Configs
+		var loopConfigsFilter configfilter.Filter // Both must match.
+		loopConfigsFilter = append(append(loopConfigsFilter, configsFilter...), sr.Configs...)
+		loopGroupBy := groupBy
+		if len(sr.GroupBy) > 0 {
+			loopGroupBy = append([]string(nil), groupBy...)
+			for _, key := range sr.GroupBy {
+				if !common.StringInSlice(key, loopGroupBy) {
+					loopGroupBy = append(loopGroupBy, key)
+				}
+			}
 		}
 
 		filteredSources[i] = db.FilteredSource{
 			Source:           sr.Source,
+			Pattern:          sr.Pattern,
 			MetricsFilter:    loopMetricsFilter,
 			AggregatesFilter: loopAggregatesFilter,
-			ConfigsFilter:    loopConfigsFilter}
+			ConfigsFilter:    loopConfigsFilter,
+			GroupByConfigs:   loopGroupBy}
+		if i < len(aliases) {
+			if sr.Pattern && (aliases[i] != "") { // It would name every matching source.
+				return db.RowRangeRequests{}, errors.New("Source patterns cannot have an alias: " + s)
+			}
+			filteredSources[i].Alias = aliases[i]
+		}
 	}
 
 	qualifier := db.Qualifier{
@@ -188,7 +282,12 @@ func MakeRowRangeReqs(rawQuery string) (db.RowRangeRequests, error) {
 		SortByConfig:          sortByConfig,
 		ReturnIds:             returnIds,
 		ReturnConfigs:         returnConfigs,
-		NoReturnAggregates:    noReturnAggregates}
+		NoReturnAggregates:    noReturnAggregates,
+		JoinOnConfig:          joinOnConfig,
+		InnerJoin:             innerJoin,
+		BucketMillis:          bucketMillis,
+		BucketReducer:         bucketReducer,
+		NearestMillis:         nearestMillis}
 
 	req := db.RowRangeRequests{
 		FilteredSources: filteredSources,
@@ -201,6 +300,183 @@ func MakeRowRangeReqs(rawQuery string) (db.RowRangeRequests, error) {
 	return req, nil
 }
 
+// MakeExpressions parses the expr parameters, each of the form
+// [name=]expression (see expr.Parse).
+func MakeExpressions(rawQuery string) (exprs []*expr.Expr, err error) {
+	q, _ := url.ParseQuery(rawQuery)
+	for _, s := range q["expr"] {
+		e, err := expr.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs, nil
+}
+
+// MakeStatsBy returns the config keys of the statsBy parameter, by which to
+// group rows for statistics (see db.GroupStats).
+func MakeStatsBy(rawQuery string) []string {
+	q, _ := url.ParseQuery(rawQuery)
+	if statsBy := q.Get("statsBy"); statsBy != "" {
+		return strings.Split(statsBy, ",")
+	}
+	return nil
+}
+
+// MakeTransforms parses the transform parameters into one pipeline.  Each is a
+// comma separated list of steps of the form name[:arg]:
+//
+//	movingAvg:N      moving average of N values
+//	ema:N            exponential smoothing over N values
+//	norm[:row]       ratio to the first value, or to the value in row
+//	pctChange[:row]  percent change from the first value, or from row
+//	zscore           standard deviations from the mean
+//	diff             difference from the previous value
+//	cumsum           cumulative sum
+//	rate[:unit]      change per unit of time, such as "1m" (default "1s")
+func MakeTransforms(rawQuery string) (p transform.Pipeline, err error) {
+	q, _ := url.ParseQuery(rawQuery)
+	for _, param := range q["transform"] {
+		for _, step := range strings.Split(param, ",") {
+			f, err := parseTransform(step)
+			if err != nil {
+				return nil, errors.New("Bad transform parameter: " + step + ": " + err.Error())
+			}
+			p = append(p, f)
+		}
+	}
+	return p, nil
+}
+
+func parseTransform(step string) (transform.Func, error) {
+	name, arg := step, ""
+	if i := strings.Index(step, ":"); i >= 0 {
+		name, arg = step[:i], step[i+1:]
+	}
+	window := func() (int, error) {
+		n, err := strconv.Atoi(arg)
+		if err == nil && n < 1 {
+			err = errors.New("Window must be > 0.")
+		}
+		return n, err
+	}
+	baseRow := func() (int, error) {
+		if arg == "" {
+			return transform.FirstRow, nil
+		}
+		row, err := strconv.Atoi(arg)
+		if err == nil && row < 0 {
+			err = errors.New("Row must be >= 0.")
+		}
+		return row, err
+	}
+	noArg := func(f transform.Func) (transform.Func, error) {
+		if arg != "" {
+			return nil, errors.New("No argument allowed.")
+		}
+		return f, nil
+	}
+
+	switch name {
+	case "movingAvg":
+		n, err := window()
+		return transform.MovingAverage(n), err
+	case "ema":
+		n, err := window()
+		return transform.ExponentialSmoothing(n), err
+	case "norm", "pctChange":
+		row, err := baseRow()
+		return transform.Normalize(row, name == "pctChange"), err
+	case "zscore":
+		return noArg(transform.ZScore())
+	case "diff":
+		return noArg(transform.Diff())
+	case "cumsum":
+		return noArg(transform.CumulativeSum())
+	case "rate":
+		if arg == "" {
+			arg = "1s"
+		}
+		millis, err := ParseMillis(arg)
+		return transform.Rate(float64(millis)), err
+	}
+	return nil, errors.New("Unknown transform.")
+}
+
+// MakeSignificance returns the significance test of regressions selected by
+// the regressSigTest parameter, or nil if none.  Its Load is not set.
+func MakeSignificance(rawQuery string) (*db.Significance, error) {
+	q, _ := url.ParseQuery(rawQuery)
+	test := q.Get("regressSigTest")
+	if test == "" {
+		return nil, nil
+	}
+	if _, ok := regress.Tests[test]; !ok {
+		return nil, errors.New("Bad regressSigTest parameter: " + test)
+	}
+	sig := &db.Significance{Test: test, Alpha: 0.05, Records: 3}
+	if alphaStr := q.Get("regressSigAlpha"); alphaStr != "" {
+		alpha, err := strconv.ParseFloat(alphaStr, 64)
+		if (err != nil) || (alpha <= 0) || (alpha > 1) {
+			return nil, errors.New("Bad regressSigAlpha parameter: " + alphaStr)
+		}
+		sig.Alpha = alpha
+	}
+	if recordsStr := q.Get("regressSigRecords"); recordsStr != "" {
+		records, err := strconv.Atoi(recordsStr)
+		if (err != nil) || (records < 1) {
+			return nil, errors.New("Bad regressSigRecords parameter: " + recordsStr)
+		}
+		sig.Records = records
+	}
+	return sig, nil
+}
+
+// MakeScanOverrides parses the override parameters of a scan, each of the
+// form metric:name=value[,name=value...], into regression parameters replacing
+// the defaults for that metric.
+func MakeScanOverrides(rawQuery string) (map[string]url.Values, error) {
+	q, _ := url.ParseQuery(rawQuery)
+	overrides := make(map[string]url.Values)
+	for _, override := range q["override"] {
+		i := strings.LastIndex(override, ":")
+		if i <= 0 {
+			return nil, errors.New("Bad override parameter: " + override)
+		}
+		metric := override[:i]
+		if overrides[metric] == nil {
+			overrides[metric] = make(url.Values)
+		}
+		for _, pair := range strings.Split(override[i+1:], ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if (len(kv) != 2) || !strings.HasPrefix(kv[0], "regress") {
+				return nil, errors.New("Bad override parameter: " + override)
+			}
+			overrides[metric].Set(kv[0], kv[1])
+		}
+	}
+	return overrides, nil
+}
+
+// MakeTriageHide returns the triage statuses of the regressHide parameter, a
+// comma separated list, whose regressions are dropped (see db.ApplyTriage).
+func MakeTriageHide(rawQuery string) (map[string]bool, error) {
+	q, _ := url.ParseQuery(rawQuery)
+	hideStr := q.Get("regressHide")
+	if hideStr == "" {
+		return nil, nil
+	}
+	hide := make(map[string]bool)
+	for _, status := range strings.Split(hideStr, ",") {
+		if !db.TriageStatuses[status] {
+			return nil, errors.New("Bad regressHide parameter: " + status)
+		}
+		hide[status] = true
+	}
+	return hide, nil
+}
+
 func MakeRegressionParams(rawQuery string) (r regress.RegressionParams, err error) {
 	q, _ := url.ParseQuery(rawQuery)
 
@@ -226,6 +502,20 @@ func MakeRegressionParams(rawQuery string) (r regress.RegressionParams, err erro
 		r.Selected = true
 	}
 
+	if algo := q.Get("regressAlgo"); algo != "" {
+		if _, ok := regress.Detectors[algo]; !ok {
+			return r, errors.New("Bad regressAlgo parameter: " + algo)
+		}
+		r.Algo = algo
+		r.Selected = true
+	}
+
+	// Columns use the defaults of their metrics (see db.SetRegressionDefaults).
+	if q.Get("regressUseDefaults") == "1" {
+		r.UseDefaults = true
+		r.Selected = true
+	}
+
 	if !r.Selected {
 		return
 	}
@@ -262,5 +552,177 @@ func MakeRegressionParams(rawQuery string) (r regress.RegressionParams, err erro
 
 	r.ReturnSegments = q.Get("regressReturnSegments") == "1"
 
+	switch r.Format = q.Get("regressFormat"); r.Format {
+	case "", regress.FormatColumns, regress.FormatSegments:
+	default:
+		return r, errors.New("Bad regressFormat parameter: " + r.Format)
+	}
+
+	switch season := q.Get("regressSeason"); season {
+	case "":
+	case "auto":
+		r.SeasonMillis = regress.SeasonAuto
+	case "daily":
+		r.SeasonMillis = regress.DayMillis
+	case "weekly":
+		r.SeasonMillis = regress.WeekMillis
+	default:
+		if r.SeasonMillis, err = ParseMillis(season); err != nil {
+			return r, errors.New("Bad regressSeason parameter: " + err.Error())
+		}
+	}
+	r.ReturnSeasonal = q.Get("regressReturnSeasonal") == "1"
+
+	// Parameters of the other change-point detectors (see regress.Detectors).
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{
+		{"regressMinSegment", &r.MinSegment},
+		{"regressPermutations", &r.Permutations},
+		{"regressSeasonBins", &r.SeasonBins},
+	} {
+		if str := q.Get(p.name); str != "" {
+			if *p.value, err = strconv.Atoi(str); err != nil {
+				return r, errors.New("Bad " + p.name + " parameter: " + str)
+			}
+			if *p.value < 1 {
+				return r, errors.New(p.name + " must be > 0")
+			}
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value *float64
+	}{
+		{"regressCusumDrift", &r.CusumDrift},
+		{"regressCusumThreshold", &r.CusumThreshold},
+		{"regressAlpha", &r.Alpha},
+		{"regressPenalty", &r.Penalty},
+	} {
+		if str := q.Get(p.name); str != "" {
+			if *p.value, err = strconv.ParseFloat(str, 64); err != nil {
+				return r, errors.New("Bad " + p.name + " parameter: " + str)
+			}
+			if *p.value <= 0 {
+				return r, errors.New(p.name + " must be > 0")
+			}
+		}
+	}
+	if r.Permutations > regress.MaxPermutations {
+		return r, fmt.Errorf("regressPermutations must be <= %d", regress.MaxPermutations)
+	}
+	if r.Alpha > 1 {
+		return r, errors.New("regressAlpha must be <= 1")
+	}
+	if r.SeasonBins > regress.MaxSeasonBins {
+		return r, errors.New("Bad regressSeasonBins parameter: " + q.Get("regressSeasonBins"))
+	}
+
+	// The parameters given take precedence over the defaults of metrics.
+	r.Explicit = regress.Override{Pos: r.Pos, Neg: r.Neg}
+	if _, ok := q["regressUsePercent"]; ok {
+		usePercent := r.UsePercent
+		r.Explicit.UsePercent = &usePercent
+	}
+	if ignoreLTStr != "" {
+		ignoreLT := r.IgnoreLT
+		r.Explicit.IgnoreLT = &ignoreLT
+	}
+	if windowStr != "" {
+		window := r.Window
+		r.Explicit.Window = &window
+	}
+	if radiusStr != "" {
+		radius := r.Radius
+		r.Explicit.Radius = &radius
+	}
+	if q.Get("regressSeasonBins") != "" {
+		seasonBins := r.SeasonBins
+		r.Explicit.SeasonBins = &seasonBins
+	}
+
 	return
 }
+
+// MakeBacktestLabels returns the labels of a backtest: the known and nonEvents
+// parameters, comma separated times in milliseconds, the tolerance parameter,
+// a duration (see ParseMillis), and labelsComplete=1.
+func MakeBacktestLabels(rawQuery string) (labels backtest.Labels, err error) {
+	q, _ := url.ParseQuery(rawQuery)
+	for _, p := range []struct {
+		name  string
+		times *[]int64
+	}{{"known", &labels.Regressions}, {"nonEvents", &labels.NonEvents}} {
+		for _, s := range strings.Split(q.Get(p.name), ",") {
+			if s == "" {
+				continue
+			}
+			t, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return labels, errors.New("Bad " + p.name + " parameter: " + s)
+			}
+			*p.times = append(*p.times, t)
+		}
+	}
+	if len(labels.Regressions) == 0 {
+		return labels, errors.New("No known regressions selected.")
+	}
+	if toleranceStr := q.Get("tolerance"); toleranceStr != "" {
+		if labels.Tolerance, err = ParseMillis(toleranceStr); err != nil {
+			return labels, errors.New("Bad tolerance parameter: " + err.Error())
+		}
+	}
+	labels.Complete = q.Get("labelsComplete") == "1"
+	return labels, nil
+}
+
+// MakeBacktestGrid returns the values swept by a backtest: the sweepThreshold,
+// sweepWindow, sweepRadius and sweepUsePercent (0 or 1) parameters, comma
+// separated, or those of backtest.DefaultGrid for parameters not given.  Only
+// regress.AlgoWindow has windows and radii.
+func MakeBacktestGrid(rawQuery string) (g backtest.Grid, err error) {
+	q, _ := url.ParseQuery(rawQuery)
+	g = backtest.DefaultGrid
+	if algo := q.Get("regressAlgo"); (algo != "") && (algo != regress.AlgoWindow) {
+		if (q.Get("sweepWindow") != "") || (q.Get("sweepRadius") != "") {
+			return g, errors.New("sweepWindow and sweepRadius only apply to regressAlgo=window.")
+		}
+		g.Windows, g.Radii = nil, nil
+	}
+	if str := q.Get("sweepThreshold"); str != "" {
+		g.Thresholds = nil
+		for _, s := range strings.Split(str, ",") {
+			t, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return g, errors.New("Bad sweepThreshold parameter: " + s)
+			}
+			g.Thresholds = append(g.Thresholds, t)
+		}
+	}
+	for _, p := range []struct {
+		name   string
+		values *[]int
+	}{{"sweepWindow", &g.Windows}, {"sweepRadius", &g.Radii}} {
+		if str := q.Get(p.name); str != "" {
+			*p.values = nil
+			for _, s := range strings.Split(str, ",") {
+				v, err := strconv.Atoi(s)
+				if err != nil {
+					return g, errors.New("Bad " + p.name + " parameter: " + s)
+				}
+				*p.values = append(*p.values, v)
+			}
+		}
+	}
+	if str := q.Get("sweepUsePercent"); str != "" {
+		g.UsePercent = nil
+		for _, s := range strings.Split(str, ",") {
+			if (s != "0") && (s != "1") {
+				return g, errors.New("Bad sweepUsePercent parameter: " + s)
+			}
+			g.UsePercent = append(g.UsePercent, s == "1")
+		}
+	}
+	return g, g.Validate()
+}
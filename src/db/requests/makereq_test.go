@@ -0,0 +1,35 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package requests
+
+import (
+	"testing"
+)
+
+func TestMakeRegressionParamsErrors(t *testing.T) {
+	for query, want := range map[string]string{
+		"regressMinSegment=x":                  "Bad regressMinSegment parameter: x",
+		"regressPenalty=1&regressAlpha=y":      "Bad regressAlpha parameter: y",
+		"regressPermutations=0":                "regressPermutations must be > 0",
+		"regressSeasonBins=1000000":            "Bad regressSeasonBins parameter: 1000000",
+		"regressCusumDrift=1&regressAlpha=1.5": "regressAlpha must be <= 1",
+	} {
+		if _, err := MakeRegressionParams("regressPos=1&" + query); (err == nil) || (err.Error() != want) {
+			t.Errorf("%s: got error %v, want %q", query, err, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"github.com/google/tsviewdb/src/common"
+	"strings"
+)
+
+// Triage statuses.
+const (
+	TriageNew          = "new"
+	TriageAcknowledged = "acknowledged"
+	TriageExpected     = "expected"
+	TriageFixed        = "fixed"
+)
+
+var TriageStatuses = map[string]bool{
+	TriageNew:          true,
+	TriageAcknowledged: true,
+	TriageExpected:     true,
+	TriageFixed:        true,
+}
+
+// Triage records what is known about a regression, identified by its source,
+// the metric.aggregate of its column and the id of the record before it (see
+// RegressionSegment).  The end of a recent regression may still move, so EndId
+// is informational.
+type Triage struct {
+	Source  string `json:"source"`
+	Column  string `json:"column"` // See TriageColumn.
+	StartId string `json:"startId"`
+	EndId   string `json:"endId,omitempty"`
+	Status  string `json:"status"`
+	Note    string `json:"note,omitempty"`
+	BugURL  string `json:"bugUrl,omitempty"`
+	User    string `json:"user,omitempty"` // Who last changed it.
+	Updated int64  `json:"updated"`        // Millis.
+}
+
+// Key identifies the regression of t within its source.
+func (t Triage) Key() string {
+	return TriageKey(TriageColumn(t.Column), t.StartId)
+}
+
+// TriageKey identifies a regression within a source.  Ids never contain "|".
+func TriageKey(column, startId string) string {
+	return startId + "|" + column
+}
+
+// TriageColumn returns the metric.aggregate of a column name, without the
+// source or alias prefix of merged or aliased reads, so a regression has the
+// same triage in every read.  A groupBy suffix is kept whole, as its config
+// values may contain ":".
+func TriageColumn(name string) string {
+	base, suffix := common.SplitGroupSuffix(name)
+	return base[strings.LastIndex(base, ":")+1:] + suffix
+}
+
+// TriageLoader returns the triage records of source.
+type TriageLoader func(source string) ([]Triage, error)
+
+// ApplyTriage sets the Metric of each regression segment, and the Triage of
+// each which has one, read from the source of its column in fSrcs.  It drops
+// segments with a status in hide.  Segments without triage have status
+// TriageNew.
+func (d *DataTable) ApplyTriage(fSrcs []FilteredSource, load TriageLoader, hide map[string]bool) error {
+	triages := make(map[string]map[string]Triage) // By source, then key.
+	kept := d.Regressions[:0]
+	for _, seg := range d.Regressions {
+		status := TriageNew
+		source, metric := d.columnOrigin(seg.Column, fSrcs)
+		seg.Metric = metric
+		if (source != "") && (seg.Start.Id != "") {
+			bySource, ok := triages[source]
+			if !ok {
+				records, err := load(source)
+				if err != nil {
+					return err
+				}
+				bySource = make(map[string]Triage)
+				for _, t := range records {
+					if old, ok := bySource[t.Key()]; !ok || (t.Updated > old.Updated) {
+						bySource[t.Key()] = t
+					}
+				}
+				triages[source] = bySource
+			}
+			if t, ok := bySource[TriageKey(metric, seg.Start.Id)]; ok {
+				seg.Triage = &t
+				status = t.Status
+			}
+		}
+		if !hide[status] {
+			kept = append(kept, seg)
+		}
+	}
+	d.Regressions = kept
+	return nil
+}
+
+// columnSource returns the source in fSrcs a data column was read from, or ""
+// if unknown (see ApplyAliases for merged column names).
+func columnSource(name string, fSrcs []FilteredSource) string {
+	if len(fSrcs) == 1 {
+		return fSrcs[0].Source
+	}
+	prefix := name
+	if i := strings.Index(name, ":"); i >= 0 {
+		prefix = name[:i]
+	}
+	for _, fSrc := range fSrcs {
+		if (prefix == fSrc.Source) || (prefix == fSrc.Alias) {
+			return fSrc.Source
+		}
+	}
+	return ""
+}
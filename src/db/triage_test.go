@@ -0,0 +1,108 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyTriage(t *testing.T) {
+	seg := func(column, startId, endId string) RegressionSegment {
+		return RegressionSegment{
+			Column: column,
+			Start:  RegressionPoint{Id: startId},
+			End:    RegressionPoint{Id: endId}}
+	}
+	records := map[string][]Triage{
+		"a/b": {
+			{Source: "a/b", Column: "lat.mean", StartId: "1", EndId: "2", Status: TriageAcknowledged},
+			{Source: "a/b", Column: "lat.mean", StartId: "3", EndId: "4", Status: TriageExpected, Note: "rollout"},
+			// Saved from a merged read, and replaced later.
+			{Source: "a/b", Column: "a/b:lat.max", StartId: "5", Status: TriageFixed, Updated: 1},
+			{Source: "a/b", Column: "lat.max", StartId: "5", Status: TriageExpected, Updated: 2},
+		},
+	}
+	var loads []string
+	load := func(source string) ([]Triage, error) {
+		loads = append(loads, source)
+		return records[source], nil
+	}
+	fSrcs := []FilteredSource{{Source: "a/b"}, {Source: "a/c", Alias: "c"}}
+
+	d := &DataTable{Regressions: []RegressionSegment{
+		seg("a/b:lat.mean", "1", "2"),
+		seg("a/b:lat.mean", "3", "5"), // Grown since triaged.
+		seg("a/b:lat.mean", "4", "5"), // Different regression.
+		seg("a/b:lat.max", "5", "6"),
+		seg("c:lat.mean", "1", "2"),
+	}}
+	if err := d.ApplyTriage(fSrcs, load, map[string]bool{TriageAcknowledged: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"a/b:lat.mean lat.mean 3-5 expected",
+		"a/b:lat.mean lat.mean 4-5 new",
+		"a/b:lat.max lat.max 5-6 expected",
+		"c:lat.mean lat.mean 1-2 new",
+	}
+	if got := triageStatuses(d); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if wantLoads := []string{"a/b", "a/c"}; !reflect.DeepEqual(loads, wantLoads) {
+		t.Errorf("loaded %v, want %v", loads, wantLoads)
+	}
+
+	// The same triage applies to single source and aliased reads.
+	for _, name := range []string{"lat.mean", "b:lat.mean", "p50"} {
+		d = &DataTable{
+			Regressions: []RegressionSegment{seg(name, "3", "4")},
+			Unaliased:   map[string]string{"b:lat.mean": "lat.mean", "p50": "lat.mean"}}
+		if err := d.ApplyTriage([]FilteredSource{{Source: "a/b", Alias: "b"}}, load, nil); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{name + " lat.mean 3-4 expected"}
+		if got := triageStatuses(d); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func triageStatuses(d *DataTable) (statuses []string) {
+	for _, s := range d.Regressions {
+		status := TriageNew
+		if s.Triage != nil {
+			status = s.Triage.Status
+		}
+		statuses = append(statuses, s.Column+" "+s.Metric+" "+s.Start.Id+"-"+s.End.Id+" "+status)
+	}
+	return statuses
+}
+
+func TestTriageColumn(t *testing.T) {
+	for name, want := range map[string]string{
+		"lat.mean":                "lat.mean",
+		"a/b:lat.mean":            "lat.mean",
+		"lat.mean[host=a:80]":     "lat.mean[host=a:80]",
+		"a/b:lat.mean[host=a:80]": "lat.mean[host=a:80]",
+		"p50:lat.mean[port=8080]": "lat.mean[port=8080]",
+	} {
+		if got := TriageColumn(name); got != want {
+			t.Errorf("TriageColumn(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,498 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package expr evaluates arithmetic expressions over named columns.
+package expr
+
+import (
+	"fmt"
+	"github.com/google/tsviewdb/src/column"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError describes a malformed expression.  Pos is the byte offset in
+// Text where the problem was found.
+type SyntaxError struct {
+	Text string
+	Pos  int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Syntax error in expression %q at position %d: %s", e.Text, e.Pos, e.Msg)
+}
+
+// Expr is a parsed arithmetic expression over named columns.
+type Expr struct {
+	Name string // Name of the derived column.
+	Text string // Expression without the name.
+	root node
+}
+
+// Parse takes inputs of the form
+//
+//	[name "="] expression
+//
+// The grammar of expression is:
+//
+//	expression = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/") unary }
+//	unary      = "-" unary | primary
+//	primary    = number | column | function "(" expression { "," expression } ")"
+//	           | "(" expression ")"
+//
+// A column is a column name such as new:latency.p50.  Column names may contain
+// "-" and "/" between other name characters, so separate those operators from
+// names with spaces: "bytes / ops" divides while "bytes/ops" names a column.
+// Names containing other special characters may be double quoted, with a
+// backslash escaping the next character.  The functions are abs, exp, log,
+// sqrt, and min and max of one or more arguments.
+//
+// Without a name the derived column is named by the expression text.  A name
+// contains only letters, digits, "_", "." and "-".
+func Parse(s string) (*Expr, error) {
+	e := &Expr{}
+	offset := 0
+	if i := nameEnd(s); i >= 0 {
+		e.Name = strings.TrimSpace(s[:i])
+		offset = i + 1
+	}
+	e.Text = strings.TrimSpace(s[offset:])
+	if e.Name == "" {
+		e.Name = e.Text
+	}
+	p := &parser{text: s, pos: offset}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("Unexpected %s.", p.tok)
+	}
+	e.root = root
+	return e, nil
+}
+
+// nameEnd returns the index of the "=" ending a leading name, or -1.
+func nameEnd(s string) int {
+	start := true
+	for i, r := range s {
+		switch {
+		case r == '=':
+			if start {
+				return -1
+			}
+			return i
+		case unicode.IsSpace(r):
+			if !start && (strings.TrimSpace(s[i:]) == "" || strings.TrimSpace(s[i:])[0] != '=') {
+				return -1
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-", r):
+			start = false
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// Columns returns the names of the columns referenced by e, in order of first
+// appearance.
+func (e *Expr) Columns() (names []string) {
+	seen := make(map[string]bool)
+	e.root.walk(func(n node) {
+		if c, ok := n.(*colNode); ok && !seen[c.name] {
+			seen[c.name] = true
+			names = append(names, c.name)
+		}
+	})
+	return
+}
+
+// Eval evaluates e over numRows rows, finding columns with lookup, which
+// returns nil for unknown names.  A row is null if any value it depends on is
+// null or its result is not finite, as for division by zero.  Eval binds
+// columns to e, so e must not be evaluated concurrently.
+func (e *Expr) Eval(lookup func(name string) *column.Floats, numRows int) (*column.Floats, error) {
+	var err error
+	e.root.walk(func(n node) {
+		if c, ok := n.(*colNode); ok {
+			c.col = lookup(c.name)
+			if (c.col == nil) && (err == nil) {
+				err = fmt.Errorf("Unknown column in expression %q: %s", e.Text, c.name)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := column.NewFloats(numRows)
+	for i := 0; i < numRows; i++ {
+		v, ok := e.root.eval(i)
+		if ok && !math.IsNaN(v) && !math.IsInf(v, 0) {
+			result.Set(i, v)
+		}
+	}
+	return result, nil
+}
+
+type node interface {
+	eval(row int) (float64, bool)
+	walk(f func(node))
+}
+
+type numNode float64
+
+func (n numNode) eval(row int) (float64, bool) { return float64(n), true }
+func (n numNode) walk(f func(node))            { f(n) }
+
+type colNode struct {
+	name string
+	col  *column.Floats // Set by Eval.
+}
+
+func (n *colNode) eval(row int) (float64, bool) {
+	if row >= n.col.Len() {
+		return 0, false
+	}
+	return n.col.Get(row)
+}
+
+func (n *colNode) walk(f func(node)) { f(n) }
+
+type negNode struct{ x node }
+
+func (n *negNode) eval(row int) (float64, bool) {
+	v, ok := n.x.eval(row)
+	return -v, ok
+}
+
+func (n *negNode) walk(f func(node)) {
+	f(n)
+	n.x.walk(f)
+}
+
+type binaryNode struct {
+	op   rune
+	x, y node
+}
+
+func (n *binaryNode) eval(row int) (float64, bool) {
+	x, ok := n.x.eval(row)
+	if !ok {
+		return 0, false
+	}
+	y, ok := n.y.eval(row)
+	if !ok {
+		return 0, false
+	}
+	switch n.op {
+	case '+':
+		return x + y, true
+	case '-':
+		return x - y, true
+	case '*':
+		return x * y, true
+	default:
+		if y == 0 {
+			return 0, false
+		}
+		return x / y, true
+	}
+}
+
+func (n *binaryNode) walk(f func(node)) {
+	f(n)
+	n.x.walk(f)
+	n.y.walk(f)
+}
+
+type callNode struct {
+	fn   function
+	args []node
+}
+
+func (n *callNode) eval(row int) (float64, bool) {
+	args := make([]float64, len(n.args))
+	for i, a := range n.args {
+		v, ok := a.eval(row)
+		if !ok {
+			return 0, false
+		}
+		args[i] = v
+	}
+	return n.fn.f(args), true
+}
+
+func (n *callNode) walk(f func(node)) {
+	f(n)
+	for _, a := range n.args {
+		a.walk(f)
+	}
+}
+
+type function struct {
+	minArgs, maxArgs int // maxArgs < 0 for no limit.
+	f                func([]float64) float64
+}
+
+func unary(f func(float64) float64) function {
+	return function{1, 1, func(args []float64) float64 { return f(args[0]) }}
+}
+
+var functions = map[string]function{
+	"abs":  unary(math.Abs),
+	"exp":  unary(math.Exp),
+	"log":  unary(math.Log),
+	"sqrt": unary(math.Sqrt),
+	"min": {1, -1, func(args []float64) float64 {
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Min(result, v)
+		}
+		return result
+	}},
+	"max": {1, -1, func(args []float64) float64 {
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Max(result, v)
+		}
+		return result
+	}},
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNum
+	tokName
+	tokOp // One of + - * / ( ) ,
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	num    float64
+	quoted bool
+	pos    int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+type parser struct {
+	text string
+	pos  int
+	tok  token
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{p.text, p.tok.pos, fmt.Sprintf(format, args...)}
+}
+
+// isNameChar reports whether r may appear anywhere in an unquoted name.
+func isNameChar(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune("+-*/(),\"", r)
+}
+
+// next scans the next token into p.tok.
+func (p *parser) next() error {
+	s := p.text
+	for p.pos < len(s) {
+		r, size := utf8.DecodeRuneInString(s[p.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		p.pos += size
+	}
+	start := p.pos
+	if p.pos >= len(s) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return nil
+	}
+	r, size := utf8.DecodeRuneInString(s[p.pos:])
+	switch {
+	case r == '"':
+		var name []rune
+		for p.pos += size; ; p.pos += size {
+			if p.pos >= len(s) {
+				return &SyntaxError{s, start, "Unterminated quote."}
+			}
+			r, size = utf8.DecodeRuneInString(s[p.pos:])
+			if r == '"' {
+				p.pos += size
+				break
+			}
+			if r == '\\' {
+				p.pos += size
+				if p.pos >= len(s) {
+					return &SyntaxError{s, p.pos - size, "Backslash at end of input."}
+				}
+				r, size = utf8.DecodeRuneInString(s[p.pos:])
+			}
+			name = append(name, r)
+		}
+		p.tok = token{kind: tokName, text: string(name), quoted: true, pos: start}
+	case isNameChar(r):
+		prevName := true
+		for p.pos < len(s) {
+			r, size = utf8.DecodeRuneInString(s[p.pos:])
+			if !isNameChar(r) {
+				// "-" and "/" join name characters on both sides.
+				if !prevName || ((r != '-') && (r != '/')) {
+					break
+				}
+				nr, _ := utf8.DecodeRuneInString(s[p.pos+size:])
+				if (p.pos+size >= len(s)) || !isNameChar(nr) {
+					break
+				}
+				prevName = false
+			} else {
+				prevName = true
+			}
+			p.pos += size
+		}
+		text := s[start:p.pos]
+		if num, err := strconv.ParseFloat(text, 64); err == nil {
+			p.tok = token{kind: tokNum, text: text, num: num, pos: start}
+		} else {
+			p.tok = token{kind: tokName, text: text, pos: start}
+		}
+	default:
+		p.pos += size
+		p.tok = token{kind: tokOp, text: string(r), pos: start}
+	}
+	return nil
+}
+
+func (p *parser) isOp(op string) bool {
+	return (p.tok.kind == tokOp) && (p.tok.text == op)
+}
+
+func (p *parser) expression() (node, error) {
+	x, err := p.term()
+	for (err == nil) && (p.isOp("+") || p.isOp("-")) {
+		op := rune(p.tok.text[0])
+		if err = p.next(); err != nil {
+			break
+		}
+		var y node
+		if y, err = p.term(); err == nil {
+			x = &binaryNode{op, x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) term() (node, error) {
+	x, err := p.unary()
+	for (err == nil) && (p.isOp("*") || p.isOp("/")) {
+		op := rune(p.tok.text[0])
+		if err = p.next(); err != nil {
+			break
+		}
+		var y node
+		if y, err = p.unary(); err == nil {
+			x = &binaryNode{op, x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) unary() (node, error) {
+	if !p.isOp("-") {
+		return p.primary()
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &negNode{x}, nil
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokNum:
+		return numNode(tok.num), p.next()
+	case tok.kind == tokName:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if tok.quoted || !p.isOp("(") {
+			return &colNode{name: tok.text}, nil
+		}
+		return p.call(tok)
+	case p.isOp("("):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, p.errorf("Expected \")\" but found %s.", p.tok)
+		}
+		return x, p.next()
+	}
+	return nil, p.errorf("Unexpected %s.", tok)
+}
+
+// call parses the arguments of function fnTok, whose "(" is the current token.
+func (p *parser) call(fnTok token) (node, error) {
+	fn, ok := functions[fnTok.text]
+	if !ok {
+		return nil, &SyntaxError{p.text, fnTok.pos, "Unknown function " + fnTok.String() + "."}
+	}
+	n := &callNode{fn: fn}
+	for {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+		if !p.isOp(",") {
+			break
+		}
+	}
+	if !p.isOp(")") {
+		return nil, p.errorf("Expected \")\" but found %s.", p.tok)
+	}
+	if (len(n.args) < fn.minArgs) || ((fn.maxArgs >= 0) && (len(n.args) > fn.maxArgs)) {
+		return nil, &SyntaxError{p.text, fnTok.pos,
+			fmt.Sprintf("Wrong number of arguments to %s: %d.", fnTok.text, len(n.args))}
+	}
+	return n, p.next()
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expr
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"reflect"
+	"testing"
+)
+
+func f(v float64) *float64 { return &v }
+
+var testColumns = map[string]*column.Floats{
+	"bytes":           column.FloatsFromPtrs([]*float64{f(10), f(20), nil, f(8)}),
+	"ops":             column.FloatsFromPtrs([]*float64{f(2), f(0), f(1), f(4)}),
+	"new:latency.p50": column.FloatsFromPtrs([]*float64{f(5), f(6), f(7), f(8)}),
+	"old:latency.p50": column.FloatsFromPtrs([]*float64{f(4), f(7), f(7), nil}),
+	"a/b:m-1.mean":    column.FloatsFromPtrs([]*float64{f(1), f(2), f(3), f(4)}),
+	"x y":             column.FloatsFromPtrs([]*float64{f(-1), f(1), f(-2), f(2)}),
+}
+
+func lookup(name string) *column.Floats {
+	return testColumns[name]
+}
+
+type evalCase struct {
+	input string
+	name  string
+	want  []*float64
+}
+
+var evalCases = []evalCase{
+	{"bytes / ops", "bytes / ops", []*float64{f(5), nil, nil, f(2)}},
+	{"ratio=bytes / ops", "ratio", []*float64{f(5), nil, nil, f(2)}},
+	{" delta = new:latency.p50 - old:latency.p50", "delta", []*float64{f(1), f(-1), f(0), nil}},
+	{"a/b:m-1.mean*2+1", "a/b:m-1.mean*2+1", []*float64{f(3), f(5), f(7), f(9)}},
+	{"-(ops + 1) * 2", "-(ops + 1) * 2", []*float64{f(-6), f(-2), f(-4), f(-10)}},
+	{"1 - 2 - 3", "1 - 2 - 3", []*float64{f(-4), f(-4), f(-4), f(-4)}},
+	{"2 * 3 + 4 / 2", "2 * 3 + 4 / 2", []*float64{f(8), f(8), f(8), f(8)}},
+	{"1e-1 * ops", "1e-1 * ops", []*float64{f(0.2), f(0), f(0.1), f(0.4)}},
+	{"abs(\"x y\")", "abs(\"x y\")", []*float64{f(1), f(1), f(2), f(2)}},
+	{"m=max(ops, 1, a/b:m-1.mean)", "m", []*float64{f(2), f(2), f(3), f(4)}},
+	{"min(ops)", "min(ops)", []*float64{f(2), f(0), f(1), f(4)}},
+	{"log(ops)", "log(ops)", []*float64{f(0.6931471805599453), nil, f(0), f(1.3862943611198906)}},
+}
+
+func TestEval(t *testing.T) {
+	for _, c := range evalCases {
+		e, err := Parse(c.input)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", c.input, err)
+			continue
+		}
+		if e.Name != c.name {
+			t.Errorf("Parse(%q) name = %q, want %q", c.input, e.Name, c.name)
+		}
+		result, err := e.Eval(lookup, 4)
+		if err != nil {
+			t.Errorf("Eval(%q) error: %v", c.input, err)
+			continue
+		}
+		if want := column.FloatsFromPtrs(c.want); !reflect.DeepEqual(result, want) {
+			t.Errorf("Eval(%q) = %v, want %v", c.input, result.Ptrs(), c.want)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	e, err := Parse("max(bytes, ops) / ops + \"x y\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Columns(), []string{"bytes", "ops", "x y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Columns() = %v, want %v", got, want)
+	}
+}
+
+func TestEvalUnknownColumn(t *testing.T) {
+	e, err := Parse("bytes/ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Eval(lookup, 4); err == nil {
+		t.Error("Expected error for unknown column bytes/ops.")
+	}
+}
+
+var badInputs = []struct {
+	input string
+	pos   int
+}{
+	{"", 0},
+	{"ratio=", 6},
+	{"bytes +", 7},
+	{"(bytes", 6},
+	{"bytes)", 5},
+	{"foo(bytes)", 0},
+	{"abs(bytes, ops)", 0},
+	{"max()", 4},
+	{"\"bytes", 0},
+	{"bytes * * ops", 8},
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range badInputs {
+		_, err := Parse(c.input)
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("Parse(%q) error = %v, want SyntaxError", c.input, err)
+			continue
+		}
+		if serr.Pos != c.pos {
+			t.Errorf("Parse(%q) error position = %d, want %d: %v", c.input, serr.Pos, c.pos, err)
+		}
+	}
+}
@@ -46,6 +46,43 @@ func NewGZipHandler(h http.Handler) http.Handler {
 	})
 }
 
+// StreamWriter writes a response that is sent to the client in pieces as it
+// is generated.  Content is compressed if the client accepts gzip.
+type StreamWriter struct {
+	io.Writer
+	w  http.ResponseWriter
+	gz *gzip.Writer
+}
+
+// NewStreamWriter sets the Content-Encoding header if needed and returns a
+// StreamWriter for w.  Close must be called once the response is complete.
+func NewStreamWriter(w http.ResponseWriter, r *http.Request) *StreamWriter {
+	s := &StreamWriter{Writer: w, w: w}
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		s.gz = gzip.NewWriter(w)
+		s.Writer = s.gz
+	}
+	return s
+}
+
+// Flush sends everything written so far to the client.
+func (s *StreamWriter) Flush() {
+	if s.gz != nil {
+		s.gz.Flush()
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *StreamWriter) Close() error {
+	if s.gz != nil {
+		return s.gz.Close()
+	}
+	return nil
+}
+
 func GzipContent(gzbuff *bytes.Buffer, uncompressedContent []byte) (err error) {
 	gz := gzip.NewWriter(gzbuff)
 	_, err = gz.Write(uncompressedContent)
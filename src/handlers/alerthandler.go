@@ -0,0 +1,144 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/alert"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/handlers/handlerutils"
+	"github.com/google/tsviewdb/src/rangecontent"
+	"net/http"
+	"time"
+)
+
+var alertTick = flag.Duration("alertTick", time.Minute,
+	"How often to check for alert rules due for evaluation.  0 disables alerting.")
+var alertLinkBase = flag.String("alertLinkBase", "",
+	"Prepended to graph links in alerts, e.g. http://tsviewdb:8080.")
+var smtpAddr = flag.String("smtpAddr", "",
+	"SMTP server host:port through which to send alert emails.  Empty disables email.")
+var smtpFrom = flag.String("smtpFrom", "tsviewdb", "Sender of alert emails.")
+
+// startAlerts evaluates the alert rules in d in the background.
+func startAlerts(d db.DB) {
+	if *alertTick <= 0 {
+		return
+	}
+	s := &alert.Scheduler{
+		Store: d,
+		Find: func(rawQuery string) ([]db.RegressionSegment, error) {
+			return rangecontent.FindRegressions(d, rawQuery)
+		},
+		Notifiers: []alert.Notifier{&alert.WebhookNotifier{}},
+		LinkBase:  *alertLinkBase}
+	if *smtpAddr != "" {
+		s.Notifiers = append(s.Notifiers, &alert.SMTPNotifier{Addr: *smtpAddr, From: *smtpFrom})
+	}
+	go s.Run(*alertTick, nil)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// ALERT RULE HANDLER
+
+type AlertHandler DBStruct
+
+func (this *AlertHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tmaster := time.Now()
+
+	name := r.URL.Path[len(common.AlertPath):]
+	glog.V(2).Infoln("alert rule", name)
+
+	switch r.Method {
+	case "GET":
+		this.getHandler(w, name)
+	case "PUT":
+		this.putHandler(w, r, name)
+	case "DELETE":
+		if err := this.D.DeleteAlertRule(name); err != nil {
+			handlerutils.HttpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		handlerutils.HttpError(w, "Bad method: "+r.Method, http.StatusBadRequest)
+		return
+	}
+
+	glog.V(2).Infof("PERF: total service time: %v\n", time.Now().Sub(tmaster))
+}
+
+// getHandler returns the rule with name, or all rules if name is empty.
+func (this *AlertHandler) getHandler(w http.ResponseWriter, name string) {
+	rules, err := this.D.ReadAlertRules()
+	if err != nil {
+		handlerutils.HttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var result interface{} = rules
+	if name != "" {
+		result = nil
+		for _, rule := range rules {
+			if rule.Name == name {
+				result = rule
+			}
+		}
+		if result == nil {
+			handlerutils.HttpError(w, "Unknown alert rule: "+name, http.StatusBadRequest)
+			return
+		}
+	} else if rules == nil {
+		result = []db.AlertRule{}
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(result); err != nil {
+		handlerutils.HttpError(w, "An error occured during JSON marshalling.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b.Bytes())
+}
+
+// putHandler saves the rule in the request body under name.
+func (this *AlertHandler) putHandler(w http.ResponseWriter, r *http.Request, name string) {
+	inputPayload, err := getPayload(r)
+	if err != nil {
+		handlerutils.HttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var rule db.AlertRule
+	if err = json.Unmarshal(inputPayload, &rule); err != nil {
+		handlerutils.HttpError(w, "Malformed PUT data.", http.StatusBadRequest)
+		return
+	}
+	rule.Name = name
+	if err = alert.Validate(rule); err != nil {
+		handlerutils.HttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = this.D.WriteAlertRule(rule); err != nil {
+		handlerutils.HttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
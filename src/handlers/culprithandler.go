@@ -0,0 +1,47 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/cachinghandler"
+	"github.com/google/tsviewdb/src/handlers/handlerutils"
+	"net/http"
+	"time"
+)
+
+/////////////////////////////////////////////////////////////////////////////
+// CULPRIT RANGE HANDLER
+
+// CulpritHandler serves the records bounding a regression (see
+// rangecontent.FindCulprit) as JSON.
+type CulpritHandler DBStruct
+
+func (this *CulpritHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tmaster := time.Now()
+
+	switch r.Method {
+	case "GET":
+		glog.V(2).Infoln("culprit GET handler")
+		cachinghandler.HandleWithCache(w, r, "culprit-json", r.URL.RawQuery)
+	default:
+		handlerutils.HttpError(w, "Bad method: "+r.Method, http.StatusBadRequest)
+		return
+	}
+
+	glog.V(2).Infof("PERF: total service time: %v\n", time.Now().Sub(tmaster))
+}
@@ -81,6 +81,7 @@ func readDir(d db.DB, q url.Values, s string) (db.SourceInfoUncomp, error) {
 	returnMetrics := q.Get("returnMetrics") == "1"
 	returnUnits := q.Get("returnUnits") == "1"
 	returnSelectForDefaults := q.Get("returnSelectForDefaults") == "1"
+	returnRegressionDefaults := q.Get("returnRegressionDefaults") == "1"
 	defaultsOnly := q.Get("defaultsOnly") == "1"
 
 	var prefixMatch bool
@@ -90,14 +91,15 @@ func readDir(d db.DB, q url.Values, s string) (db.SourceInfoUncomp, error) {
 	}
 
 	dirSearchReq := db.DirectorySearchRequest{
-		Prefix:                  s,
-		FileRestrict:            "",
-		ReturnMetrics:           returnMetrics,
-		ReturnUnits:             returnUnits,
-		ReturnSelectForDefaults: returnSelectForDefaults,
-		DefaultsOnly:            defaultsOnly,
-		DirPrefixMatch:          prefixMatch,
-		FilePrefixMatch:         false}
+		Prefix:                   s,
+		FileRestrict:             "",
+		ReturnMetrics:            returnMetrics,
+		ReturnUnits:              returnUnits,
+		ReturnSelectForDefaults:  returnSelectForDefaults,
+		ReturnRegressionDefaults: returnRegressionDefaults,
+		DefaultsOnly:             defaultsOnly,
+		DirPrefixMatch:           prefixMatch,
+		FilePrefixMatch:          false}
 
 	// Directory only search.
 	sInfo, err := d.ReadDir(dirSearchReq)
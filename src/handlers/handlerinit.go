@@ -53,12 +53,28 @@ func initCaches(d db.DB) {
 	cachinghandler.Initialize()
 	cachinghandler.RegisterCacheContentCreator(d, "srcs-json", rangecontent.MakeSrcsJsonContent,
 		"application/json", true)
+	cachinghandler.RegisterCacheContentCreator(d, "srcs-csv", rangecontent.MakeSrcsCsvContent,
+		"text/csv; charset=UTF-8", true)
+	cachinghandler.RegisterCacheContentCreator(d, "srcs-tsv", rangecontent.MakeSrcsTsvContent,
+		"text/tab-separated-values; charset=UTF-8", true)
+	cachinghandler.RegisterCacheContentCreator(d, "srcs-proto", rangecontent.MakeSrcsProtoContent,
+		"application/x-protobuf", true)
 	cachinghandler.RegisterCacheContentCreator(d, "record-json", makeRecordJsonContent,
 		"application/json", true)
+	cachinghandler.RegisterCacheContentCreator(d, "record-csv", makeRecordCsvContent,
+		"text/csv; charset=UTF-8", true)
+	cachinghandler.RegisterCacheContentCreator(d, "record-tsv", makeRecordTsvContent,
+		"text/tab-separated-values; charset=UTF-8", true)
 	cachinghandler.RegisterCacheContentCreator(d, "srcs-inline-graph", rangecontent.MakeSrcsInlineGraphContent,
 		"text/html; charset=UTF-8", true)
 	cachinghandler.RegisterCacheContentCreator(d, "srcs-png", rangecontent.MakeSrcsPngContent,
 		"image/png", false)
+	cachinghandler.RegisterCacheContentCreator(d, "scan-json", rangecontent.MakeScanJsonContent,
+		"application/json", true)
+	cachinghandler.RegisterCacheContentCreator(d, "culprit-json", rangecontent.MakeCulpritJsonContent,
+		"application/json", true)
+	cachinghandler.RegisterCacheContentCreator(d, "backtest-json", rangecontent.MakeBacktestJsonContent,
+		"application/json", true)
 }
 
 func InitializeAndRegister(d db.DB) {
@@ -71,6 +87,12 @@ func InitializeAndRegister(d db.DB) {
 	http.Handle(common.SrcsPath, srcHandler)
 	http.Handle(common.RecordPath, &RecordHandler{D: d})
 	http.Handle(common.DirPath, gziphandler.NewGZipHandler(&DirHandler{D: d}))
+	http.Handle(common.ScanPath, &ScanHandler{D: d})
+	http.Handle(common.AlertPath, &AlertHandler{D: d})
+	http.Handle(common.TriagePath, &TriageHandler{D: d})
+	http.Handle(common.CulpritPath, &CulpritHandler{D: d})
+	http.Handle(common.BacktestPath, &BacktestHandler{D: d})
 	http.Handle(common.SearchPath, gziphandler.NewGZipHandler(&SearchHandler{D: d}))
 	http.Handle("/", NewFileHandler(*resourceDir))
+	startAlerts(d)
 }
@@ -18,7 +18,9 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/google/tsviewdb/src/cachinghandler"
@@ -27,6 +29,8 @@ import (
 	"github.com/google/tsviewdb/src/db/requests"
 	"github.com/google/tsviewdb/src/handlers/handlerutils"
 	"net/http"
+	"net/url"
+	"sort"
 	"time"
 )
 
@@ -55,7 +59,17 @@ func (this *RecordHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (this *RecordHandler) getHandler(w http.ResponseWriter, r *http.Request, rawQuery string) {
-	cachinghandler.HandleWithCache(w, r, "record-json", rawQuery)
+	t := r.URL.Query().Get("type")
+	switch t {
+	case "", "json":
+		cachinghandler.HandleWithCache(w, r, "record-json", rawQuery)
+	case "csv":
+		cachinghandler.HandleWithCache(w, r, "record-csv", rawQuery)
+	case "tsv":
+		cachinghandler.HandleWithCache(w, r, "record-tsv", rawQuery)
+	default:
+		handlerutils.HttpError(w, "Bad record 'type' parameter: "+t, http.StatusBadRequest)
+	}
 }
 
 func makeRecordJsonContent(d db.DB, b *bytes.Buffer, rawQuery string) (err error) {
@@ -81,6 +95,112 @@ func makeRecordJsonContent(d db.DB, b *bytes.Buffer, rawQuery string) (err error
 	return nil
 }
 
+func makeRecordCsvContent(d db.DB, b *bytes.Buffer, rawQuery string) error {
+	return makeRecordDelimitedContent(d, b, rawQuery, ',')
+}
+
+func makeRecordTsvContent(d db.DB, b *bytes.Buffer, rawQuery string) error {
+	return makeRecordDelimitedContent(d, b, rawQuery, '\t')
+}
+
+// makeRecordDelimitedContent writes either the points table of a record (one
+// line per point timestamp) or its aggregates (a single line) with fields
+// separated by comma.  The query parameter "table" selects "points" or
+// "aggregates"; by default points are written if the record has any.  Id and
+// config columns are added with returnIds=1 and returnConfigs=1.
+func makeRecordDelimitedContent(d db.DB, b *bytes.Buffer, rawQuery string, comma rune) error {
+	req, err := requests.MakeRowReq(rawQuery)
+	if err != nil {
+		return err
+	}
+	q, _ := url.ParseQuery(rawQuery)
+	humanTime := q.Get("humanTime") == "1"
+	returnIds := q.Get("returnIds") == "1"
+	returnConfigs := q.Get("returnConfigs") == "1"
+	table := q.Get("table")
+
+	t2 := time.Now()
+	rec, err := d.ReadRow(req)
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("PERF: DB read time: %v\n", time.Now().Sub(t2))
+
+	if table == "" {
+		table = "aggregates"
+		if len(rec.Points) > 0 {
+			table = "points"
+		}
+	}
+
+	var configKeys []string
+	if returnConfigs {
+		for k := range rec.ConfigPairs {
+			configKeys = append(configKeys, k)
+		}
+		sort.Strings(configKeys)
+	}
+
+	// Fields before and after the data fields are the same on every line.
+	var header, prefix, suffix []string
+	if returnIds {
+		header = append(header, "id")
+		prefix = append(prefix, req.Id) // ReadRow does not set rec.Id.
+	}
+	for _, k := range configKeys {
+		suffix = append(suffix, rec.ConfigPairs[k])
+	}
+
+	cw := csv.NewWriter(b)
+	cw.Comma = comma
+	writeLine := func(fields []string) error {
+		line := append(append(append([]string{}, prefix...), fields...), suffix...)
+		return cw.Write(line)
+	}
+
+	switch table {
+	case "points":
+		if err := cw.Write(append(append(header, rec.PointsColumnNames...), configKeys...)); err != nil {
+			return err
+		}
+		for _, rowPtr := range rec.Points {
+			fields := make([]string, len(rec.PointsColumnNames))
+			for i, val := range *rowPtr {
+				if (i == 0) && (val != nil) { // Time column.
+					fields[i] = common.FormatMillis(int64(*val), humanTime)
+				} else {
+					fields[i] = common.FormatFloatPtr(val)
+				}
+			}
+			if err := writeLine(fields); err != nil {
+				return err
+			}
+		}
+	case "aggregates":
+		header = append(append(header, common.TimeName), rec.AggregatesColumnNames...)
+		if err := cw.Write(append(header, configKeys...)); err != nil {
+			return err
+		}
+		var fields []string
+		if rec.RecordTimestamp != nil {
+			fields = append(fields, common.FormatMillis(*rec.RecordTimestamp, humanTime))
+		} else {
+			fields = append(fields, "")
+		}
+		for _, val := range rec.Aggregates {
+			fields = append(fields, common.FormatFloatPtr(val))
+		}
+		if err := writeLine(fields); err != nil {
+			return err
+		}
+	default:
+		return errors.New("Bad record 'table' parameter: " + table)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
 func (this *RecordHandler) deleteHandler(w http.ResponseWriter, id string) {
 	glog.V(3).Infof("Deleting id: %s", id)
 	if err := this.D.DeleteRow(id); err != nil {
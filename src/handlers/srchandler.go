@@ -19,12 +19,15 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/google/tsviewdb/src/cachinghandler"
 	"github.com/google/tsviewdb/src/common"
 	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/gziphandler"
 	"github.com/google/tsviewdb/src/handlers/handlerutils"
+	"github.com/google/tsviewdb/src/rangecontent"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -37,6 +40,10 @@ const (
 	maxInputSize = 2 << 24 // 16MB max input payload size for PUT or POST.
 )
 
+var streamMinResults = flag.Int("streamMinResults", 0,
+	"JSON range reads for at least this many results are streamed (uncached) as "+
+		"newline-delimited JSON when their parameters allow.  0 disables.")
+
 type DBStruct struct {
 	D db.DB
 }
@@ -99,6 +106,10 @@ func (this *SrcHandler) putHandler(w http.ResponseWriter, r *http.Request, src s
 			return
 		}
 	}
+	if err = validateRegressionDefaults(sInfo); err != nil {
+		handlerutils.HttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if err = this.D.WriteDir(sInfo, src); err != nil {
 		handlerutils.HttpError(w, err.Error(), http.StatusBadRequest)
@@ -106,6 +117,26 @@ func (this *SrcHandler) putHandler(w http.ResponseWriter, r *http.Request, src s
 	}
 }
 
+// validateRegressionDefaults returns an error if the regression defaults of
+// sInfo are not one per metric or are out of range.
+func validateRegressionDefaults(sInfo db.SourceInfoUncomp) error {
+	if len(sInfo.RegressionDefaults) == 0 {
+		return nil
+	}
+	if len(sInfo.RegressionDefaults) != len(sInfo.Names) {
+		return errors.New("Need one regressionDefaults entry per name.")
+	}
+	for i, o := range sInfo.RegressionDefaults {
+		if o == nil {
+			continue
+		}
+		if err := o.Validate(); err != nil {
+			return errors.New(sInfo.Names[i] + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
 func (this *SrcHandler) postHandler(w http.ResponseWriter, r *http.Request, src string) {
 	glog.V(2).Infoln("src POST handler")
 	inputPayload, err := getPayload(r)
@@ -151,8 +182,46 @@ func (this *SrcHandler) getHandler(w http.ResponseWriter, r *http.Request) {
 	case "inline-graph":
 		cachinghandler.HandleWithCache(w, r, "srcs-inline-graph", rawQuery)
 	case "json":
+		if q.Get("stream") == "1" {
+			req, err := rangecontent.MakeStreamReq(rawQuery)
+			if err != nil {
+				handlerutils.HttpError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			this.streamHandler(w, r, req)
+			return
+		}
+		if *streamMinResults > 0 {
+			// Stream large reads when possible; otherwise fall through to the cache.
+			req, err := rangecontent.MakeStreamReq(rawQuery)
+			if (err == nil) && (req.MaxResults >= *streamMinResults) {
+				this.streamHandler(w, r, req)
+				return
+			}
+		}
 		cachinghandler.HandleWithCache(w, r, "srcs-json", rawQuery)
+	case "csv":
+		cachinghandler.HandleWithCache(w, r, "srcs-csv", rawQuery)
+	case "tsv":
+		cachinghandler.HandleWithCache(w, r, "srcs-tsv", rawQuery)
+	case "proto":
+		cachinghandler.HandleWithCache(w, r, "srcs-proto", rawQuery)
 	default:
 		handlerutils.HttpError(w, "Bad srcs 'type' parameter: "+t, http.StatusBadRequest)
 	}
 }
+
+// streamHandler writes rows as newline-delimited JSON as they are read,
+// bypassing the cache.
+func (this *SrcHandler) streamHandler(w http.ResponseWriter, r *http.Request, req db.RowRangeRequests) {
+	glog.V(2).Infoln("src GET stream handler")
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	sw := gziphandler.NewStreamWriter(w, r)
+	if err := rangecontent.StreamSrcsJsonContent(this.D, sw, sw.Flush, req); err != nil {
+		// Nothing has been written yet, so an error status may still be sent.
+		handlerutils.HttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sw.Close()
+}
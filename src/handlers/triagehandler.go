@@ -0,0 +1,122 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/handlers/handlerutils"
+	"net/http"
+	"time"
+)
+
+/////////////////////////////////////////////////////////////////////////////
+// REGRESSION TRIAGE HANDLER
+
+type TriageHandler DBStruct
+
+func (this *TriageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tmaster := time.Now()
+
+	src := r.URL.Path[len(common.TriagePath):]
+	glog.V(2).Infoln("triage src", src)
+	if src == "" {
+		handlerutils.HttpError(w, "No source selected.", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		this.getHandler(w, r, src)
+	case "PUT":
+		this.putHandler(w, r, src)
+	default:
+		handlerutils.HttpError(w, "Bad method: "+r.Method, http.StatusBadRequest)
+		return
+	}
+
+	glog.V(2).Infof("PERF: total service time: %v\n", time.Now().Sub(tmaster))
+}
+
+// getHandler returns the triage records of src, only those of the column
+// parameter if set (see db.TriageColumn).
+func (this *TriageHandler) getHandler(w http.ResponseWriter, r *http.Request, src string) {
+	triages, err := this.D.ReadTriages(src)
+	if err != nil {
+		handlerutils.HttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := []db.Triage{}
+	column := db.TriageColumn(r.URL.Query().Get("column"))
+	for _, t := range triages {
+		if (column == "") || (db.TriageColumn(t.Column) == column) {
+			result = append(result, t)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(result); err != nil {
+		handlerutils.HttpError(w, "An error occured during JSON marshalling.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b.Bytes())
+}
+
+// putHandler saves the triage record in the request body for src, replacing
+// any for the same regression.  Its column is stored as metric.aggregate (see
+// db.TriageColumn): give the metric of the regression segment, as the column
+// of a segment read with a single column alias is the alias only.
+func (this *TriageHandler) putHandler(w http.ResponseWriter, r *http.Request, src string) {
+	inputPayload, err := getPayload(r)
+	if err != nil {
+		handlerutils.HttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var t db.Triage
+	if err = json.Unmarshal(inputPayload, &t); err != nil {
+		handlerutils.HttpError(w, "Malformed PUT data.", http.StatusBadRequest)
+		return
+	}
+	t.Source = src
+	t.Column = db.TriageColumn(t.Column)
+	t.Updated = time.Now().UnixNano() / 1e6 // Millis.
+	if err = validateTriage(t); err != nil {
+		handlerutils.HttpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = this.D.WriteTriage(t); err != nil {
+		handlerutils.HttpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func validateTriage(t db.Triage) error {
+	switch {
+	case (t.Column == "") || (t.StartId == ""):
+		return errors.New("Triage needs a column and startId.")
+	case !db.TriageStatuses[t.Status]:
+		return errors.New("Bad triage status: " + t.Status)
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 	"code.google.com/p/plotinum/plotter"
 	"code.google.com/p/plotinum/vg"
 	"code.google.com/p/plotinum/vg/vgimg"
+	"errors"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/google/tsviewdb/src/common"
@@ -158,14 +159,14 @@ func DataTableToPng(b *bytes.Buffer, dt *db.DataTable, title string, width, heig
 	numColumns := len(dt.ColumnNames)
 	lines := make([]plotter.XYs, numColumns-1) // Skip X column.
 
-	for _, dRow := range dt.Data {
-		xp := (*dRow)[0]
-		if xp != nil {
-			for col := 1; col < numColumns; col++ { // Skip X column.
-				yp := (*dRow)[col]
-				if yp != nil {
-					lines[col-1] = append(lines[col-1], struct{ X, Y float64 }{X: *xp, Y: *yp})
-				}
+	for row := 0; row < dt.NumRows(); row++ {
+		x, ok := dt.Data[0].Get(row)
+		if !ok {
+			continue
+		}
+		for col := 1; col < numColumns; col++ { // Skip X column.
+			if y, ok := dt.Data[col].Get(row); ok {
+				lines[col-1] = append(lines[col-1], struct{ X, Y float64 }{X: x, Y: y})
 			}
 		}
 	}
@@ -195,6 +196,64 @@ func DataTableToPng(b *bytes.Buffer, dt *db.DataTable, title string, width, heig
 	return nil
 }
 
+// GroupStatsToPng draws a bar chart of the means in dt, a table from
+// db.GroupStats, with a bar for each column in each group.
+func GroupStatsToPng(b *bytes.Buffer, dt *db.DataTable, title string, width, height float64) error {
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+
+	p.Title.Text = title
+	p.Y.Label.Text = db.StatMean
+	p.Legend.Top = true
+
+	numRows := dt.NumRows()
+	labels := make([]string, numRows)
+	for row := range labels {
+		var parts []string
+		for k, c := range dt.Configs {
+			v, _ := c.Get(row)
+			parts = append(parts, dt.ConfigsColumnNames[k]+"="+v)
+		}
+		labels[row] = strings.Join(parts, ",")
+	}
+
+	var meanColumns []int
+	for i, name := range dt.ColumnNames {
+		if strings.HasSuffix(name, "."+db.StatMean) {
+			meanColumns = append(meanColumns, i)
+		}
+	}
+	if (numRows == 0) || (len(meanColumns) == 0) {
+		return errors.New("No groups to plot.")
+	}
+
+	// Bars of a group share 80% of the width available to the group.
+	barWidth := vg.Inches(width) * 0.8 / vg.Length(numRows*len(meanColumns))
+	colorList := getColors(len(meanColumns))
+	for j, i := range meanColumns {
+		values := make(plotter.Values, numRows)
+		for row := range values {
+			values[row], _ = dt.Data[i].Get(row) // Null is 0.
+		}
+		bars, err := plotter.NewBarChart(values, barWidth)
+		if err != nil {
+			return err
+		}
+		bars.Color = colorList[j]
+		bars.Offset = barWidth * vg.Length(float64(j)-float64(len(meanColumns)-1)/2)
+		p.Add(bars)
+		p.Legend.Add(strings.TrimSuffix(dt.ColumnNames[i], "."+db.StatMean), bars)
+	}
+	p.NominalX(labels...)
+
+	tPng := time.Now()
+	drawPng(b, p, width, height)
+	glog.V(3).Infof("PERF: makePng time: %v", time.Now().Sub(tPng))
+	return nil
+}
+
 func getColors(n int) []color.Color {
 	// From this discussion:
 	//   http://martin.ankerl.com/2009/12/09/how-to-create-random-colors-programmatically/
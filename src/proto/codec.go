@@ -271,6 +271,20 @@ func (m *Aggregation) SetDoubleField(field string, value *float64) {
 	}
 }
 
+var doubleFields = map[string]bool{
+	"count": true, "min": true, "max": true, "mean": true, "stdev": true,
+	"p99": true, "p95": true, "p90": true, "p85": true, "p80": true, "p75": true,
+	"p70": true, "p65": true, "p60": true, "p55": true, "p50": true, "p45": true,
+	"p40": true, "p35": true, "p30": true, "p25": true, "p20": true, "p15": true,
+	"p10": true, "p5": true, "p1": true,
+}
+
+// IsDoubleField returns true if field names an aggregate that can be set with
+// SetDoubleField.
+func IsDoubleField(field string) bool {
+	return doubleFields[field]
+}
+
 type fieldsAndValues struct {
 	fields []string
 	values []*float64
@@ -567,11 +567,12 @@ func (m *Points) GetDeltaTimestamps() []int64 {
 }
 
 type SourceInfo struct {
-	UnitsMap          []string `protobuf:"bytes,1,rep,name=units_map" json:"units_map,omitempty"`
-	MetricNames       []string `protobuf:"bytes,2,rep,name=metric_names" json:"metric_names,omitempty"`
-	UnitsIndices      []int32  `protobuf:"varint,3,rep,packed,name=units_indices" json:"units_indices,omitempty"`
-	SelectForDefaults []bool   `protobuf:"varint,4,rep,name=select_for_defaults" json:"select_for_defaults,omitempty"`
-	XXX_unrecognized  []byte   `json:"-"`
+	UnitsMap           []string              `protobuf:"bytes,1,rep,name=units_map" json:"units_map,omitempty"`
+	MetricNames        []string              `protobuf:"bytes,2,rep,name=metric_names" json:"metric_names,omitempty"`
+	UnitsIndices       []int32               `protobuf:"varint,3,rep,packed,name=units_indices" json:"units_indices,omitempty"`
+	SelectForDefaults  []bool                `protobuf:"varint,4,rep,name=select_for_defaults" json:"select_for_defaults,omitempty"`
+	RegressionDefaults []*RegressionDefaults `protobuf:"bytes,5,rep,name=regression_defaults" json:"regression_defaults,omitempty"`
+	XXX_unrecognized   []byte                `json:"-"`
 }
 
 func (m *SourceInfo) Reset()         { *m = SourceInfo{} }
@@ -606,6 +607,77 @@ func (m *SourceInfo) GetSelectForDefaults() []bool {
 	return nil
 }
 
+func (m *SourceInfo) GetRegressionDefaults() []*RegressionDefaults {
+	if m != nil {
+		return m.RegressionDefaults
+	}
+	return nil
+}
+
+type RegressionDefaults struct {
+	Pos              *float64 `protobuf:"fixed64,1,opt,name=pos" json:"pos,omitempty"`
+	Neg              *float64 `protobuf:"fixed64,2,opt,name=neg" json:"neg,omitempty"`
+	UsePercent       *bool    `protobuf:"varint,3,opt,name=use_percent" json:"use_percent,omitempty"`
+	IgnoreLt         *float64 `protobuf:"fixed64,4,opt,name=ignore_lt" json:"ignore_lt,omitempty"`
+	Window           *int32   `protobuf:"varint,5,opt,name=window" json:"window,omitempty"`
+	Radius           *int32   `protobuf:"varint,6,opt,name=radius" json:"radius,omitempty"`
+	SeasonBins       *int32   `protobuf:"varint,7,opt,name=season_bins" json:"season_bins,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *RegressionDefaults) Reset()         { *m = RegressionDefaults{} }
+func (m *RegressionDefaults) String() string { return proto.CompactTextString(m) }
+func (*RegressionDefaults) ProtoMessage()    {}
+
+func (m *RegressionDefaults) GetPos() float64 {
+	if m != nil && m.Pos != nil {
+		return *m.Pos
+	}
+	return 0
+}
+
+func (m *RegressionDefaults) GetNeg() float64 {
+	if m != nil && m.Neg != nil {
+		return *m.Neg
+	}
+	return 0
+}
+
+func (m *RegressionDefaults) GetUsePercent() bool {
+	if m != nil && m.UsePercent != nil {
+		return *m.UsePercent
+	}
+	return false
+}
+
+func (m *RegressionDefaults) GetIgnoreLt() float64 {
+	if m != nil && m.IgnoreLt != nil {
+		return *m.IgnoreLt
+	}
+	return 0
+}
+
+func (m *RegressionDefaults) GetWindow() int32 {
+	if m != nil && m.Window != nil {
+		return *m.Window
+	}
+	return 0
+}
+
+func (m *RegressionDefaults) GetRadius() int32 {
+	if m != nil && m.Radius != nil {
+		return *m.Radius
+	}
+	return 0
+}
+
+func (m *RegressionDefaults) GetSeasonBins() int32 {
+	if m != nil && m.SeasonBins != nil {
+		return *m.SeasonBins
+	}
+	return 0
+}
+
 type Expires struct {
 	RowTtlInSecs     *int32 `protobuf:"varint,1,opt,name=row_ttl_in_secs" json:"row_ttl_in_secs,omitempty"`
 	PointsTtlInSecs  *int32 `protobuf:"varint,2,opt,name=points_ttl_in_secs" json:"points_ttl_in_secs,omitempty"`
@@ -0,0 +1,125 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangecontent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/backtest"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/db/requests"
+	"github.com/google/tsviewdb/src/regress"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BacktestResults holds the scores of each data column of a backtest.
+type BacktestResults struct {
+	Labels   backtest.Labels   `json:"labels"`
+	Settings int               `json:"settings"` // Number of settings swept.
+	Metrics  []backtest.Metric `json:"metrics"`
+}
+
+func MakeBacktestJsonContent(d db.DB, b *bytes.Buffer, rawQuery string) error {
+	results, err := Backtest(d, rawQuery)
+	if err != nil {
+		return err
+	}
+
+	t := time.Now()
+	if err := json.NewEncoder(b).Encode(results); err != nil {
+		return err
+	}
+	glog.V(2).Infof("PERF: JSON marshal time: %v\n", time.Now().Sub(t))
+	return nil
+}
+
+// Backtest sweeps regression parameters over each data column of a range read
+// (see backtest.Sweep), scoring them against the labels of
+// requests.MakeBacktestLabels, with the values of requests.MakeBacktestGrid.
+// Other regression parameters, such as regressIgnoreLT or regressSeason, apply
+// to every setting.  At most maxScores scores of each column are returned if
+// set.
+func Backtest(d db.DB, rawQuery string) (results BacktestResults, err error) {
+	q, _ := url.ParseQuery(rawQuery)
+	if results.Labels, err = requests.MakeBacktestLabels(rawQuery); err != nil {
+		return results, err
+	}
+	grid, err := requests.MakeBacktestGrid(rawQuery)
+	if err != nil {
+		return results, err
+	}
+	maxScores := 0
+	if maxStr := q.Get("maxScores"); maxStr != "" {
+		if maxScores, err = strconv.Atoi(maxStr); (err != nil) || (maxScores < 1) {
+			return results, errors.New("Bad maxScores parameter: " + maxStr)
+		}
+	}
+
+	params := make(url.Values)
+	for k, v := range q {
+		if strings.HasPrefix(k, "regress") {
+			params[k] = v
+		}
+	}
+	if params.Get("regressAlgo") == "" {
+		params.Set("regressAlgo", regress.AlgoWindow) // Selects the other parameters.
+	}
+	base, err := requests.MakeRegressionParams(params.Encode())
+	if err != nil {
+		return results, err
+	}
+
+	req, err := requests.MakeRowRangeReqs(rawQuery)
+	if err != nil {
+		return results, err
+	}
+	dTable, err := getDataTableRaw(d, &req)
+	if err != nil {
+		return results, err
+	}
+	if err = dTable.ApplyAliases(req.FilteredSources); err != nil {
+		return results, err
+	}
+	dTable.SortRows(0) // Ascending time.
+
+	tSweep := time.Now()
+	settings := grid.Settings()
+	results.Settings = len(settings)
+	results.Metrics = []backtest.Metric{}
+	for i := 1; i < len(dTable.ColumnNames); i++ { // Skip X column.
+		if dTable.ColumnNames[i] == common.RecordNumName {
+			continue
+		}
+		scores := backtest.Sweep(dTable.Data[0], dTable.Data[i], base, grid, results.Labels)
+		recommended := backtest.Recommend(scores)
+		if (maxScores > 0) && (len(scores) > maxScores) {
+			scores = scores[:maxScores]
+		}
+		results.Metrics = append(results.Metrics, backtest.Metric{
+			Column:      dTable.ColumnNames[i],
+			Recommended: recommended,
+			Scores:      scores})
+	}
+	glog.V(2).Infof("PERF: backtest sweep time: %v, %d settings\n", time.Now().Sub(tSweep), len(settings))
+	return results, nil
+}
@@ -22,21 +22,33 @@ import (
 	"github.com/google/tsviewdb/src/common"
 	"github.com/google/tsviewdb/src/db"
 	"github.com/google/tsviewdb/src/db/requests"
+	"github.com/google/tsviewdb/src/regress"
 	"net/url"
+	"strings"
 	"time"
 )
 
 // getDataTableRaw returns a db.DataTable with the X-axis as time, all other
-// columns sorted by name, and no specified row order.
-func getDataTableRaw(D db.DB, req db.RowRangeRequests) (dTable *db.DataTable, err error) {
+// columns sorted by name, and no specified row order.  Source patterns in req
+// are expanded.
+func getDataTableRaw(D db.DB, req *db.RowRangeRequests) (dTable *db.DataTable, err error) {
 	t2 := time.Now()
 	if len(req.FilteredSources) == 0 {
 		return dTable, errors.New("No sources selected.")
 	}
-	dTable, err = D.ReadRows(req)
+	expanded, err := requests.ExpandSources(D, req)
 	if err != nil {
 		return nil, err
 	}
+	dTable, err = D.ReadRows(*req)
+	if err != nil {
+		return nil, err
+	}
+	if expanded {
+		for _, fSrc := range req.FilteredSources {
+			dTable.Sources = append(dTable.Sources, fSrc.Source)
+		}
+	}
 
 	t1 := time.Now()
 
@@ -51,35 +63,151 @@ func getDataTableRaw(D db.DB, req db.RowRangeRequests) (dTable *db.DataTable, er
 	t2Delay := time.Now().Sub(t2)
 	glog.V(2).Infof("PERF: DB read time: %v\n", t2Delay)
 	if glog.V(2) && t2Delay.Seconds() > 0 && len(dTable.ColumnNames) > 0 {
-		glog.Infof("PERF: DB row reads/sec: %d\n", int64(float64(len(dTable.Data))/t2Delay.Seconds()))
+		glog.Infof("PERF: DB row reads/sec: %d\n", int64(float64(dTable.NumRows())/t2Delay.Seconds()))
 	}
 	return dTable, nil
 }
 
+// pointsLoader returns a db.PointsLoader reading records from D.  Records are
+// cached because regressions in several columns often share them.
+func pointsLoader(D db.DB) db.PointsLoader {
+	records := make(map[string]*db.ReadRecord)
+	return func(id, source, metric string) (points []float64, err error) {
+		if id == "" {
+			return nil, nil
+		}
+		record, ok := records[id]
+		if !ok {
+			if record, err = D.ReadRow(db.RowRequest{Id: id, NoReturnAggregates: true}); err != nil {
+				return nil, err
+			}
+			records[id] = record
+		}
+		if (source != "") && ((record.Source == nil) || (*record.Source != source)) {
+			return nil, nil
+		}
+		for i, name := range record.PointsColumnNames {
+			if name != metric {
+				continue
+			}
+			for _, row := range record.Points {
+				if (i < len(*row)) && ((*row)[i] != nil) {
+					points = append(points, *(*row)[i])
+				}
+			}
+		}
+		return points, nil
+	}
+}
+
+// regressionDefaultsLoader returns a db.RegressionDefaultsLoader reading the
+// directory of D.
+func regressionDefaultsLoader(D db.DB) db.RegressionDefaultsLoader {
+	return func(source string) (map[string]*regress.Override, error) {
+		path, file := common.GetSrcComponents(source)
+		sInfo, err := D.ReadDir(db.DirectorySearchRequest{
+			Prefix:                   path,
+			FileRestrict:             file,
+			ReturnMetrics:            true,
+			ReturnRegressionDefaults: true})
+		if err != nil {
+			return nil, err
+		}
+		defaults := make(map[string]*regress.Override)
+		for i, name := range sInfo.Names { // Of the form path/file:metric.
+			if (i < len(sInfo.RegressionDefaults)) && (sInfo.RegressionDefaults[i] != nil) {
+				base := name[strings.LastIndex(name, "/")+1:]
+				metric := base[strings.Index(base, ":")+1:]
+				defaults[metric] = sInfo.RegressionDefaults[i]
+			}
+		}
+		return defaults, nil
+	}
+}
+
 // getDataTable returns a db.Datatable with the X-axis as specified and rows
-// sorted by the X-axis.
+// sorted by the X-axis, or the statistics of groups of rows when requested.
 func getDataTable(D db.DB, rawQuery string) (dTable *db.DataTable, err error) {
 	req, err := requests.MakeRowRangeReqs(rawQuery)
 	if err != nil {
 		return nil, err
 	}
-	dTable, err = getDataTableRaw(D, req)
+	statsBy := requests.MakeStatsBy(rawQuery)
+	if len(statsBy) > 0 {
+		req.ReturnConfigs = true // Needed to group.
+	}
+	exprs, err := requests.MakeExpressions(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	transforms, err := requests.MakeTransforms(rawQuery)
 	if err != nil {
 		return nil, err
 	}
-
 	regressParams, err := requests.MakeRegressionParams(rawQuery)
 	if err != nil {
 		return nil, err
 	}
+	sig, err := requests.MakeSignificance(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	hide, err := requests.MakeTriageHide(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	if regressParams.Selected && ((regressParams.Format == regress.FormatSegments) || (sig != nil)) {
+		req.ReturnIds = true // Identifies the records of each regression.
+	}
+	dTable, err = getDataTableRaw(D, &req)
+	if err != nil {
+		return nil, err
+	}
+	if regressParams.UseDefaults {
+		if err = dTable.SetRegressionDefaults(req.FilteredSources, regressionDefaultsLoader(D)); err != nil {
+			return nil, err
+		}
+	}
+	if err = dTable.ApplyAliases(req.FilteredSources); err != nil {
+		return nil, err
+	}
+	// Derive expression columns before regression detection so they get
+	// regressions too.
+	for _, e := range exprs {
+		if err = dTable.AddExprColumn(e); err != nil {
+			return nil, err
+		}
+	}
+
+	// Transforms such as moving averages and differences depend on row order.
+	// When rows stay in time order, apply them before regression detection so
+	// regressions are found in, and describe, the transformed values.
+	timeSort := req.SortByColumn == common.TimeName
+	transformFirst := regressParams.Selected && timeSort && (req.SortByConfig == "")
+
 	if regressParams.Selected {
 		// Regression detection needs an ascending time sort, so perform this first
 		// when the X-axis is already time.
 		dTable.SortRows(0)
-		dTable.GetVerifiedRegression(regressParams)
+		if transformFirst {
+			dTable.Transform(transforms, false)
+		}
+		if sig != nil {
+			sig.Load = pointsLoader(D)
+			sig.Sources = req.FilteredSources
+			if err = dTable.GetSignificantRegression(regressParams, *sig); err != nil {
+				return nil, err
+			}
+		} else {
+			dTable.GetVerifiedRegression(regressParams)
+		}
+		if regressParams.Format == regress.FormatSegments {
+			if err = dTable.ApplyTriage(req.FilteredSources, D.ReadTriages, hide); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	timeSort := req.SortByColumn == common.TimeName
 	if !timeSort {
 		if err = dTable.ChangeXAxisToColumnFromTime(req.SortByColumn); err != nil {
 			return nil, err
@@ -103,11 +231,29 @@ func getDataTable(D db.DB, rawQuery string) (dTable *db.DataTable, err error) {
 		dTable.SortRowsStable(0)
 	}
 
+	// Otherwise apply transforms once sorted.  Regression columns keep the
+	// untransformed regression values, but segments follow their transformed
+	// columns.
+	if !transformFirst {
+		dTable.Transform(transforms, regressParams.Selected && regressParams.ReturnSegments)
+	}
+
+	if len(statsBy) > 0 {
+		tStats := time.Now()
+		if dTable, err = dTable.GroupStats(statsBy); err != nil {
+			return nil, err
+		}
+		glog.V(2).Infof("PERF: group statistics time: %v\n", time.Now().Sub(tStats))
+	}
+
 	q, _ := url.ParseQuery(rawQuery)
 	reverse := q.Get("reverse") == "1"
 	if reverse {
 		dTable.ReverseRows()
 	}
+	if len(statsBy) > 0 { // X is the group number.
+		return dTable, nil
+	}
 
 	if req.EqualX { // Only perform after all sorting is done.
 		tAddColumn := time.Now()
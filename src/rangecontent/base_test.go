@@ -0,0 +1,44 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangecontent
+
+import (
+	"github.com/google/tsviewdb/src/db"
+	"testing"
+)
+
+func TestTransformedRegressionSegments(t *testing.T) {
+	d := &fakeDB{tables: map[string]*db.DataTable{
+		"d/a": stepTable("lat.mean", 100, 100, 100, 200, 200, 200)}}
+
+	// Normalized, the step is from 1 to 2: too small for regressPos in the
+	// raw values.
+	dTable, err := getDataTable(d, "src=d/a&transform=norm&regressPos=0.5&regressFormat=segments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dTable.Regressions) != 1 {
+		t.Fatalf("got %+v, want one regression", dTable.Regressions)
+	}
+	seg := dTable.Regressions[0]
+	if (seg.Before != 1) || (seg.After != 2) || (seg.Delta != 1) || (seg.Percent == nil) || (*seg.Percent != 100) {
+		t.Errorf("got %+v, want the normalized step from 1 to 2", seg)
+	}
+	if v, _ := dTable.Data[1].Get(5); v != 2 {
+		t.Errorf("got %v, want the transformed value 2", v)
+	}
+}
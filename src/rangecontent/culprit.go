@@ -0,0 +1,141 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangecontent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/db/requests"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// CulpritRecord is a record bounding a regression.
+type CulpritRecord struct {
+	Id          string            `json:"id"`
+	Timestamp   int64             `json:"timestamp"`
+	Value       float64           `json:"value"`
+	ConfigPairs map[string]string `json:"configPairs,omitempty"`
+}
+
+// Culprit is the range of records in which a regression started.
+type Culprit struct {
+	Source    string        `json:"source"`
+	Column    string        `json:"column"`
+	LastGood  CulpritRecord `json:"lastGood"`
+	FirstBad  CulpritRecord `json:"firstBad"`
+	ConfigKey string        `json:"configKey,omitempty"`
+	Values    []string      `json:"values,omitempty"` // Of ConfigKey after LastGood up to FirstBad.
+}
+
+func MakeCulpritJsonContent(d db.DB, b *bytes.Buffer, rawQuery string) error {
+	culprit, err := FindCulprit(d, rawQuery)
+	if err != nil {
+		return err
+	}
+
+	t := time.Now()
+	if err := json.NewEncoder(b).Encode(culprit); err != nil {
+		return err
+	}
+	glog.V(2).Infof("PERF: JSON marshal time: %v\n", time.Now().Sub(t))
+	return nil
+}
+
+// FindCulprit returns the culprit range of a regression in a range read of a
+// single source.  The column parameter names the column, which may be omitted
+// when the read has only one.  The regression starts after the record with the
+// startId parameter, or at the timestamp parameter in milliseconds, which
+// must both be within the range read.  The distinct values of the config key
+// of the configKey parameter within the range are returned if set.
+func FindCulprit(d db.DB, rawQuery string) (*Culprit, error) {
+	q, _ := url.ParseQuery(rawQuery)
+	startId := q.Get("startId")
+	var timestamp int64
+	if timestampStr := q.Get("timestamp"); timestampStr != "" {
+		var err error
+		if timestamp, err = strconv.ParseInt(timestampStr, 10, 64); err != nil {
+			return nil, errors.New("Bad timestamp parameter: " + timestampStr)
+		}
+	} else if startId == "" {
+		return nil, errors.New("No startId or timestamp selected.")
+	}
+
+	req, err := requests.MakeRowRangeReqs(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	if (len(req.FilteredSources) != 1) || req.FilteredSources[0].Pattern {
+		return nil, errors.New("Culprit ranges need exactly one source.")
+	}
+	req.ReturnIds = true
+	req.ReturnConfigs = true
+	dTable, err := getDataTableRaw(d, &req)
+	if err != nil {
+		return nil, err
+	}
+	dTable.SortRows(0)
+
+	columnName := q.Get("column")
+	var col int
+	switch {
+	case columnName != "":
+		if col, err = dTable.IndexForName(columnName); err != nil {
+			return nil, errors.New("Unknown column: " + columnName)
+		}
+	case (len(dTable.ColumnNames) == 2) && (dTable.ColumnNames[0] == common.TimeName):
+		col = 1
+		columnName = dTable.ColumnNames[1]
+	default:
+		return nil, errors.New("No column selected.")
+	}
+
+	lastGood, firstBad, err := dTable.CulpritRange(col, startId, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	culprit := &Culprit{
+		Source:    req.FilteredSources[0].Source,
+		Column:    columnName,
+		ConfigKey: q.Get("configKey")}
+	for _, r := range []struct {
+		row    int
+		record *CulpritRecord
+	}{{lastGood, &culprit.LastGood}, {firstBad, &culprit.FirstBad}} {
+		t, _ := dTable.Data[0].Get(r.row)
+		v, _ := dTable.Data[col].Get(r.row)
+		*r.record = CulpritRecord{
+			Id:          dTable.IdColumn[r.row],
+			Timestamp:   int64(t),
+			Value:       v,
+			ConfigPairs: make(map[string]string)}
+		for k, c := range dTable.Configs {
+			if value, ok := c.Get(r.row); ok {
+				r.record.ConfigPairs[dTable.ConfigsColumnNames[k]] = value
+			}
+		}
+	}
+	if culprit.ConfigKey != "" {
+		culprit.Values = dTable.DistinctConfigValues(culprit.ConfigKey, lastGood, firstBad)
+	}
+	return culprit, nil
+}
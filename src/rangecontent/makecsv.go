@@ -0,0 +1,125 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangecontent
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func MakeSrcsCsvContent(d db.DB, b *bytes.Buffer, rawQuery string) error {
+	return makeSrcsDelimitedContent(d, b, rawQuery, ',')
+}
+
+func MakeSrcsTsvContent(d db.DB, b *bytes.Buffer, rawQuery string) error {
+	return makeSrcsDelimitedContent(d, b, rawQuery, '\t')
+}
+
+func makeSrcsDelimitedContent(d db.DB, b *bytes.Buffer, rawQuery string, comma rune) error {
+	dTable, err := getDataTable(d, rawQuery)
+	if err != nil {
+		return err
+	}
+
+	q, _ := url.ParseQuery(rawQuery)
+	humanTime := q.Get("humanTime") == "1"
+
+	t3 := time.Now()
+	if err := WriteDataTableDelimited(b, dTable, comma, humanTime); err != nil {
+		return err
+	}
+	glog.V(2).Infof("PERF: delimited output time: %v\n", time.Now().Sub(t3))
+	return nil
+}
+
+// WriteDataTableDelimited writes dTable as a header line followed by one line
+// per row, with fields separated by comma and quoted as needed.  The id column
+// comes first and the config columns last when present.  If the X-axis is not
+// time but timestamps were saved, a time column follows the X column.  Missing
+// values are empty fields.
+func WriteDataTableDelimited(w io.Writer, dTable *db.DataTable, comma rune, humanTime bool) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+
+	numRows := dTable.NumRows()
+	haveIds := len(dTable.IdColumn) == numRows
+	haveConfigs := len(dTable.Configs) > 0
+	haveTimestamps := (dTable.Timestamps != nil) && (dTable.Timestamps.Len() == numRows)
+	xIsTime := (len(dTable.ColumnNames) > 0) && (dTable.ColumnNames[0] == common.TimeName)
+
+	var header []string
+	if haveIds {
+		header = append(header, "id")
+	}
+	for i, name := range dTable.ColumnNames {
+		header = append(header, name)
+		if (i == 0) && haveTimestamps {
+			header = append(header, common.TimeName)
+		}
+	}
+	if haveConfigs {
+		header = append(header, dTable.ConfigsColumnNames...)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	formatTime := func(f float64, ok bool) string {
+		if !ok {
+			return ""
+		}
+		return common.FormatMillis(int64(f), humanTime)
+	}
+
+	record := make([]string, 0, len(header))
+	for i := 0; i < numRows; i++ {
+		record = record[:0]
+		if haveIds {
+			record = append(record, dTable.IdColumn[i])
+		}
+		for j, c := range dTable.Data {
+			val, ok := c.Get(i)
+			switch {
+			case (j == 0) && xIsTime:
+				record = append(record, formatTime(val, ok))
+			case ok:
+				record = append(record, strconv.FormatFloat(val, 'g', -1, 64))
+			default:
+				record = append(record, "")
+			}
+			if (j == 0) && haveTimestamps {
+				record = append(record, formatTime(dTable.Timestamps.Get(i)))
+			}
+		}
+		for _, c := range dTable.Configs {
+			s, _ := c.Get(i)
+			record = append(record, s)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
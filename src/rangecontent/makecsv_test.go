@@ -0,0 +1,61 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangecontent
+
+import (
+	"bytes"
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/db"
+	"testing"
+)
+
+func TestWriteDataTableDelimited(t *testing.T) {
+	x, v := column.NewFloats(2), column.NewFloats(2)
+	x.Set(0, 1000)
+	x.Set(1, 2000)
+	v.Set(0, 1.5)
+	v.SetNull(1)
+	k := column.NewStrings(2)
+	k.Set(0, `say "hi"`)
+	k.SetNull(1)
+	dTable := &db.DataTable{
+		ColumnNames:        []string{"_Time", "a,b:lat.mean"},
+		Data:               db.Columns{x, v},
+		IdColumn:           []string{"id1", "id2"},
+		ConfigsColumnNames: []string{"k"},
+		Configs:            db.ConfigColumns{k}}
+
+	for _, tt := range []struct {
+		comma rune
+		want  string
+	}{
+		{',', "id,_Time,\"a,b:lat.mean\",k\n" +
+			"id1,1000,1.5,\"say \"\"hi\"\"\"\n" +
+			"id2,2000,,\n"},
+		{'\t', "id\t_Time\ta,b:lat.mean\tk\n" +
+			"id1\t1000\t1.5\t\"say \"\"hi\"\"\"\n" +
+			"id2\t2000\t\t\n"},
+	} {
+		var b bytes.Buffer
+		if err := WriteDataTableDelimited(&b, dTable, tt.comma, false); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("comma %q got:\n%s\nwant:\n%s", tt.comma, got, tt.want)
+		}
+	}
+}
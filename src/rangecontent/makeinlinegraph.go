@@ -64,12 +64,12 @@ func MakeSrcsInlineGraphContent(d db.DB, b *bytes.Buffer, rawQuery string) error
 			aggRemap[i-1] = aggregatesMap[aggregate]
 		}
 
-		for _, dRow := range dTable.Data {
-			newRow := []interface{}{(*dRow)[0]} // Start row with X value.
-			for i := 1; i < len(*dRow); i += 3 {
-				v0 := (*dRow)[i+aggRemap[0]]
-				v1 := (*dRow)[i+aggRemap[1]]
-				v2 := (*dRow)[i+aggRemap[2]]
+		for row := 0; row < dTable.NumRows(); row++ {
+			newRow := []interface{}{dTable.Data[0].Ptr(row)} // Start row with X value.
+			for i := 1; i < len(dTable.Data); i += 3 {
+				v0 := dTable.Data[i+aggRemap[0]].Ptr(row)
+				v1 := dTable.Data[i+aggRemap[1]].Ptr(row)
+				v2 := dTable.Data[i+aggRemap[2]].Ptr(row)
 				newRow = append(newRow, []*float64{v0, v1, v2})
 			}
 			data = append(data, newRow)
@@ -90,7 +90,7 @@ func MakeSrcsInlineGraphContent(d db.DB, b *bytes.Buffer, rawQuery string) error
 	} else {
 		tTemplate := time.Now()
 		err = templateloader.Templates.ExecuteTemplate(b, "in-graph.template-html", struct {
-			Data        []*[]*float64
+			Data        db.Columns // Encoded by row.
 			ColumnNames []string
 			ShowShadow  bool
 			XLabel      string
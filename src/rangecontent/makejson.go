@@ -18,7 +18,6 @@ package rangecontent
 
 import (
 	"bytes"
-	"encoding/json"
 	"github.com/golang/glog"
 	"github.com/google/tsviewdb/src/db"
 	"time"
@@ -31,9 +30,12 @@ func MakeSrcsJsonContent(d db.DB, b *bytes.Buffer, rawQuery string) (err error)
 	}
 
 	t3 := time.Now()
-	if err := json.NewEncoder(b).Encode(dTable); err != nil {
+	data, err := dTable.AppendJSON(nil)
+	if err != nil {
 		return err
 	}
+	b.Write(data)
+	b.WriteByte('\n')
 	glog.V(2).Infof("PERF: JSON marshal time: %v\n", time.Now().Sub(t3))
 
 	return nil
@@ -85,6 +85,9 @@ func MakeSrcsPngContent(d db.DB, b *bytes.Buffer, rawQuery string) error {
 	}
 	title := strings.Join(srcs, ", ")
 
+	if len(requests.MakeStatsBy(rawQuery)) > 0 {
+		return png.GroupStatsToPng(b, dTable, title, width, height)
+	}
 	png.DataTableToPng(b, dTable, title, width, height, xLabel)
 	return nil
 }
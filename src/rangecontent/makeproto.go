@@ -0,0 +1,62 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangecontent
+
+import (
+	"bytes"
+	"errors"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/db/requests"
+	"github.com/google/tsviewdb/src/tablecodec"
+	"time"
+)
+
+// MakeSrcsProtoContent writes the range read as a serialized tsviewdb Table.
+func MakeSrcsProtoContent(d db.DB, b *bytes.Buffer, rawQuery string) error {
+	req, err := requests.MakeRowRangeReqs(rawQuery)
+	if err != nil {
+		return err
+	}
+	// Tables encode columns by source, metric and aggregate, which aliased
+	// column names no longer carry.
+	for _, fSrc := range req.FilteredSources {
+		if fSrc.Alias != "" {
+			return errors.New("The alias parameter is not supported with type=proto.")
+		}
+	}
+	dTable, err := getDataTable(d, rawQuery)
+	if err != nil {
+		return err
+	}
+
+	srcs := dTable.Sources // Set if source patterns were expanded.
+	if len(srcs) == 0 {
+		for _, fSrc := range req.FilteredSources {
+			srcs = append(srcs, fSrc.Source)
+		}
+	}
+
+	t3 := time.Now()
+	data, err := tablecodec.Marshal(dTable, srcs)
+	if err != nil {
+		return err
+	}
+	b.Write(data)
+	glog.V(2).Infof("PERF: proto output time: %v\n", time.Now().Sub(t3))
+	return nil
+}
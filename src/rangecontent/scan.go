@@ -0,0 +1,251 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangecontent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/db/requests"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parameters of a scan not passed on to the reads of each source.
+var scanOnlyParams = []string{"dir", "override", "maxRegressions", "allMetrics", "type"}
+
+// ScanResult is a regression found by a scan.
+type ScanResult struct {
+	Source string `json:"source"`
+	db.RegressionSegment
+	Link string `json:"link"` // Graph of the column with its regressions.
+}
+
+// ScanResults lists the regressions found by a scan, largest first.
+type ScanResults struct {
+	Sources     int          `json:"sources"`         // Number of sources scanned.
+	Empty       []string     `json:"empty,omitempty"` // Sources without records in the range.
+	Regressions []ScanResult `json:"regressions"`
+}
+
+type byScore []ScanResult
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// Less orders by absolute percent change, then absolute change for
+// regressions without a percent change, which come last.
+func (s byScore) Less(i, j int) bool {
+	a, b := s[i].Percent, s[j].Percent
+	switch {
+	case (a != nil) && (b != nil):
+		return math.Abs(*a) > math.Abs(*b)
+	case (a != nil) != (b != nil):
+		return a != nil
+	}
+	return math.Abs(s[i].Delta) > math.Abs(s[j].Delta)
+}
+
+func MakeScanJsonContent(d db.DB, b *bytes.Buffer, rawQuery string) error {
+	results, err := Scan(d, rawQuery)
+	if err != nil {
+		return err
+	}
+
+	t := time.Now()
+	if err := json.NewEncoder(b).Encode(results); err != nil {
+		return err
+	}
+	glog.V(2).Infof("PERF: JSON marshal time: %v\n", time.Now().Sub(t))
+	return nil
+}
+
+// Scan detects regressions in the default metrics of every source under the
+// directory of the dir parameter, or all their metrics with allMetrics=1.  The
+// time range and regression parameters are those of a range read, and each
+// override parameter (see requests.MakeScanOverrides) replaces regression
+// parameters for one metric.  At most maxRegressions are returned if set.
+func Scan(d db.DB, rawQuery string) (results ScanResults, err error) {
+	q, _ := url.ParseQuery(rawQuery)
+	dir := strings.Trim(q.Get("dir"), "/")
+	if dir == "" {
+		return results, errors.New("No dir selected.")
+	}
+	maxRegressions := 0
+	if maxStr := q.Get("maxRegressions"); maxStr != "" {
+		if maxRegressions, err = strconv.Atoi(maxStr); (err != nil) || (maxRegressions < 1) {
+			return results, errors.New("Bad maxRegressions parameter: " + maxStr)
+		}
+	}
+	overrides, err := requests.MakeScanOverrides(rawQuery)
+	if err != nil {
+		return results, err
+	}
+
+	base := make(url.Values)
+	for k, v := range q {
+		base[k] = v
+	}
+	for _, k := range scanOnlyParams {
+		base.Del(k)
+	}
+	if r, err := requests.MakeRegressionParams(base.Encode()); err != nil {
+		return results, err
+	} else if !r.Selected {
+		return results, errors.New("No regression parameters selected.")
+	}
+	for metric, override := range overrides { // Fail before reading anything.
+		if _, err := requests.MakeRegressionParams(withParams(base, override).Encode()); err != nil {
+			return results, errors.New("Bad override for " + metric + ": " + err.Error())
+		}
+	}
+
+	metrics, err := scanMetrics(d, dir, q.Get("allMetrics") != "1")
+	if err != nil {
+		return results, err
+	}
+	var srcs []string
+	for src := range metrics {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	results.Sources = len(srcs)
+	results.Regressions = []ScanResult{}
+
+	tScan := time.Now()
+	for _, src := range srcs {
+		// Metrics with the same parameters are read together.
+		reads := make(map[string][]string) // Metrics by override metric, "" for none.
+		var keys []string
+		for _, metric := range metrics[src] {
+			key := ""
+			if _, ok := overrides[metric]; ok {
+				key = metric
+			}
+			if _, ok := reads[key]; !ok {
+				keys = append(keys, key)
+			}
+			reads[key] = append(reads[key], metric)
+		}
+		empty := true
+		for _, key := range keys {
+			params := base
+			if key != "" {
+				params = withParams(base, overrides[key])
+			}
+			found, err := scanSource(d, src, reads[key], params)
+			if _, ok := err.(*db.NoResultsError); ok {
+				continue // No records in the range.
+			}
+			if err != nil {
+				return results, err
+			}
+			empty = false
+			results.Regressions = append(results.Regressions, found...)
+		}
+		if empty {
+			results.Empty = append(results.Empty, src)
+		}
+	}
+	glog.V(2).Infof("PERF: scan time: %v\n", time.Now().Sub(tScan))
+
+	sort.Stable(byScore(results.Regressions))
+	if (maxRegressions > 0) && (len(results.Regressions) > maxRegressions) {
+		results.Regressions = results.Regressions[:maxRegressions]
+	}
+	return results, nil
+}
+
+// scanMetrics returns the metrics of each source under dir, only those
+// selected for defaults if defaultsOnly.
+func scanMetrics(d db.DB, dir string, defaultsOnly bool) (map[string][]string, error) {
+	sInfo, err := d.ReadDir(db.DirectorySearchRequest{
+		Prefix:         dir,
+		ReturnMetrics:  true,
+		DefaultsOnly:   defaultsOnly,
+		DirPrefixMatch: true})
+	if err != nil {
+		return nil, err
+	}
+	metrics := make(map[string][]string)
+	for _, name := range sInfo.Names {
+		name = strings.TrimPrefix(name, "/") // Sources at the root.
+		i := strings.LastIndex(name, "/")
+		j := strings.Index(name[i+1:], ":")
+		if j < 0 {
+			continue
+		}
+		src, metric := name[:i+1+j], name[i+2+j:]
+		// The prefix match also finds sibling directories such as dir2.
+		if !strings.HasPrefix(src, dir+"/") {
+			continue
+		}
+		metrics[src] = append(metrics[src], metric)
+	}
+	return metrics, nil
+}
+
+// withParams returns a copy of base with the values of params set.
+func withParams(base, params url.Values) url.Values {
+	v := make(url.Values)
+	for k, vs := range base {
+		v[k] = vs
+	}
+	for k, vs := range params {
+		v[k] = vs
+	}
+	return v
+}
+
+// scanSource returns the regressions in metrics of src using the range read
+// parameters params.
+func scanSource(d db.DB, src string, metrics []string, params url.Values) ([]ScanResult, error) {
+	v := withParams(params, url.Values{
+		"src":           {src},
+		"metrics":       {strings.Join(metrics, ",")},
+		"regressFormat": {"segments"}})
+	dTable, err := getDataTable(d, v.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var found []ScanResult
+	for _, seg := range dTable.Regressions {
+		link := withParams(params, url.Values{"src": {src + ":" + seg.Column}})
+		found = append(found, ScanResult{
+			Source:            src,
+			RegressionSegment: seg,
+			Link:              common.VizPath + "?" + link.Encode()})
+	}
+	return found, nil
+}
+
+// FindRegressions returns the regressions found by the range read rawQuery.
+func FindRegressions(d db.DB, rawQuery string) ([]db.RegressionSegment, error) {
+	dTable, err := getDataTable(d, rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	return dTable.Regressions, nil
+}
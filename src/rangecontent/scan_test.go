@@ -0,0 +1,79 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangecontent
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/db"
+	"reflect"
+	"testing"
+)
+
+// fakeDB serves a directory listing and per-source tables.  Sources without a
+// table have no records.
+type fakeDB struct {
+	db.DB
+	names  []string
+	tables map[string]*db.DataTable
+}
+
+func (f *fakeDB) ReadDir(req db.DirectorySearchRequest) (db.SourceInfoUncomp, error) {
+	return db.SourceInfoUncomp{Names: f.names}, nil
+}
+
+func (f *fakeDB) ReadRows(req db.RowRangeRequests) (*db.DataTable, error) {
+	src := req.FilteredSources[0].Source
+	t, ok := f.tables[src]
+	if !ok {
+		return nil, &db.NoResultsError{Source: src}
+	}
+	return t, nil
+}
+
+func (f *fakeDB) ReadTriages(source string) ([]db.Triage, error) {
+	return nil, nil
+}
+
+func stepTable(name string, values ...float64) *db.DataTable {
+	x, c := column.NewFloats(len(values)), column.NewFloats(len(values))
+	for i, v := range values {
+		x.Set(i, float64(i*1000))
+		c.Set(i, v)
+	}
+	return &db.DataTable{ColumnNames: []string{"_Time", name}, Data: db.Columns{x, c}}
+}
+
+func TestScanSkipsEmptySources(t *testing.T) {
+	d := &fakeDB{
+		names: []string{"dir/a:lat.mean", "dir/stale:lat.mean"},
+		tables: map[string]*db.DataTable{
+			"dir/a": stepTable("lat.mean", 10, 10, 20, 20)}}
+
+	results, err := Scan(d, "dir=dir&regressPos=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Sources != 2 {
+		t.Errorf("got %d sources, want 2", results.Sources)
+	}
+	if !reflect.DeepEqual(results.Empty, []string{"dir/stale"}) {
+		t.Errorf("got empty %v, want [dir/stale]", results.Empty)
+	}
+	if (len(results.Regressions) != 1) || (results.Regressions[0].Source != "dir/a") {
+		t.Errorf("got %+v, want one regression in dir/a", results.Regressions)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rangecontent
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/glog"
+	"github.com/google/tsviewdb/src/db"
+	"github.com/google/tsviewdb/src/db/requests"
+	"io"
+	"net/url"
+	"time"
+)
+
+const (
+	streamFlushRows = 1000 // Flush to the client after this many rows.
+)
+
+// streamParams are the query parameters which can be honored when rows are
+// written as they are read.  Anything else (sorting, regression detection,
+// changing the X-axis, etc.) needs the whole table.
+var streamParams = map[string]bool{
+	"src":                   true,
+	"type":                  true,
+	"stream":                true,
+	"daysOfData":            true,
+	"startDate":             true,
+	"endDate":               true,
+	"maxResults":            true,
+	"aggregates":            true,
+	"metrics":               true,
+	"config":                true,
+	"groupBy":               true,
+	"setAggregateIfMissing": true,
+	"returnIds":             true,
+	"returnConfigs":         true,
+	"noReturnAggregates":    true,
+}
+
+// MakeStreamReq returns the request for a streamed range read, or an error if
+// the query uses parameters that cannot be streamed.
+func MakeStreamReq(rawQuery string) (req db.RowRangeRequests, err error) {
+	q, _ := url.ParseQuery(rawQuery)
+	for k := range q {
+		if !streamParams[k] {
+			return req, errors.New("Parameter not supported for streamed reads: " + k)
+		}
+	}
+	req, err = requests.MakeRowRangeReqs(rawQuery)
+	if err != nil {
+		return req, err
+	}
+	if len(req.FilteredSources) == 0 {
+		return req, errors.New("No sources selected.")
+	}
+	return req, nil
+}
+
+// StreamSrcsJsonContent writes the rows of a range read to w as newline-
+// delimited JSON (one db.StreamRow per line) as they are read from the DB.
+// flush is called periodically so the client receives rows before the read
+// completes.  Source patterns are expanded first.  An error after the first
+// row is reported as a final {"error": "..."} line.
+func StreamSrcsJsonContent(d db.DB, w io.Writer, flush func(), req db.RowRangeRequests) error {
+	t0 := time.Now()
+	if _, err := requests.ExpandSources(d, &req); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	var numRows int
+	err := d.StreamRows(req, func(row *db.StreamRow) error {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+		numRows++
+		if numRows%streamFlushRows == 0 {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		glog.Errorln("Streamed read failed after", numRows, "rows:", err)
+		if numRows == 0 {
+			return err
+		}
+		enc.Encode(struct {
+			Error string `json:"error"`
+		}{err.Error()})
+	}
+	flush()
+	glog.V(2).Infof("PERF: streamed %d rows in: %v\n", numRows, time.Now().Sub(t0))
+	return nil
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regress
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	DefaultMinSegment     = 5
+	DefaultCusumDrift     = 0.5
+	DefaultCusumThreshold = 5
+	DefaultAlpha          = 0.05
+	DefaultPermutations   = 99
+
+	// Bounds on the cost of AlgoEDivisive, which is quadratic in the values of
+	// each segment tested, per permutation.
+	MaxPermutations    = 199
+	EDivisiveMaxValues = 1000
+)
+
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func minSegment(r RegressionParams, min int) int {
+	m := r.MinSegment
+	if m == 0 {
+		m = DefaultMinSegment
+	}
+	if m < min {
+		return min
+	}
+	return m
+}
+
+// series is the non-null values of a column and their rows.
+type series struct {
+	rows   []int
+	values []float64
+}
+
+func nonNull(c *column.Floats) (s series) {
+	for i := 0; i < c.Len(); i++ {
+		if v, ok := c.Get(i); ok {
+			s.rows = append(s.rows, i)
+			s.values = append(s.values, v)
+		}
+	}
+	return
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// changeDeltas returns a column of numRows rows with the change in mean
+// between the segments of s on either side of each change, at the row of the
+// first value after the change.  Changes are indexes into s.values.
+func (s series) changeDeltas(numRows int, changes []int, r RegressionParams) *column.Floats {
+	result := column.NewFloats(numRows)
+	sort.Ints(changes)
+	bounds := append(append([]int{0}, changes...), len(s.values))
+	for i := 1; i+1 < len(bounds); i++ {
+		before := mean(s.values[bounds[i-1]:bounds[i]])
+		after := mean(s.values[bounds[i]:bounds[i+1]])
+		delta := after - before
+		if r.UsePercent {
+			if (before == 0) || (math.Abs(before) < r.IgnoreLT) || (math.Abs(after) < r.IgnoreLT) {
+				continue
+			}
+			delta = (delta / math.Abs(before)) * 100
+		}
+		result.Set(s.rows[bounds[i]], delta)
+	}
+	return result
+}
+
+// noiseSigma estimates the standard deviation of the noise in values from the
+// median absolute difference of successive values, which steps barely affect.
+// For values which are mostly unchanged it falls back to the mean difference.
+func noiseSigma(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	diffs := make([]float64, len(values)-1)
+	for i := range diffs {
+		diffs[i] = math.Abs(values[i+1] - values[i])
+	}
+	sort.Float64s(diffs)
+	// For normal noise the median difference is 0.6745*sqrt(2) sigma.
+	if median := diffs[len(diffs)/2]; median > 0 {
+		return median / (0.6745 * math.Sqrt2)
+	}
+	return mean(diffs)
+}
+
+// cusumDetector tracks cumulative sums of deviations above and below the mean
+// of the first MinSegment values of each segment.  A change starts where a sum
+// last left 0 once the sum exceeds CusumThreshold.
+type cusumDetector struct{}
+
+func (cusumDetector) Detect(c *column.Floats, r RegressionParams) *column.Floats {
+	s := nonNull(c)
+	m := minSegment(r, 1)
+	sigma := noiseSigma(s.values)
+	drift := orDefault(r.CusumDrift, DefaultCusumDrift) * sigma
+	threshold := orDefault(r.CusumThreshold, DefaultCusumThreshold) * sigma
+
+	var changes []int
+	for start := 0; (sigma > 0) && (start+m < len(s.values)); {
+		mu := mean(s.values[start : start+m])
+		var pos, neg float64
+		posStart, negStart := start+m, start+m
+		change := -1
+		for i := start + m; i < len(s.values); i++ {
+			if pos = math.Max(0, pos+s.values[i]-mu-drift); pos == 0 {
+				posStart = i + 1
+			}
+			if neg = math.Max(0, neg+mu-s.values[i]-drift); neg == 0 {
+				negStart = i + 1
+			}
+			if pos > threshold {
+				change = posStart
+				break
+			}
+			if neg > threshold {
+				change = negStart
+				break
+			}
+		}
+		if change < 0 {
+			break
+		}
+		changes = append(changes, change)
+		start = change
+	}
+	return s.changeDeltas(c.Len(), changes, r)
+}
+
+// eDivisiveDetector recursively splits segments where the energy distance
+// between the values on either side is greatest, while a permutation test
+// finds the split significant at level Alpha.  Series of more than
+// EDivisiveMaxValues values are split on the means of blocks of values, and
+// each change then placed within the blocks around it.
+type eDivisiveDetector struct{}
+
+func (eDivisiveDetector) Detect(c *column.Floats, r RegressionParams) *column.Floats {
+	s := nonNull(c)
+	alpha := orDefault(r.Alpha, DefaultAlpha)
+	permutations := r.Permutations
+	if permutations == 0 {
+		permutations = DefaultPermutations
+	}
+	if permutations > MaxPermutations {
+		permutations = MaxPermutations
+	}
+	rng := rand.New(rand.NewSource(1)) // Deterministic for caching.
+
+	values, block := s.values, 1
+	if len(values) > EDivisiveMaxValues {
+		block = (len(values) + EDivisiveMaxValues - 1) / EDivisiveMaxValues
+		values = blockMeans(values, block)
+	}
+	m := minSegment(r, 2)
+	if m = (m + block - 1) / block; m < 2 {
+		m = 2
+	}
+
+	var changes []int
+	var split func(a, b int)
+	split = func(a, b int) {
+		tau, q := bestEnergySplit(values[a:b], m)
+		if tau < 0 {
+			return
+		}
+		shuffled := append([]float64(nil), values[a:b]...)
+		numAsLarge := 0
+		for p := 0; p < permutations; p++ {
+			for i := len(shuffled) - 1; i > 0; i-- {
+				j := rng.Intn(i + 1)
+				shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+			}
+			if _, pq := bestEnergySplit(shuffled, m); pq >= q {
+				numAsLarge++
+			}
+		}
+		if float64(numAsLarge+1)/float64(permutations+1) > alpha {
+			return
+		}
+		change := (a + tau) * block
+		if block > 1 {
+			lo, hi := change-block, change+block // Within a+1 to b-1 blocks, as tau >= m >= 2.
+			if hi > len(s.values) {
+				hi = len(s.values)
+			}
+			if t, _ := bestEnergySplit(s.values[lo:hi], 2); t > 0 {
+				change = lo + t
+			}
+		}
+		changes = append(changes, change)
+		split(a, a+tau)
+		split(a+tau, b)
+	}
+	split(0, len(values))
+	return s.changeDeltas(c.Len(), changes, r)
+}
+
+// blockMeans returns the means of successive blocks of size values, the last
+// possibly shorter.
+func blockMeans(values []float64, size int) (means []float64) {
+	for i := 0; i < len(values); i += size {
+		j := i + size
+		if j > len(values) {
+			j = len(values)
+		}
+		means = append(means, mean(values[i:j]))
+	}
+	return means
+}
+
+// bestEnergySplit returns the split of x into x[:tau] and x[tau:], each of at
+// least m >= 2 values, with the greatest scaled energy distance q between the
+// two parts, or -1 if x is too short.
+func bestEnergySplit(x []float64, m int) (tau int, q float64) {
+	n := len(x)
+	if n < 2*m {
+		return -1, 0
+	}
+	// Sums of |x[i]-x[j]| over pairs within x[:t], within x[t:] and between.
+	var left, right, between float64
+	for i := range x {
+		for j := i + 1; j < n; j++ {
+			right += math.Abs(x[i] - x[j])
+		}
+	}
+	tau, q = -1, math.Inf(-1)
+	for t := 1; t <= n-m; t++ { // Move x[t-1] to the left part.
+		var toLeft, toRight float64
+		for i := 0; i < t-1; i++ {
+			toLeft += math.Abs(x[i] - x[t-1])
+		}
+		for j := t; j < n; j++ {
+			toRight += math.Abs(x[t-1] - x[j])
+		}
+		left += toLeft
+		right -= toRight
+		between += toRight - toLeft
+		if t < m {
+			continue
+		}
+		n1, n2 := float64(t), float64(n-t)
+		e := 2*between/(n1*n2) - left/(n1*(n1-1)/2) - right/(n2*(n2-1)/2)
+		if stat := n1 * n2 / (n1 + n2) * e; stat > q {
+			tau, q = t, stat
+		}
+	}
+	return tau, q
+}
+
+// likelihoodDetector recursively splits segments at the step in mean with the
+// greatest likelihood ratio against no step, assuming normal noise, while the
+// ratio exceeds Penalty.
+type likelihoodDetector struct{}
+
+func (likelihoodDetector) Detect(c *column.Floats, r RegressionParams) *column.Floats {
+	s := nonNull(c)
+	m := minSegment(r, 1)
+	sigma := noiseSigma(s.values)
+	penalty := orDefault(r.Penalty, 3*math.Log(float64(len(s.values))))
+
+	sums := make([]float64, len(s.values)+1) // Prefix sums.
+	for i, v := range s.values {
+		sums[i+1] = sums[i] + v
+	}
+	var changes []int
+	var split func(a, b int)
+	split = func(a, b int) {
+		best, bestStat := -1, 0.0
+		for t := a + m; t <= b-m; t++ {
+			n1, n2 := float64(t-a), float64(b-t)
+			diff := (sums[t]-sums[a])/n1 - (sums[b]-sums[t])/n2
+			// Twice the log likelihood ratio.
+			if stat := n1 * n2 / (n1 + n2) * diff * diff / (sigma * sigma); stat > bestStat {
+				best, bestStat = t, stat
+			}
+		}
+		if (best < 0) || (bestStat <= penalty) {
+			return
+		}
+		changes = append(changes, best)
+		split(a, best)
+		split(best, b)
+	}
+	if sigma > 0 {
+		split(0, len(s.values))
+	}
+	return s.changeDeltas(c.Len(), changes, r)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regress
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"math"
+	"testing"
+)
+
+// stepColumn returns n values stepping from 10 to 10+step at row n/2, with
+// deterministic noise of amplitude 0.5 and a null every 7th row.
+func stepColumn(n int, step float64) *column.Floats {
+	c := column.NewFloats(n)
+	for i := 0; i < n; i++ {
+		if i%7 == 3 {
+			continue
+		}
+		v := 10 + 0.5*math.Sin(float64(i)*2.3)
+		if i >= n/2 {
+			v += step
+		}
+		c.Set(i, v)
+	}
+	return c
+}
+
+// changes returns the rows with values in c.
+func changes(c *column.Floats) (rows []int) {
+	for i := 0; i < c.Len(); i++ {
+		if !c.IsNull(i) {
+			rows = append(rows, i)
+		}
+	}
+	return
+}
+
+func TestDetectors(t *testing.T) {
+	for _, algo := range []string{AlgoCusum, AlgoEDivisive, AlgoLikelihood} {
+		r := RegressionParams{Algo: algo}
+		result := GetVerifiedRegression(stepColumn(100, 5), r)
+		rows := changes(result)
+		if (len(rows) != 1) || (rows[0] != 50) {
+			t.Errorf("%s: got changes at %v want [50]", algo, rows)
+			continue
+		}
+		if delta, _ := result.Get(50); math.Abs(delta-5) > 0.5 {
+			t.Errorf("%s: got delta %v want about 5", algo, delta)
+		}
+
+		if rows := changes(GetVerifiedRegression(stepColumn(100, 0), r)); len(rows) != 0 {
+			t.Errorf("%s: got changes at %v for no step", algo, rows)
+		}
+
+		neg := -1.0
+		r.Neg = &neg // Only falls count.
+		if GetVerifiedRegression(stepColumn(100, 5), r) != nil {
+			t.Errorf("%s: got regression for rise with negative threshold", algo)
+		}
+	}
+}
+
+func TestDetectorsNoNoise(t *testing.T) {
+	c := column.NewFloats(20)
+	for i := 0; i < 20; i++ {
+		c.Set(i, 1)
+		if i >= 12 {
+			c.Set(i, 3)
+		}
+	}
+	for _, algo := range []string{AlgoCusum, AlgoEDivisive, AlgoLikelihood} {
+		result := GetVerifiedRegression(c, RegressionParams{Algo: algo, UsePercent: true})
+		if rows := changes(result); (len(rows) != 1) || (rows[0] != 12) {
+			t.Errorf("%s: got changes at %v want [12]", algo, rows)
+		} else if pct, _ := result.Get(12); pct != 200 {
+			t.Errorf("%s: got %v%% want 200%%", algo, pct)
+		}
+	}
+}
+
+func TestEDivisiveLongSeries(t *testing.T) {
+	n := 3 * EDivisiveMaxValues // Split on block means.
+	result := GetVerifiedRegression(stepColumn(n, 5), RegressionParams{Algo: AlgoEDivisive})
+	if rows := changes(result); (len(rows) != 1) || (rows[0] != n/2) {
+		t.Errorf("got changes at %v want [%d]", rows, n/2)
+	}
+}
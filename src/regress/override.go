@@ -0,0 +1,77 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regress
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Override is a set of regression parameters to use instead of those in a
+// RegressionParams, such as the defaults of a metric.  Nil fields are unset.
+type Override struct {
+	Pos        *float64 `json:"pos,omitempty"`
+	Neg        *float64 `json:"neg,omitempty"`
+	UsePercent *bool    `json:"usePercent,omitempty"`
+	IgnoreLT   *float64 `json:"ignoreLT,omitempty"`
+	Window     *int     `json:"window,omitempty"`
+	Radius     *int     `json:"radius,omitempty"`
+	SeasonBins *int     `json:"seasonBins,omitempty"`
+}
+
+// Apply returns r with the parameters set in o, or r if o is nil.
+func (o *Override) Apply(r RegressionParams) RegressionParams {
+	if o == nil {
+		return r
+	}
+	if o.Pos != nil {
+		r.Pos = o.Pos
+	}
+	if o.Neg != nil {
+		r.Neg = o.Neg
+	}
+	if o.UsePercent != nil {
+		r.UsePercent = *o.UsePercent
+	}
+	if o.IgnoreLT != nil {
+		r.IgnoreLT = *o.IgnoreLT
+	}
+	if o.Window != nil {
+		r.Window = *o.Window
+	}
+	if o.Radius != nil {
+		r.Radius = *o.Radius
+	}
+	if o.SeasonBins != nil {
+		r.SeasonBins = *o.SeasonBins
+	}
+	return r
+}
+
+// Validate returns an error if o sets a parameter out of range.
+func (o *Override) Validate() error {
+	if (o.Window != nil) && (*o.Window < 1) {
+		return errors.New("Regression window must be > 0.")
+	}
+	if (o.Radius != nil) && (*o.Radius < 0) {
+		return errors.New("Regression radius must be >= 0.")
+	}
+	if (o.SeasonBins != nil) && ((*o.SeasonBins < 1) || (*o.SeasonBins > MaxSeasonBins)) {
+		return fmt.Errorf("Regression season bins must be between 1 and %d.", MaxSeasonBins)
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package regress
 
 import (
+	"github.com/google/tsviewdb/src/column"
 	"math"
 )
 
@@ -37,60 +38,114 @@ func maxFloat64(a, b float64) float64 {
 
 type RegressionParams struct {
 	Selected       bool
+	Algo           string   // Name of the Detector to use, "" for AlgoWindow.
 	Pos            *float64 // Positive regression threshold.
 	Neg            *float64 // Negative regression threshold.
 	ReturnSegments bool     // Return regression segments, otherwise return regression function values.
+	Format         string   // FormatColumns or FormatSegments.
 
 	Radius     int     // Size of array ahead and behind of window to use to verify regression.
 	Window     int     // Distance in records to use to calculate delta.  Must be >= 1.
 	UsePercent bool    // Return values are in percent.
 	IgnoreLT   float64 // Ignore absolute values < this amount if UsePercent is selected.
+
+	// Parameters of the change-point detectors other than AlgoWindow.  Zero
+	// values select the defaults.
+	MinSegment     int     // Minimum values between change points.
+	CusumDrift     float64 // Allowed drift from the mean in noise standard deviations.
+	CusumThreshold float64 // Cumulative sum signalling a change in noise standard deviations.
+	Alpha          float64 // Significance level of E-divisive permutation tests.
+	Permutations   int     // Number of E-divisive permutation tests.
+	Penalty        float64 // Likelihood ratio needed for a change, default 3*ln(n).
+
+	// Seasonality removed before detection (see Deseasonalize).
+	SeasonMillis   int64 // Season length, SeasonAuto, or 0 for none.
+	SeasonBins     int   // Phases per season, 0 for the default.
+	ReturnSeasonal bool  // Add the seasonal component as a column.
+
+	// With UseDefaults, each column uses the defaults of its metric, if any,
+	// except for the parameters set explicitly (see db.SetRegressionDefaults).
+	UseDefaults bool
+	Explicit    Override
 }
 
-type regressTable []*[]*float64 // Not ptr because will never add rows.
+// Formats of regression results.
+const (
+	FormatColumns  = "columns"  // Columns of regression values (see GetVerifiedRegression).
+	FormatSegments = "segments" // A list of regressions (see FindRegressions).
+)
+
+// Names of the change-point detectors.
+const (
+	AlgoWindow     = "window"
+	AlgoCusum      = "cusum"
+	AlgoEDivisive  = "edivisive"
+	AlgoLikelihood = "likelihood"
+)
 
-func NewTable(t []*[]*float64) regressTable {
-	newTable := regressTable(t)
-	return newTable
+// Detector finds changes in a column, returning a column with the size of the
+// change at each row where one is detected and null elsewhere.
+type Detector interface {
+	Detect(c *column.Floats, r RegressionParams) *column.Floats
 }
 
-func (t regressTable) get(row, col int) (val float64, ok bool) {
-	valPtr := (*t[row])[col]
-	if valPtr == nil {
-		return 0, false
+// Detectors holds the detectors selectable by RegressionParams.Algo.
+var Detectors = map[string]Detector{
+	AlgoWindow:     windowDetector{},
+	AlgoCusum:      cusumDetector{},
+	AlgoEDivisive:  eDivisiveDetector{},
+	AlgoLikelihood: likelihoodDetector{},
+}
+
+func (r RegressionParams) detector() Detector {
+	if r.Algo == "" {
+		return Detectors[AlgoWindow]
 	}
-	return *valPtr, true
+	return Detectors[r.Algo]
+}
+
+// crosses returns true if a detector value crosses a threshold.
+func (r RegressionParams) crosses(val float64) bool {
+	return ((r.Pos != nil) && (val > *r.Pos)) || ((r.Neg != nil) && (val < *r.Neg))
+}
+
+type regressColumn struct {
+	*column.Floats
+}
+
+func (t regressColumn) get(row int) (val float64, ok bool) {
+	return t.Get(row)
 }
 
-func (t regressTable) getRaw(row, col int) *float64 {
-	return (*t[row])[col]
+// GetVerifiedRegression returns the regression values of c, or nil if a
+// threshold is set and never crossed.
+func GetVerifiedRegression(c *column.Floats, r RegressionParams) *column.Floats {
+	return regressColumn{c}.GetVerifiedRegression(r)
 }
 
-func (t regressTable) GetVerifiedRegression(col int, r RegressionParams) (result []*float64) {
-	result = t.computeVerifiedRegression(col, r)
+func (t regressColumn) GetVerifiedRegression(r RegressionParams) (result *column.Floats) {
+	result = r.detector().Detect(t.Floats, r)
 	if (r.Pos == nil) && (r.Neg == nil) { // No threshold set.
 		return result
 	}
 
-	posSet := r.Pos != nil
-	negSet := r.Neg != nil
-
 	var haveRegression bool
-	for i := range result {
-		if result[i] == nil {
+	for i := 0; i < result.Len(); i++ {
+		val, ok := result.Get(i)
+		if !ok {
 			continue
 		}
-		if (posSet && (*result[i] > *r.Pos)) || (negSet && (*result[i] < *r.Neg)) {
+		if r.crosses(val) {
 			if r.ReturnSegments {
-				result[i] = t.getRaw(i, col)
+				result.SetPtr(i, t.Ptr(i))
 				if i > 0 { // Add the previous point if available.
-					result[i-1] = t.getRaw(i-1, col)
+					result.SetPtr(i-1, t.Ptr(i-1))
 				}
 			}
 			haveRegression = true
 		} else {
 			if r.ReturnSegments {
-				result[i] = nil
+				result.SetNull(i)
 			}
 		}
 	}
@@ -101,6 +156,14 @@ func (t regressTable) GetVerifiedRegression(col int, r RegressionParams) (result
 	return result
 }
 
+// windowDetector compares each value with the one Window records before it,
+// confirmed by the values within Radius records around them.
+type windowDetector struct{}
+
+func (windowDetector) Detect(c *column.Floats, r RegressionParams) *column.Floats {
+	return regressColumn{c}.computeVerifiedRegression(r)
+}
+
 // computeVerifiedRegression uses these parameters:
 //
 //              + - \
@@ -114,14 +177,14 @@ func (t regressTable) GetVerifiedRegression(col int, r RegressionParams) (result
 //  radius |      radius
 //        window
 //
-func (t regressTable) computeVerifiedRegression(col int, r RegressionParams) (result []*float64) {
-	result = make([]*float64, len(t))
+func (t regressColumn) computeVerifiedRegression(r RegressionParams) (result *column.Floats) {
+	result = column.NewFloats(t.Len())
 
 	// Ensure the index is high-enough to contain our window and all the reverse
 	// points, and that it is low enough to contain all our forward points.
-	for n := r.Window + r.Radius; n <= len(t)-r.Radius-r.Window; n++ {
+	for n := r.Window + r.Radius; n <= t.Len()-r.Radius-r.Window; n++ {
 		nBack := n - r.Window // The "back" point index.
-		back, ok := t.get(nBack, col)
+		back, ok := t.get(nBack)
 		if !ok {
 			continue
 		}
@@ -130,7 +193,7 @@ func (t regressTable) computeVerifiedRegression(col int, r RegressionParams) (re
 			continue
 		}
 
-		current, ok := t.get(n, col)
+		current, ok := t.get(n)
 		if !ok {
 			continue
 		}
@@ -141,7 +204,7 @@ func (t regressTable) computeVerifiedRegression(col int, r RegressionParams) (re
 
 		var confDeltaPos, confDeltaNeg float64
 		if r.Radius != 0 {
-			confDeltaPos, confDeltaNeg, ok = t.getConfirmedDeltas(col, n, nBack, r.Radius)
+			confDeltaPos, confDeltaNeg, ok = t.getConfirmedDeltas(n, nBack, r.Radius)
 			if !ok {
 				continue
 			}
@@ -159,20 +222,19 @@ func (t regressTable) computeVerifiedRegression(col int, r RegressionParams) (re
 				}
 			}
 			if r.UsePercent {
-				percentAbsResult := (absResult / math.Abs(back)) * 100
-				result[n] = &percentAbsResult
+				result.Set(n, (absResult/math.Abs(back))*100)
 				continue
 			}
-			result[n] = &absResult
+			result.Set(n, absResult)
 			continue
 		}
 
 		// fwd_delta is used to clean up artifacts if the window size is > 1.
-		nFwdVal, ok := t.get(n+r.Window-1, col)
+		nFwdVal, ok := t.get(n+r.Window-1)
 		if !ok {
 			continue
 		}
-		nM1Val, ok := t.get(n-1, col)
+		nM1Val, ok := t.get(n-1)
 		if !ok {
 			continue
 		}
@@ -199,27 +261,24 @@ func (t regressTable) computeVerifiedRegression(col int, r RegressionParams) (re
 		}
 
 		if r.UsePercent {
-			percentAbsResult := (absResult / math.Abs(back)) * 100
-			result[n] = &percentAbsResult
+			result.Set(n, (absResult/math.Abs(back))*100)
 		} else {
-			result[n] = &absResult
+			result.Set(n, absResult)
 		}
 	}
 	return result
 }
 
-func (t regressTable) getConfirmedDeltas(col, n, nBack, radius int) (confDeltaPos, confDeltaNeg float64, ok bool) {
+func (t regressColumn) getConfirmedDeltas(n, nBack, radius int) (confDeltaPos, confDeltaNeg float64, ok bool) {
 	// Find min/max in array of num_back values starting before the back point.
-	//maxBack := *(*t[nBack-radius])[col]
-	maxBack, ok := t.get(nBack-radius, col)
+	maxBack, ok := t.get(nBack-radius)
 	if !ok {
 		return confDeltaPos, confDeltaNeg, false // Need all points valid
 	}
 
 	minBack := maxBack
 	for i := 1; i < radius; i++ { // Skip first element because already set.
-		//val := *(*t[nBack-radius+i])[col]
-		val, ok := t.get(nBack-radius+i, col)
+		val, ok := t.get(nBack-radius+i)
 		if !ok {
 			return confDeltaPos, confDeltaNeg, false // Need all points valid
 		}
@@ -231,11 +290,13 @@ func (t regressTable) getConfirmedDeltas(col, n, nBack, radius int) (confDeltaPo
 	}
 
 	// Find min/max in array of num_fwd values starting after the current point.
-	maxFwd := *(*t[n+1])[col]
+	maxFwd, ok := t.get(n + 1)
+	if !ok {
+		return confDeltaPos, confDeltaNeg, false // Need all points valid
+	}
 	minFwd := maxFwd
 	for i := 1; i < radius; i++ { // Skip first element because already set.
-		//val := *(*t[n+1+i])[col]
-		val, ok := t.get(n+1+i, col)
+		val, ok := t.get(n+1+i)
 		if !ok {
 			return confDeltaPos, confDeltaNeg, false // Need all points valid
 		}
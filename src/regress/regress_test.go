@@ -20,19 +20,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/google/tsviewdb/src/column"
 	"strconv"
 	"testing"
 )
 
-func makeTestTable(i []interface{}) (r []*[]*float64) {
-	d := dataRow(i)
-	r = make([]*[]*float64, len(d))
-	for i := range d {
-		row := make([]*float64, 1)
-		row[0] = d[i]
-		r[i] = &row
-	}
-	return
+func makeTestColumn(i []interface{}) *column.Floats {
+	return column.FloatsFromPtrs(dataRow(i))
 }
 
 func dataRow(d []interface{}) (result []*float64) {
@@ -53,10 +47,10 @@ func dataRow(d []interface{}) (result []*float64) {
 }
 
 func run(r RegressionParams, input, want []interface{}) error {
-	d := makeTestTable(input)
-	rTable := regressTable(d)
-
-	got := rTable.GetVerifiedRegression(0, r)
+	var got []*float64
+	if result := GetVerifiedRegression(makeTestColumn(input), r); result != nil {
+		got = result.Ptrs()
+	}
 	cookedWant := dataRow(want)
 
 	if len(got) != len(want) {
@@ -0,0 +1,180 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regress
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"sort"
+)
+
+const (
+	DayMillis  = 24 * 3600 * 1000
+	WeekMillis = 7 * DayMillis
+
+	// SeasonAuto selects whichever of a daily or weekly season explains the
+	// data best, if either does.
+	SeasonAuto = -1
+
+	// MaxSeasonBins bounds the phases of a season: one per minute of a week.
+	MaxSeasonBins = WeekMillis / 60000
+
+	// Minimum fraction of the variance about the trend the season must explain
+	// to be found by SeasonAuto.
+	minSeasonStrength = 0.3
+)
+
+// Deseasonalize returns c less its seasonal component, and that component, for
+// rows with times x in milliseconds, ascending.  The season is
+// r.SeasonMillis long and split into r.SeasonBins phases, each with the median
+// difference of its values from a moving average over one season.  It
+// returns c and nil if no season is set or found, or the data spans fewer
+// than two seasons.
+func Deseasonalize(c, x *column.Floats, r RegressionParams) (adjusted, seasonal *column.Floats) {
+	s := nonNull(c)
+	times := make([]float64, len(s.rows))
+	for i, row := range s.rows {
+		times[i], _ = x.Get(row)
+	}
+
+	periods := []float64{float64(r.SeasonMillis)}
+	if r.SeasonMillis == SeasonAuto {
+		periods = []float64{DayMillis, WeekMillis}
+	}
+	var bestPhases []float64
+	var bestPeriod, bestStrength float64
+	for _, period := range periods {
+		if (period <= 0) || (len(times) == 0) || (times[len(times)-1]-times[0] < 2*period) {
+			continue
+		}
+		bins := r.SeasonBins
+		if bins == 0 {
+			bins = defaultSeasonBins(period)
+		} else if bins > MaxSeasonBins {
+			bins = MaxSeasonBins
+		}
+		phases, strength := fitSeason(s.values, times, period, bins)
+		if (r.SeasonMillis == SeasonAuto) && (strength < minSeasonStrength) {
+			continue
+		}
+		if (bestPhases == nil) || (strength > bestStrength) {
+			bestPhases, bestPeriod, bestStrength = phases, period, strength
+		}
+	}
+	if bestPhases == nil {
+		return c, nil
+	}
+
+	adjusted = column.NewFloats(c.Len())
+	seasonal = column.NewFloats(c.Len())
+	for i, row := range s.rows {
+		v := bestPhases[phase(times[i], bestPeriod, len(bestPhases))]
+		seasonal.Set(row, v)
+		adjusted.Set(row, s.values[i]-v)
+	}
+	return adjusted, seasonal
+}
+
+// defaultSeasonBins is a phase per day for whole weeks, otherwise 24 phases.
+func defaultSeasonBins(period float64) int {
+	if (int64(period)%WeekMillis == 0) && (period >= WeekMillis) {
+		return int(int64(period) / DayMillis)
+	}
+	return 24
+}
+
+func phase(t, period float64, bins int) int {
+	offset := t - float64(int64(t/period))*period
+	if offset < 0 {
+		offset += period
+	}
+	b := int(offset * float64(bins) / period)
+	if b >= bins { // Guard against rounding.
+		b = bins - 1
+	}
+	return b
+}
+
+// fitSeason returns the seasonal value of each phase, averaging 0, and the
+// fraction of the variance of values about their trend which the season
+// explains.  The trend is a centered moving average over one period, which is
+// biased by the season where the period is truncated at the ends, so it is
+// recomputed from the deseasonalized values a few times.
+func fitSeason(values, times []float64, period float64, bins int) (phases []float64, strength float64) {
+	phaseOf := make([]int, len(times))
+	for i, t := range times {
+		phaseOf[i] = phase(t, period, bins)
+	}
+	phases = make([]float64, bins)
+	detrended := make([]float64, len(values))
+	for iteration := 0; iteration < 3; iteration++ {
+		var sum float64
+		lo, hi := 0, 0
+		for i, t := range times {
+			for (hi < len(times)) && (times[hi] < t+period/2) {
+				sum += values[hi] - phases[phaseOf[hi]]
+				hi++
+			}
+			for times[lo] < t-period/2 {
+				sum -= values[lo] - phases[phaseOf[lo]]
+				lo++
+			}
+			detrended[i] = values[i] - sum/float64(hi-lo)
+		}
+		phases = phaseMedians(detrended, phaseOf, bins)
+	}
+
+	var total, residual float64
+	for i, d := range detrended {
+		rest := d - phases[phaseOf[i]]
+		total += d * d
+		residual += rest * rest
+	}
+	if total == 0 {
+		return phases, 0
+	}
+	return phases, 1 - residual/total
+}
+
+// phaseMedians returns the median of the values in each phase, less the mean
+// of those medians.  Phases without values are 0.
+func phaseMedians(values []float64, phaseOf []int, bins int) []float64 {
+	binValues := make([][]float64, bins)
+	for i, v := range values {
+		binValues[phaseOf[i]] = append(binValues[phaseOf[i]], v)
+	}
+	phases := make([]float64, bins)
+	var phaseSum float64
+	var numPhases int
+	for b, v := range binValues {
+		if len(v) == 0 {
+			continue
+		}
+		sort.Float64s(v)
+		phases[b] = v[len(v)/2]
+		if len(v)%2 == 0 {
+			phases[b] = (v[len(v)/2-1] + phases[b]) / 2
+		}
+		phaseSum += phases[b]
+		numPhases++
+	}
+	for b, v := range binValues {
+		if len(v) > 0 {
+			phases[b] -= phaseSum / float64(numPhases)
+		}
+	}
+	return phases
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regress
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"math"
+	"testing"
+)
+
+const hourMillis = 3600 * 1000
+
+// weeklyColumns returns four weeks of values every 3 hours starting on a
+// Monday, with 10 added on weekends and a step of 3 from the start of week
+// three, and their times.
+func weeklyColumns() (c, x *column.Floats) {
+	const start = 4 * DayMillis // The epoch was a Thursday.
+	n := 4 * 7 * 8
+	c, x = column.NewFloats(n), column.NewFloats(n)
+	for i := 0; i < n; i++ {
+		t := float64(start + i*3*hourMillis)
+		x.Set(i, t)
+		v := 100 + 0.2*math.Sin(float64(i)*1.7)
+		if day := (i / 8) % 7; day >= 5 {
+			v += 10
+		}
+		if i >= n/2 {
+			v += 3
+		}
+		c.Set(i, v)
+	}
+	return c, x
+}
+
+func TestDeseasonalize(t *testing.T) {
+	c, x := weeklyColumns()
+	pos, neg := 2.0, -2.0
+	r := RegressionParams{Window: 1, Pos: &pos, Neg: &neg}
+	if got := len(FindRegressions(c, r)); got < 4 {
+		t.Errorf("Expected weekends to be regressions without seasonality, got %d", got)
+	}
+
+	for _, season := range []int64{SeasonAuto, WeekMillis} {
+		r.SeasonMillis = season
+		adjusted, seasonal := Deseasonalize(c, x, r)
+		if seasonal == nil {
+			t.Fatalf("season %d: No season found.", season)
+		}
+		if weekend, _ := seasonal.Get(5 * 8); math.Abs(weekend-seasonal.Values[0]-10) > 0.5 {
+			t.Errorf("season %d: got weekend seasonal %v, weekday %v", season, weekend, seasonal.Values[0])
+		}
+		regressions := FindRegressions(adjusted, r)
+		if (len(regressions) != 1) || (regressions[0].EndRow != c.Len()/2) {
+			t.Errorf("season %d: got %+v want one regression at row %d", season, regressions, c.Len()/2)
+		}
+	}
+
+	r.SeasonMillis = SeasonAuto
+	c.Resize(8 * 10) // Under two weeks, and no daily season.
+	if _, seasonal := Deseasonalize(c, x, r); seasonal != nil {
+		t.Error("Expected no season in ten days.")
+	}
+}
+
+func TestSeasonBinsBound(t *testing.T) {
+	for _, bins := range []int{0, MaxSeasonBins + 1, math.MaxInt32} {
+		if err := (&Override{SeasonBins: &bins}).Validate(); err == nil {
+			t.Errorf("Expected an error for %d season bins.", bins)
+		}
+	}
+	bins := MaxSeasonBins
+	if err := (&Override{SeasonBins: &bins}).Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// Callers which skip validation get at most MaxSeasonBins phases.
+	c, x := weeklyColumns()
+	r := RegressionParams{SeasonMillis: WeekMillis, SeasonBins: math.MaxInt32}
+	if _, seasonal := Deseasonalize(c, x, r); seasonal == nil {
+		t.Error("No season found.")
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regress
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"math"
+)
+
+// Regression is a run of rows whose detector values cross a threshold, or are
+// nonzero when no threshold is set.
+type Regression struct {
+	StartRow  int     // Last non-null row before the run, or its first row.
+	EndRow    int     // Last row of the run.
+	Magnitude float64 // Detector value of greatest size in the run.
+}
+
+// FindRegressions returns the regressions in c, which must be in ascending time
+// order.  A run ends at a null or uncrossed value or a change in direction.
+func FindRegressions(c *column.Floats, r RegressionParams) (regressions []Regression) {
+	values := r.detector().Detect(c, r)
+	noThreshold := (r.Pos == nil) && (r.Neg == nil)
+	inRun := false
+	prevRow := -1 // Last non-null row of c.
+	for i := 0; i < values.Len(); i++ {
+		v, ok := values.Get(i)
+		if !ok || !(r.crosses(v) || (noThreshold && (v != 0))) {
+			inRun = false
+		} else if last := len(regressions) - 1; inRun && ((v > 0) == (regressions[last].Magnitude > 0)) {
+			regressions[last].EndRow = i
+			if math.Abs(v) > math.Abs(regressions[last].Magnitude) {
+				regressions[last].Magnitude = v
+			}
+		} else {
+			start := prevRow
+			if start < 0 {
+				start = i
+			}
+			regressions = append(regressions, Regression{StartRow: start, EndRow: i, Magnitude: v})
+			inRun = true
+		}
+		if !c.IsNull(i) {
+			prevRow = i
+		}
+	}
+	return regressions
+}
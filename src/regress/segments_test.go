@@ -0,0 +1,47 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regress
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindRegressions(t *testing.T) {
+	input := []interface{}{1, 1, 5, 5, nil, 5, 1, 1, 1}
+	pos, neg := 2.0, -2.0
+	r := RegressionParams{Window: 1, Pos: &pos, Neg: &neg}
+	got := FindRegressions(makeTestColumn(input), r)
+	want := []Regression{
+		{StartRow: 1, EndRow: 2, Magnitude: 4},
+		{StartRow: 5, EndRow: 6, Magnitude: -4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v want: %+v", got, want)
+	}
+
+	// A change in direction ends a run.
+	input = []interface{}{1, 1, 5, 1, 1}
+	got = FindRegressions(makeTestColumn(input), r)
+	want = []Regression{
+		{StartRow: 1, EndRow: 2, Magnitude: 4},
+		{StartRow: 2, EndRow: 3, Magnitude: -4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("spike got: %+v want: %+v", got, want)
+	}
+}
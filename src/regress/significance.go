@@ -0,0 +1,172 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regress
+
+import (
+	"math"
+	"sort"
+)
+
+// Names of the significance tests.
+const (
+	TestMannWhitney = "mannwhitney"
+	TestWelch       = "welch"
+)
+
+// Tests holds two-sided tests of whether two samples differ, each returning a
+// p-value.
+var Tests = map[string]func(a, b []float64) float64{
+	TestMannWhitney: MannWhitneyU,
+	TestWelch:       WelchT,
+}
+
+// MannWhitneyU returns the p-value of the Mann-Whitney U test that values of a
+// and b are equally likely to be greater, using the normal approximation with
+// corrections for ties and continuity.
+func MannWhitneyU(a, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if (n1 == 0) || (n2 == 0) {
+		return 1
+	}
+	samples := make(rankSamples, 0, len(a)+len(b))
+	for _, v := range a {
+		samples = append(samples, sample{v, true})
+	}
+	for _, v := range b {
+		samples = append(samples, sample{v, false})
+	}
+	sort.Sort(samples)
+
+	var rankSumA, tieSum float64
+	for i := 0; i < len(samples); {
+		j := i + 1
+		for (j < len(samples)) && (samples[j].v == samples[i].v) {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // Mean of ranks i+1 to j.
+		for k := i; k < j; k++ {
+			if samples[k].fromA {
+				rankSumA += rank
+			}
+		}
+		t := float64(j - i)
+		tieSum += t*t*t - t
+		i = j
+	}
+
+	n := n1 + n2
+	u := rankSumA - n1*(n1+1)/2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieSum/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := math.Max(0, math.Abs(u-n1*n2/2)-0.5) / sigma
+	return math.Erfc(z / math.Sqrt2)
+}
+
+type sample struct {
+	v     float64
+	fromA bool
+}
+
+type rankSamples []sample
+
+func (s rankSamples) Len() int           { return len(s) }
+func (s rankSamples) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s rankSamples) Less(i, j int) bool { return s[i].v < s[j].v }
+
+// WelchT returns the p-value of Welch's t-test that a and b have equal means.
+func WelchT(a, b []float64) float64 {
+	if (len(a) < 2) || (len(b) < 2) {
+		return 1
+	}
+	m1, v1 := meanVariance(a)
+	m2, v2 := meanVariance(b)
+	s1, s2 := v1/float64(len(a)), v2/float64(len(b))
+	if s1+s2 == 0 {
+		if m1 == m2 {
+			return 1
+		}
+		return 0
+	}
+	t := (m1 - m2) / math.Sqrt(s1+s2)
+	df := (s1 + s2) * (s1 + s2) /
+		(s1*s1/float64(len(a)-1) + s2*s2/float64(len(b)-1))
+	return incompleteBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// meanVariance returns the mean and sample variance of values.
+func meanVariance(values []float64) (m, v float64) {
+	m = mean(values)
+	for _, x := range values {
+		v += (x - m) * (x - m)
+	}
+	return m, v / float64(len(values)-1)
+}
+
+// incompleteBeta returns the regularized incomplete beta function I_x(a, b).
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges quickly for x < (a+1)/(a+b+2).
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(a, b, x) / a
+	}
+	return 1 - front*betaFraction(b, a, 1-x)/b
+}
+
+// betaFraction evaluates the continued fraction for the incomplete beta
+// function with the modified Lentz method.
+func betaFraction(a, b, x float64) float64 {
+	const tiny, epsilon = 1e-300, 1e-14
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+		for _, num := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
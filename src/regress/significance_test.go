@@ -0,0 +1,62 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regress
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	a := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	b := []float64{9, 10, 11, 12, 13, 14, 15, 16}
+	// Normal approximation: U=0, mu=32, sigma=sqrt(64*17/12).
+	want := math.Erfc((32 - 0.5) / math.Sqrt(64*17.0/12) / math.Sqrt2)
+	if p := MannWhitneyU(a, b); math.Abs(p-want) > 1e-12 {
+		t.Errorf("separated got: %v want: %v", p, want)
+	}
+	if p := MannWhitneyU(a, a); p != 1 {
+		t.Errorf("identical got: %v want: 1", p)
+	}
+	if p := MannWhitneyU([]float64{3, 3}, []float64{3, 3, 3}); p != 1 {
+		t.Errorf("all ties got: %v want: 1", p)
+	}
+}
+
+func TestWelchT(t *testing.T) {
+	// The first example of Welch's t-test on Wikipedia: t = -2.46, df = 25.0.
+	a := []float64{27.5, 21.0, 19.0, 23.6, 17.0, 17.9, 16.9, 20.1, 21.9, 22.6, 23.1, 19.6, 19.0, 21.7, 21.4}
+	b := []float64{27.1, 22.0, 20.8, 23.4, 23.4, 23.5, 25.8, 22.0, 24.8, 20.2, 21.9, 22.1, 22.9, 20.5, 24.4}
+	if p := WelchT(a, b); math.Abs(p-0.021378) > 1e-6 {
+		t.Errorf("got: %v want: 0.021378", p)
+	}
+	if p := WelchT([]float64{1, 1}, []float64{2, 2}); p != 0 {
+		t.Errorf("constant samples got: %v want: 0", p)
+	}
+}
+
+func TestIncompleteBeta(t *testing.T) {
+	// I_x(1, 1) = x and I_x(a, 1) = x^a.
+	for _, x := range []float64{0.1, 0.5, 0.9} {
+		if got := incompleteBeta(1, 1, x); math.Abs(got-x) > 1e-12 {
+			t.Errorf("I_%v(1, 1) got: %v", x, got)
+		}
+		if got := incompleteBeta(3, 1, x); math.Abs(got-x*x*x) > 1e-12 {
+			t.Errorf("I_%v(3, 1) got: %v", x, got)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package srcparse
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// IsPattern returns true if src contains any of the unescaped wildcards
+// understood by Match.
+func IsPattern(src string) bool {
+	return wildcardIndex(src) >= 0
+}
+
+// wildcardIndex returns the index of the first unescaped wildcard in pattern,
+// or -1.
+func wildcardIndex(pattern string) int {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?':
+			return i
+		}
+	}
+	return -1
+}
+
+// unescape removes the backslash escapes from a pattern.
+func unescape(pattern string) string {
+	var result []byte
+	for i := 0; i < len(pattern); i++ {
+		if (pattern[i] == '\\') && (i+1 < len(pattern)) {
+			i++
+		}
+		result = append(result, pattern[i])
+	}
+	return string(result)
+}
+
+// PatternPrefix returns the directory part of pattern before its first
+// wildcard, unescaped and without a trailing "/".  All sources matching
+// pattern are under this directory.
+func PatternPrefix(pattern string) string {
+	i := wildcardIndex(pattern)
+	if i < 0 {
+		return unescape(pattern)
+	}
+	j := strings.LastIndex(pattern[:i], "/")
+	if j < 0 {
+		return ""
+	}
+	return unescape(pattern[:j])
+}
+
+// Match reports whether src matches pattern, where within pattern:
+//
+// Wildcard  Matches
+// --------  -------
+// *         any characters except "/"
+// **        any characters, including "/"
+// ?         any single character except "/"
+//
+// A backslash escapes the following character.  All other characters match
+// themselves.
+func Match(pattern, src string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			if strings.HasPrefix(pattern, "**") {
+				rest := strings.TrimLeft(pattern, "*")
+				for i := 0; i <= len(src); i++ {
+					if Match(rest, src[i:]) {
+						return true
+					}
+				}
+				return false
+			}
+			rest := pattern[1:]
+			for i := 0; i <= len(src); i++ {
+				if Match(rest, src[i:]) {
+					return true
+				}
+				if (i < len(src)) && (src[i] == '/') {
+					break
+				}
+			}
+			return false
+		case '?':
+			if (len(src) == 0) || (src[0] == '/') {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(src)
+			pattern = pattern[1:]
+			src = src[size:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if (len(src) == 0) || (src[0] != pattern[0]) {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		src = src[1:]
+	}
+	return len(src) == 0
+}
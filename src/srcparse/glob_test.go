@@ -0,0 +1,78 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package srcparse
+
+import (
+	"testing"
+)
+
+type matchCase struct {
+	pattern string
+	src     string
+	want    bool
+}
+
+var matchCases = []matchCase{
+	matchCase{"perf/a/nightly", "perf/a/nightly", true},
+	matchCase{"perf/a/nightly", "perf/a/nightly2", false},
+	matchCase{"perf/*/nightly", "perf/a/nightly", true},
+	matchCase{"perf/*/nightly", "perf/abc/nightly", true},
+	matchCase{"perf/*/nightly", "perf//nightly", true},
+	matchCase{"perf/*/nightly", "perf/a/b/nightly", false},
+	matchCase{"perf/*", "perf/a", true},
+	matchCase{"perf/*", "perf/a/b", false},
+	matchCase{"perf/**", "perf/a/b", true},
+	matchCase{"perf/**", "perf/a", true},
+	matchCase{"perf/**", "other/a", false},
+	matchCase{"**/nightly", "perf/a/nightly", true},
+	matchCase{"**/nightly", "perf/a/weekly", false},
+	matchCase{"perf/**/n*", "perf/a/b/nightly", true},
+	matchCase{"perf/?/nightly", "perf/a/nightly", true},
+	matchCase{"perf/?/nightly", "perf/ab/nightly", false},
+	matchCase{"perf/?", "perf/", false},
+	matchCase{"perf/a?", "perf/a/", false},
+	matchCase{"*", "", true},
+	matchCase{"?", "", false},
+	matchCase{"?", "é", true},
+	matchCase{`perf/a\*b`, "perf/a*b", true},
+	matchCase{`perf/a\*b`, "perf/axb", false},
+	matchCase{`perf/a\?`, "perf/a?", true},
+}
+
+func TestMatch(t *testing.T) {
+	for i, tc := range matchCases {
+		if got := Match(tc.pattern, tc.src); got != tc.want {
+			t.Errorf("TC:%d Match(%q, %q) got: %v want: %v", i, tc.pattern, tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestPatternPrefix(t *testing.T) {
+	cases := map[string]string{
+		"perf/*/nightly": "perf",
+		"perf/a/b*":      "perf/a",
+		"**":             "",
+		"perf/a/b":       "perf/a/b",
+		"pe?f/a":         "",
+		`a\*/b/*`:        "a*/b",
+	}
+	for pattern, want := range cases {
+		if got := PatternPrefix(pattern); got != want {
+			t.Errorf("PatternPrefix(%q) got: %q want: %q", pattern, got, want)
+		}
+	}
+}
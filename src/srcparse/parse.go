@@ -17,28 +17,145 @@ limitations under the License.
 package srcparse
 
 import (
+	"fmt"
+	"github.com/google/tsviewdb/src/configfilter"
 	"strings"
+	"unicode/utf8"
 )
 
 type SrcResult struct {
 	Source    string
+	Pattern   bool // Source is a pattern for Match.
 	Metric    string
 	Aggregate string
-	Configs   map[string]string
+	Configs   configfilter.Filter
+	GroupBy   []string // Split columns by the values of these config keys.
 }
 
 func (a SrcResult) Equal(b SrcResult) bool {
-	configEqual := len(a.Configs) == len(b.Configs)
-	for k := range a.Configs {
-		if a.Configs[k] != b.Configs[k] {
-			configEqual = false
-			break
-		}
+	configEqual := a.Configs.Equal(b.Configs) && (len(a.GroupBy) == len(b.GroupBy))
+	for i := range a.GroupBy {
+		configEqual = configEqual && (a.GroupBy[i] == b.GroupBy[i])
 	}
-	return (a.Source == b.Source) && (a.Metric == b.Metric) &&
+	return (a.Source == b.Source) && (a.Pattern == b.Pattern) && (a.Metric == b.Metric) &&
 		(a.Aggregate == b.Aggregate) && configEqual
 }
 
+// SyntaxError describes a malformed source specification.  Pos is the byte
+// offset in Spec where the problem was found.
+type SyntaxError struct {
+	Spec string
+	Pos  int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Syntax error in %q at position %d: %s", e.Spec, e.Pos, e.Msg)
+}
+
+// char is one character of a specification after quotes and escapes have been
+// removed.  Literal characters never have a special meaning.
+type char struct {
+	r       rune
+	literal bool
+	pos     int
+}
+
+type chars []char
+
+func (cs chars) index(r rune) int {
+	for i, c := range cs {
+		if (c.r == r) && !c.literal {
+			return i
+		}
+	}
+	return -1
+}
+
+func (cs chars) lastIndex(r rune) int {
+	for i := len(cs) - 1; i >= 0; i-- {
+		if (cs[i].r == r) && !cs[i].literal {
+			return i
+		}
+	}
+	return -1
+}
+
+// split splits cs at each unquoted r, also returning the position just after
+// each separator.
+func (cs chars) split(r rune) (result []chars, starts []int) {
+	for i := cs.index(r); i >= 0; i = cs.index(r) {
+		result = append(result, cs[:i])
+		starts = append(starts, cs[i].pos+1)
+		cs = cs[i+1:]
+	}
+	return append(result, cs), starts
+}
+
+func (cs chars) String() string {
+	runes := make([]rune, len(cs))
+	for i, c := range cs {
+		runes[i] = c.r
+	}
+	return string(runes)
+}
+
+// isAll returns true for an unquoted "*", which selects everything.
+func (cs chars) isAll() bool {
+	return (len(cs) == 1) && (cs[0].r == '*') && !cs[0].literal
+}
+
+// wildcard returns the index of the first unquoted wildcard, or -1.
+func (cs chars) wildcard() int {
+	for i, c := range cs {
+		if ((c.r == '*') || (c.r == '?')) && !c.literal {
+			return i
+		}
+	}
+	return -1
+}
+
+// patternString returns cs in the form used by Match, escaping literal
+// wildcards and backslashes.
+func (cs chars) patternString() string {
+	var result []rune
+	for _, c := range cs {
+		if c.literal && ((c.r == '*') || (c.r == '?') || (c.r == '\\')) {
+			result = append(result, '\\')
+		}
+		result = append(result, c.r)
+	}
+	return string(result)
+}
+
+// scan removes quotes and escapes from spec.
+func scan(spec string) (result chars, err error) {
+	inQuote := false
+	quotePos := 0
+	for i := 0; i < len(spec); {
+		r, size := utf8.DecodeRuneInString(spec[i:])
+		switch {
+		case r == '\\':
+			if i+size >= len(spec) {
+				return nil, &SyntaxError{spec, i, "Backslash at end of input."}
+			}
+			escaped, escapedSize := utf8.DecodeRuneInString(spec[i+size:])
+			result = append(result, char{escaped, true, i})
+			size += escapedSize
+		case r == '"':
+			inQuote = !inQuote
+			quotePos = i
+		default:
+			result = append(result, char{r, inQuote, i})
+		}
+		i += size
+	}
+	if inQuote {
+		return nil, &SyntaxError{spec, quotePos, "Unterminated quote."}
+	}
+	return result, nil
+}
+
 // Parse takes inputs in these forms:
 //
 // Input                 Source  Metric  Aggregate
@@ -46,39 +163,206 @@ func (a SrcResult) Equal(b SrcResult) bool {
 // src                   src     *        *
 // src:metric            src     metric   *
 // src:*.aggregate       src     *        aggregate
-// src:metric.aggregate  src     mertric   aggregate
+// src:metric.*          src     metric   *
+// src:metric.aggregate  src     metric   aggregate
 //
-// and similar forms with:
-// src:metric.aggregate$key1=value1
-func Parse(fullSrc string) (r SrcResult) {
-	result := strings.Split(fullSrc, "$")
-	processed := result[0]
-	if len(result) > 1 {
-		r.Configs = make(map[string]string)
-		for _, kv := range result[1:] {
-			kvArray := strings.SplitN(kv, "=", 2)
-			k := kvArray[0]
-			var v string
-			if len(kvArray) == 2 {
-				v = kvArray[1]
-			}
-			r.Configs[k] = v
+// and similar forms with config filters appended:
+// src:metric.aggregate$key1=value1$key2>=8|key3?$key4
+//
+// The grammar is:
+//
+//	spec      = source [ ":" metrics ] { "$" config }
+//	metrics   = metric [ "." aggregate ]
+//	config    = term { "|" term }
+//	term      = key op value | key "?"
+//	op        = "=" | "!=" | "=~" | "!~" | ">" | ">=" | "<" | "<="
+//
+// The aggregate follows the last ".", so metric names may contain "." when an
+// aggregate is given; otherwise quote the metric.  A config matches if any of
+// its terms match, and a record must match every config (see configfilter).
+// "key?" matches any value.  A config which is only a key groups by that key
+// instead (see GroupBy).  A value extends to the next "$" or "|" and may
+// contain operator characters.  Characters between double quotes, or following
+// a backslash, have no special meaning: src:"rpc.latency" names metric
+// rpc.latency and a\$b is source a$b.  Within and outside of quotes a
+// backslash escapes the next character.
+//
+// src may be a pattern matching many sources (see Match).  Other fields may
+// not contain unquoted wildcards.
+func Parse(fullSrc string) (r SrcResult, err error) {
+	cs, err := scan(fullSrc)
+	if err != nil {
+		return r, err
+	}
+	syntaxError := func(pos int, msg string) error {
+		return &SyntaxError{fullSrc, pos, msg}
+	}
+
+	parts, starts := cs.split('$')
+	for j, config := range parts[1:] {
+		clause, bareKey, err := parseClause(fullSrc, config, starts[j])
+		if err != nil {
+			return r, err
+		}
+		if bareKey != "" {
+			r.GroupBy = append(r.GroupBy, bareKey)
+			continue
+		}
+		r.Configs = append(r.Configs, clause)
+	}
+
+	src, metrics := parts[0], chars(nil)
+	haveMetrics := false
+	metricsStart := 0
+	if i := src.index(':'); i >= 0 {
+		src, metrics = src[:i], src[i+1:]
+		haveMetrics = true
+		metricsStart = parts[0][i].pos + 1
+	}
+	if len(src) == 0 {
+		return r, syntaxError(0, "Missing source.")
+	}
+	if i := metrics.index(':'); i >= 0 {
+		return r, syntaxError(metrics[i].pos, "Unexpected ':'; quote or escape it.")
+	}
+	r.Pattern = src.wildcard() >= 0
+	if r.Pattern {
+		r.Source = src.patternString()
+	} else {
+		r.Source = src.String()
+	}
+	if !haveMetrics {
+		return r, nil
+	}
+
+	metric, aggregate := metrics, chars(nil)
+	if i := metrics.lastIndex('.'); i >= 0 {
+		metric, aggregate = metrics[:i], metrics[i+1:]
+		if len(aggregate) == 0 {
+			return r, syntaxError(metrics[i].pos+1, "Missing aggregate after '.'.")
+		}
+	}
+	if len(metric) == 0 {
+		return r, syntaxError(metricsStart, "Missing metric.")
+	}
+	for _, field := range []chars{metric, aggregate} {
+		if field.isAll() {
+			continue
+		}
+		if i := field.wildcard(); i >= 0 {
+			return r, syntaxError(field[i].pos, "Wildcards are only allowed in sources.")
+		}
+	}
+	if !metric.isAll() {
+		r.Metric = metric.String()
+	}
+	if !aggregate.isAll() {
+		r.Aggregate = aggregate.String()
+	}
+	return r, nil
+}
+
+// configOps are the config filter operators, longest first.
+var configOps = []struct {
+	text string
+	op   configfilter.Op
+}{
+	{"=~", configfilter.RegexMatch},
+	{"!~", configfilter.RegexNotMatch},
+	{"!=", configfilter.Ne},
+	{">=", configfilter.Ge},
+	{"<=", configfilter.Le},
+	{"=", configfilter.Eq},
+	{">", configfilter.Gt},
+	{"<", configfilter.Lt},
+	{"?", configfilter.Exists},
+}
+
+// hasPrefix returns true if cs starts with the unquoted characters of s.
+func (cs chars) hasPrefix(s string) bool {
+	i := 0
+	for _, r := range s {
+		if (i >= len(cs)) || (cs[i].r != r) || cs[i].literal {
+			return false
 		}
+		i++
 	}
+	return true
+}
+
+// parseClause parses config filter terms separated by "|".  start is the
+// position of config in spec, used when config is empty.  A config which is
+// only a key is returned as bareKey.
+func parseClause(spec string, config chars, start int) (clause configfilter.Clause, bareKey string, err error) {
+	terms, starts := config.split('|')
+	starts = append([]int{start}, starts...)
+	for j, term := range terms {
+		keyEnd := len(term)
+		for i, c := range term {
+			if !c.literal && strings.ContainsRune("=!<>~?", c.r) {
+				keyEnd = i
+				break
+			}
+		}
+		if keyEnd == 0 {
+			return nil, "", &SyntaxError{spec, starts[j], "Missing config key."}
+		}
+		key, rest := term[:keyEnd], term[keyEnd:]
+		if len(rest) == 0 {
+			if len(terms) > 1 {
+				return nil, "", &SyntaxError{spec, key[len(key)-1].pos + 1, "Missing config operator."}
+			}
+			return nil, key.String(), nil
+		}
 
-	result = strings.SplitN(processed, ":", 2)
-	r.Source = result[0]
-	if len(result) != 2 {
-		return
+		var op configfilter.Op
+		var value chars
+		found := false
+		for _, o := range configOps {
+			if rest.hasPrefix(o.text) {
+				op, value, found = o.op, rest[len(o.text):], true
+				break
+			}
+		}
+		if !found {
+			return nil, "", &SyntaxError{spec, rest[0].pos, "Unknown config operator."}
+		}
+		if (op == configfilter.Exists) && (len(value) > 0) {
+			return nil, "", &SyntaxError{spec, value[0].pos, "Unexpected text after '?'."}
+		}
+
+		t, err := configfilter.NewTerm(key.String(), op, value.String())
+		if err != nil {
+			return nil, "", &SyntaxError{spec, key[0].pos, err.Error()}
+		}
+		clause = append(clause, t)
 	}
+	return clause, "", nil
+}
 
-	result = strings.SplitN(result[1], ".", 2)
-	if result[0] != "*" {
-		r.Metric = result[0]
+// ParseConfigClause parses config filter terms, as found after a "$" in a
+// source specification.
+func ParseConfigClause(config string) (configfilter.Clause, error) {
+	cs, err := scan(config)
+	if err != nil {
+		return nil, err
 	}
-	if len(result) == 2 {
-		r.Aggregate = result[1]
+	clause, bareKey, err := parseClause(config, cs, 0)
+	if bareKey != "" {
+		return nil, &SyntaxError{config, len(config), "Missing config operator."}
 	}
+	return clause, err
+}
 
-	return
+// Escape returns s with every character that has a special meaning to Parse
+// escaped with a backslash.
+func Escape(s string) string {
+	var result []rune
+	for _, r := range s {
+		if strings.ContainsRune(`\":.$=*?|!<>~`, r) {
+			result = append(result, '\\')
+		}
+		result = append(result, r)
+	}
+	return string(result)
 }
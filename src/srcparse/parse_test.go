@@ -18,9 +18,18 @@ package srcparse
 
 import (
 	"github.com/davecgh/go-spew/spew"
+	"github.com/google/tsviewdb/src/configfilter"
 	"testing"
 )
 
+func term(k string, op configfilter.Op, v string) configfilter.Term {
+	return configfilter.Term{Key: k, Op: op, Value: v}
+}
+
+func eq(k, v string) configfilter.Clause {
+	return configfilter.Clause{term(k, configfilter.Eq, v)}
+}
+
 type testCase struct {
 	input string
 	want  SrcResult
@@ -36,26 +45,140 @@ var testCases = []testCase{
 	testCase{"src:*.aggregate",
 		SrcResult{Source: "src", Aggregate: "aggregate"}},
 	testCase{"src:metric.aggregate$key1",
-		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", Configs: map[string]string{"key1": ""}}},
+		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", GroupBy: []string{"key1"}}},
 	testCase{"src$key1",
-		SrcResult{Source: "src", Configs: map[string]string{"key1": ""}}},
+		SrcResult{Source: "src", GroupBy: []string{"key1"}}},
 	testCase{"src:metric$key1",
-		SrcResult{Source: "src", Metric: "metric", Configs: map[string]string{"key1": ""}}},
+		SrcResult{Source: "src", Metric: "metric", GroupBy: []string{"key1"}}},
 	testCase{"src:metric.aggregate$key1=value1",
-		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", Configs: map[string]string{"key1": "value1"}}},
+		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", Configs: configfilter.Filter{eq("key1", "value1")}}},
 	testCase{"src:metric.aggregate$key1=value1$key2=value2",
-		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", Configs: map[string]string{"key1": "value1", "key2": "value2"}}},
+		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", Configs: configfilter.Filter{eq("key1", "value1"), eq("key2", "value2")}}},
 	testCase{"src:metric.aggregate$key1$key2=value2",
-		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", Configs: map[string]string{"key1": "", "key2": "value2"}}},
+		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", Configs: configfilter.Filter{eq("key2", "value2")}, GroupBy: []string{"key1"}}},
 	testCase{"src:metric.aggregate$key1$key2",
-		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", Configs: map[string]string{"key1": "", "key2": ""}}},
+		SrcResult{Source: "src", Metric: "metric", Aggregate: "aggregate", GroupBy: []string{"key1", "key2"}}},
+	testCase{"src:rpc.latency.p50",
+		SrcResult{Source: "src", Metric: "rpc.latency", Aggregate: "p50"}},
+	testCase{"src:rpc.latency.*",
+		SrcResult{Source: "src", Metric: "rpc.latency"}},
+	testCase{`src:"rpc.latency"`,
+		SrcResult{Source: "src", Metric: "rpc.latency"}},
+	testCase{`src:rpc\.latency`,
+		SrcResult{Source: "src", Metric: "rpc.latency"}},
+	testCase{`a\:b:metric`,
+		SrcResult{Source: "a:b", Metric: "metric"}},
+	testCase{`"a:b":metric.max`,
+		SrcResult{Source: "a:b", Metric: "metric", Aggregate: "max"}},
+	testCase{`src$key1="a$b=c"`,
+		SrcResult{Source: "src", Configs: configfilter.Filter{eq("key1", "a$b=c")}}},
+	testCase{`src$key1=a=b$key\$2=\$`,
+		SrcResult{Source: "src", Configs: configfilter.Filter{eq("key1", "a=b"), eq("key$2", "$")}}},
+	testCase{`src:"say \"hi\"".max`,
+		SrcResult{Source: "src", Metric: `say "hi"`, Aggregate: "max"}},
+	testCase{"perf/*/nightly:latency.p50",
+		SrcResult{Source: "perf/*/nightly", Pattern: true, Metric: "latency", Aggregate: "p50"}},
+	testCase{`perf/**/a\*b`,
+		SrcResult{Source: `perf/**/a\*b`, Pattern: true}},
+	testCase{`perf/a"*"b`,
+		SrcResult{Source: "perf/a*b"}},
+	testCase{"src$branch!=main$threads>=8",
+		SrcResult{Source: "src", Configs: configfilter.Filter{
+			{term("branch", configfilter.Ne, "main")},
+			{term("threads", configfilter.Ge, "8")}}}},
+	testCase{`src$branch=main|branch=~"^release-(a|b)"|cc!~gcc$opt?`,
+		SrcResult{Source: "src", Configs: configfilter.Filter{
+			{term("branch", configfilter.Eq, "main"),
+				term("branch", configfilter.RegexMatch, "^release-(a|b)"),
+				term("cc", configfilter.RegexNotMatch, "gcc")},
+			{term("opt", configfilter.Exists, "")}}}},
+	testCase{"src$a<1$b<=2$c>3$d=x>y",
+		SrcResult{Source: "src", Configs: configfilter.Filter{
+			{term("a", configfilter.Lt, "1")},
+			{term("b", configfilter.Le, "2")},
+			{term("c", configfilter.Gt, "3")},
+			eq("d", "x>y")}}},
+	testCase{`src$a\>b=c`,
+		SrcResult{Source: "src", Configs: configfilter.Filter{eq("a>b", "c")}}},
 }
 
 func TestAll(t *testing.T) {
 	for i, tc := range testCases {
-		got := Parse(tc.input)
+		got, err := Parse(tc.input)
+		if err != nil {
+			t.Errorf("TC:%d unexpected error: %v", i, err)
+			continue
+		}
 		if !got.Equal(tc.want) {
 			t.Errorf("TC:%d got: %s\nwant: %s\n", i, spew.Sdump(got), spew.Sdump(tc.want))
 		}
 	}
 }
+
+type errorCase struct {
+	input string
+	pos   int
+}
+
+var errorCases = []errorCase{
+	errorCase{"", 0},
+	errorCase{":metric", 0},
+	errorCase{"src:", 4},
+	errorCase{"src:.max", 4},
+	errorCase{"src:metric.", 11},
+	errorCase{"src:a:b", 5},
+	errorCase{"src$", 4},
+	errorCase{"src$k$=v", 6},
+	errorCase{`src:"metric`, 4},
+	errorCase{`src\`, 3},
+	errorCase{"src:lat*.max", 7},
+	errorCase{"src:metric.p?", 12},
+	errorCase{"src$k~v", 5},
+	errorCase{"src$k!v", 5},
+	errorCase{"src$k?v", 6},
+	errorCase{"src$k=v|", 8},
+	errorCase{"src$|k", 4},
+	errorCase{"src$k>=eight", 4},
+	errorCase{"src$k=~(", 4},
+	errorCase{"src$k|j=v", 5},
+}
+
+func TestParseConfigClause(t *testing.T) {
+	got, err := ParseConfigClause("k1=v1|k2>3")
+	want := configfilter.Clause{term("k1", configfilter.Eq, "v1"), term("k2", configfilter.Gt, "3")}
+	if (err != nil) || !(configfilter.Filter{got}).Equal(configfilter.Filter{want}) {
+		t.Errorf("got: %v %s\nwant: %s\n", err, spew.Sdump(got), spew.Sdump(want))
+	}
+	for _, bad := range []string{"=v", "k"} {
+		if _, err := ParseConfigClause(bad); err == nil {
+			t.Errorf("Expected error for: %s", bad)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for i, tc := range errorCases {
+		got, err := Parse(tc.input)
+		if err == nil {
+			t.Errorf("TC:%d expected error, got: %s", i, spew.Sdump(got))
+			continue
+		}
+		if e, ok := err.(*SyntaxError); !ok || (e.Pos != tc.pos) {
+			t.Errorf("TC:%d got error: %v want position: %d", i, err, tc.pos)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, s := range []string{"plain", `a:b.c$d=e*f?g"h\\i`} {
+		got, err := Parse(Escape(s) + ":" + Escape(s) + "$" + Escape(s) + "=" + Escape(s))
+		if err != nil {
+			t.Errorf("Escape(%q): %v", s, err)
+			continue
+		}
+		want := SrcResult{Source: s, Metric: s, Configs: configfilter.Filter{eq(s, s)}}
+		if !got.Equal(want) {
+			t.Errorf("Escape(%q) got: %s\nwant: %s\n", s, spew.Sdump(got), spew.Sdump(want))
+		}
+	}
+}
@@ -0,0 +1,340 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tablecodec converts between db.DataTable and the compact tsviewdb
+// Table protocol buffer returned by range reads with type=proto.
+//
+// Data columns named [src:]metric.aggregate are grouped so that each row holds
+// one Aggregation per src/metric pair.  Regression columns are kept by
+// encoding them as metric "REGRESSION_<metric>".  The X-axis is always time on
+// decode: if a table's X-axis was changed its saved timestamps are encoded and
+// the X column dropped.  Data columns without any values are not preserved.
+//
+// Clients decode a response body with:
+//
+//	dTable, err := tablecodec.Unmarshal(body)
+package tablecodec
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"errors"
+	"fmt"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	pb "github.com/google/tsviewdb/src/proto"
+	"strings"
+)
+
+// dynColumn identifies one src/metric column in a Table.
+type dynColumn struct {
+	src    int
+	metric int
+}
+
+// Marshal encodes dTable, whose data columns come from srcs, into a serialized
+// Table.
+func Marshal(dTable *db.DataTable, srcs []string) ([]byte, error) {
+	t, err := Encode(dTable, srcs)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(t)
+}
+
+// Unmarshal decodes a serialized Table into a DataTable.
+func Unmarshal(data []byte) (*db.DataTable, error) {
+	t := new(pb.Table)
+	if err := proto.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	return Decode(t)
+}
+
+// splitColumnName splits a data column name into its source index, metric and
+// aggregate.  Column names only carry a source prefix when there is more than
+// one source.
+func splitColumnName(name string, srcs []string) (srcIdx int, metric, aggregate string, err error) {
+	var regressPrefix string
+	if strings.HasPrefix(name, common.RegressNamePrefix) {
+		regressPrefix = common.RegressNamePrefix
+		name = name[len(common.RegressNamePrefix):]
+	}
+
+	if len(srcs) > 1 {
+		srcIdx = -1
+		for i, src := range srcs { // Longest matching source wins.
+			if strings.HasPrefix(name, src+":") && ((srcIdx < 0) || (len(src) > len(srcs[srcIdx]))) {
+				srcIdx = i
+			}
+		}
+		if srcIdx < 0 {
+			return 0, "", "", errors.New("Unknown source for column: " + name)
+		}
+		name = name[len(srcs[srcIdx])+1:]
+	}
+
+	metric, aggregate = common.GetMetricComponents(name)
+	if !pb.IsDoubleField(aggregate) {
+		return 0, "", "", errors.New("Column cannot be encoded as an aggregate: " + name)
+	}
+	return srcIdx, regressPrefix + metric, aggregate, nil
+}
+
+// Encode converts dTable, whose data columns come from srcs, into a Table.
+func Encode(dTable *db.DataTable, srcs []string) (*pb.Table, error) {
+	if len(srcs) == 0 {
+		return nil, errors.New("No sources for table.")
+	}
+	t := &pb.Table{SrcNameMap: srcs}
+	numRows := dTable.NumRows()
+	if len(dTable.ColumnNames) == 0 {
+		return t, nil
+	}
+
+	// Timestamps come from the X column unless the X-axis was changed.
+	timestamps := dTable.Timestamps
+	if (timestamps == nil) || (timestamps.Len() != numRows) {
+		if dTable.ColumnNames[0] != common.TimeName {
+			return nil, errors.New("No timestamps for X-axis: " + dTable.ColumnNames[0])
+		}
+		timestamps = dTable.Data[0]
+	}
+
+	// Map data columns to dynamic columns and aggregates.
+	dynColumnIdx := make(map[dynColumn]int)
+	metricIdx := make(map[string]int)
+	colDyn := make([]int, len(dTable.ColumnNames))
+	colAggregate := make([]string, len(dTable.ColumnNames))
+	for i := 1; i < len(dTable.ColumnNames); i++ {
+		srcIdx, metric, aggregate, err := splitColumnName(dTable.ColumnNames[i], srcs)
+		if err != nil {
+			return nil, err
+		}
+		mIdx, ok := metricIdx[metric]
+		if !ok {
+			mIdx = len(t.MetricNameMap)
+			metricIdx[metric] = mIdx
+			t.MetricNameMap = append(t.MetricNameMap, metric)
+		}
+		dc := dynColumn{srcIdx, mIdx}
+		dIdx, ok := dynColumnIdx[dc]
+		if !ok {
+			dIdx = len(dynColumnIdx)
+			dynColumnIdx[dc] = dIdx
+			t.SrcIndices = append(t.SrcIndices, int32(srcIdx))
+			t.MetricIndices = append(t.MetricIndices, int32(mIdx))
+		}
+		colDyn[i] = dIdx
+		colAggregate[i] = aggregate
+	}
+	numDynColumns := len(dynColumnIdx)
+	if len(srcs) == 1 { // Metrics are in metric_name_map order.
+		t.SrcIndices = nil
+		t.MetricIndices = nil
+	}
+
+	haveIds := len(dTable.IdColumn) == numRows
+	haveConfigs := len(dTable.Configs) > 0
+	configPairIdx := make(map[[2]string]int32)
+	configGroupIdx := make(map[string]int32)
+
+	var previousTS int64
+	for rowIdx := 0; rowIdx < numRows; rowIdx++ {
+		ts, ok := timestamps.Get(rowIdx)
+		if !ok {
+			return nil, fmt.Errorf("Missing timestamp in row: %d", rowIdx)
+		}
+		timestamp := int64(ts)
+		t.DeltaTimestamps = append(t.DeltaTimestamps, timestamp-previousTS)
+		previousTS = timestamp
+
+		tRow := &pb.Table_Row{Aggregations: make([]*pb.Aggregation, numDynColumns)}
+		for i := range tRow.Aggregations {
+			tRow.Aggregations[i] = &pb.Aggregation{
+				Type:   pb.DataType_DOUBLE.Enum(),
+				Double: &pb.Aggregation_AggregationDouble{}}
+		}
+		for i := 1; i < len(dTable.Data); i++ {
+			if val := dTable.Data[i].Ptr(rowIdx); val != nil {
+				tRow.Aggregations[colDyn[i]].SetDoubleField(colAggregate[i], val)
+			}
+		}
+
+		if haveIds && (dTable.IdColumn[rowIdx] != "") {
+			tRow.IdMap = []string{dTable.IdColumn[rowIdx]}
+		}
+
+		if haveConfigs {
+			var pairIndices []int32
+			for j, c := range dTable.Configs {
+				val, ok := c.Get(rowIdx)
+				if !ok {
+					continue
+				}
+				pair := [2]string{dTable.ConfigsColumnNames[j], val}
+				pIdx, ok := configPairIdx[pair]
+				if !ok {
+					pIdx = int32(len(t.ConfigPairMap))
+					configPairIdx[pair] = pIdx
+					t.ConfigPairMap = append(t.ConfigPairMap,
+						&pb.Config{Name: proto.String(pair[0]), Value: proto.String(pair[1])})
+				}
+				pairIndices = append(pairIndices, pIdx)
+			}
+			if len(pairIndices) > 0 {
+				groupKey := fmt.Sprint(pairIndices)
+				gIdx, ok := configGroupIdx[groupKey]
+				if !ok {
+					t.ConfigGroupMap = append(t.ConfigGroupMap,
+						&pb.Table_Configs{ConfigPairIndices: pairIndices})
+					gIdx = int32(len(t.ConfigGroupMap)) // 1-based.
+					configGroupIdx[groupKey] = gIdx
+				}
+				tRow.ConfigGroupIndices = make([]int32, numDynColumns)
+				for i := range tRow.ConfigGroupIndices {
+					tRow.ConfigGroupIndices[i] = gIdx
+				}
+			}
+		}
+
+		t.Rows = append(t.Rows, tRow)
+	}
+	return t, nil
+}
+
+// Decode converts a Table into a DataTable with time as the X-axis and the
+// data columns sorted by name.
+func Decode(t *pb.Table) (*db.DataTable, error) {
+	if len(t.Rows) != len(t.DeltaTimestamps) {
+		return nil, errors.New("Table rows and timestamps don't match.")
+	}
+	multiSrc := len(t.SrcNameMap) > 1
+
+	// Name prefix for each dynamic column: [src:]metric.
+	var prefixes []string
+	if len(t.MetricIndices) > 0 {
+		if multiSrc && (len(t.SrcIndices) != len(t.MetricIndices)) {
+			return nil, errors.New("Table source and metric indices don't match.")
+		}
+		for i, mIdx := range t.MetricIndices {
+			if int(mIdx) >= len(t.MetricNameMap) {
+				return nil, errors.New("Bad metric index in table.")
+			}
+			var src string
+			if multiSrc {
+				if int(t.SrcIndices[i]) >= len(t.SrcNameMap) {
+					return nil, errors.New("Bad source index in table.")
+				}
+				src = t.SrcNameMap[t.SrcIndices[i]]
+			}
+			prefixes = append(prefixes, columnPrefix(src, t.MetricNameMap[mIdx]))
+		}
+	} else {
+		for _, metric := range t.MetricNameMap {
+			prefixes = append(prefixes, columnPrefix("", metric))
+		}
+	}
+
+	dTable := new(db.DataTable)
+	x := dTable.AddColumn("!" + common.TimeName) // Force first.
+	columnNameReverseMap := make(map[string]int)
+	configColumnNameReverseMap := make(map[string]int)
+	var haveIds bool
+
+	var timestamp int64
+	for rowIdx, tRow := range t.Rows {
+		timestamp += t.DeltaTimestamps[rowIdx]
+		row := dTable.AppendRow()
+		x.Set(row, float64(timestamp))
+
+		if len(tRow.Aggregations) > len(prefixes) {
+			return nil, fmt.Errorf("Too many aggregations in row: %d", rowIdx)
+		}
+		for i, a := range tRow.Aggregations {
+			if a.Scaled != nil {
+				a.MakeDouble()
+			}
+			if a.Double == nil {
+				continue
+			}
+			fields, values := pb.GetDoubleFieldsAndValues(a)
+			for fieldIdx, field := range fields {
+				columnName := common.JoinMetricComponents(prefixes[i], field)
+				columnNameIndex, ok := columnNameReverseMap[columnName]
+				if !ok {
+					columnNameIndex = len(dTable.ColumnNames)
+					columnNameReverseMap[columnName] = columnNameIndex
+					dTable.AddColumn(columnName)
+				}
+				dTable.Data[columnNameIndex].SetPtr(row, values[fieldIdx])
+			}
+		}
+
+		var id string
+		if len(tRow.IdMap) > 0 {
+			haveIds = true
+			id = tRow.IdMap[0]
+		}
+		dTable.IdColumn = append(dTable.IdColumn, id)
+
+		var gIdx int32
+		for _, idx := range tRow.ConfigGroupIndices {
+			if idx != 0 {
+				gIdx = idx
+				break
+			}
+		}
+		if (gIdx == 0) || (int(gIdx) > len(t.ConfigGroupMap)) {
+			continue
+		}
+		for _, pIdx := range t.ConfigGroupMap[gIdx-1].ConfigPairIndices {
+			if int(pIdx) >= len(t.ConfigPairMap) {
+				return nil, errors.New("Bad config pair index in table.")
+			}
+			pair := t.ConfigPairMap[pIdx]
+			columnName := pair.GetName()
+			columnNameIndex, ok := configColumnNameReverseMap[columnName]
+			if !ok {
+				columnNameIndex = len(dTable.ConfigsColumnNames)
+				configColumnNameReverseMap[columnName] = columnNameIndex
+				dTable.AddConfigColumn(columnName)
+			}
+			dTable.Configs[columnNameIndex].Set(row, pair.GetValue())
+		}
+	}
+
+	if !haveIds {
+		dTable.IdColumn = nil
+	}
+	dTable.SortConfigsColumns()
+	dTable.SortDataColumns()
+	dTable.ColumnNames[0] = common.TimeName
+	return dTable, nil
+}
+
+// columnPrefix returns the [src:]metric part of a column name, undoing the
+// REGRESSION_ encoding of splitColumnName.
+func columnPrefix(src, metric string) string {
+	var regressPrefix string
+	if strings.HasPrefix(metric, common.RegressNamePrefix) {
+		regressPrefix = common.RegressNamePrefix
+		metric = metric[len(common.RegressNamePrefix):]
+	}
+	if src != "" {
+		return regressPrefix + src + ":" + metric
+	}
+	return regressPrefix + metric
+}
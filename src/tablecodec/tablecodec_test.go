@@ -0,0 +1,153 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tablecodec
+
+import (
+	"github.com/davecgh/go-spew/spew"
+	"github.com/google/tsviewdb/src/column"
+	"github.com/google/tsviewdb/src/common"
+	"github.com/google/tsviewdb/src/db"
+	pb "github.com/google/tsviewdb/src/proto"
+	"reflect"
+	"testing"
+)
+
+func f(v float64) *float64 { return &v }
+func s(v string) *string   { return &v }
+
+func floatRow(r ...*float64) *[]*float64 { return &r }
+func stringRow(r ...*string) *[]*string  { return &r }
+
+// Columns and config columns are sorted, as Decode returns them.
+func makeMultiSrcTable() *db.DataTable {
+	dTable := db.NewDataTableFromRows([]string{common.TimeName,
+		common.RegressNamePrefix + "a/b:m1.mean",
+		"a/b:m1.max", "a/b:m1.mean", "a/b:m2.p50", "c:m1.mean"},
+		[]*[]*float64{
+			floatRow(f(1000), nil, f(5), f(3), nil, f(7)),
+			floatRow(f(2000), f(2), f(6), f(4), f(-1.5), nil),
+			floatRow(f(1500), nil, nil, nil, f(0), f(8)),
+		})
+	dTable.IdColumn = []string{"id1", "", "id3"}
+	dTable.SetConfigRows([]string{"k1", "k2"},
+		[]*[]*string{
+			stringRow(s("v1"), s("v2")),
+			stringRow(nil, nil),
+			stringRow(s("v1"), s("v2")),
+		})
+	return dTable
+}
+
+func TestRoundTripMultiSrc(t *testing.T) {
+	want := makeMultiSrcTable()
+	data, err := Marshal(makeMultiSrcTable(), []string{"a/b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %s\nwant: %s\n", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestRoundTripSingleSrc(t *testing.T) {
+	want := db.NewDataTableFromRows([]string{common.TimeName, "m1.count", "m1.p99"},
+		[]*[]*float64{
+			floatRow(f(10), f(100), f(0.5)),
+			floatRow(f(20), f(200), nil),
+		})
+	tbl, err := Encode(want, []string{"src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(tbl.SrcIndices) != 0) || (len(tbl.MetricIndices) != 0) {
+		t.Errorf("Single source table has indices: %v %v", tbl.SrcIndices, tbl.MetricIndices)
+	}
+	got, err := Decode(tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %s\nwant: %s\n", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestRoundTripGrouped(t *testing.T) {
+	want := db.NewDataTableFromRows([]string{common.TimeName,
+		"lat.ency.p50[machine=a.b]", "lat.ency.p50[machine=c]", "lat.ency.p99[machine=c]"},
+		[]*[]*float64{
+			floatRow(f(10), f(1), nil, nil),
+			floatRow(f(20), nil, f(2), f(3)),
+		})
+	got, err := Decode(mustEncode(t, want, []string{"src"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %s\nwant: %s\n", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestChangedXAxisUsesTimestamps(t *testing.T) {
+	dTable := db.NewDataTableFromRows([]string{"m1.max", "m1.max"},
+		[]*[]*float64{
+			floatRow(f(3), f(3)),
+			floatRow(f(9), f(9)),
+		})
+	dTable.Timestamps = column.FloatsFromPtrs([]*float64{f(300), f(100)})
+	got, err := Decode(mustEncode(t, dTable, []string{"src"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := db.NewDataTableFromRows([]string{common.TimeName, "m1.max"},
+		[]*[]*float64{
+			floatRow(f(300), f(3)),
+			floatRow(f(100), f(9)),
+		})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %s\nwant: %s\n", spew.Sdump(got), spew.Sdump(want))
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		columnNames []string
+		srcs        []string
+	}{
+		{[]string{common.TimeName, "m1.bogus"}, []string{"src"}},
+		{[]string{common.TimeName, "x:m1.max"}, []string{"a", "b"}},
+		{[]string{"m1.max"}, []string{"src"}}, // No timestamps for X-axis.
+	}
+	for i, tc := range tests {
+		dTable := db.NewDataTableFromRows(tc.columnNames,
+			[]*[]*float64{floatRow(make([]*float64, len(tc.columnNames))...)})
+		if _, err := Encode(dTable, tc.srcs); err == nil {
+			t.Errorf("TC:%d expected error", i)
+		}
+	}
+}
+
+func mustEncode(t *testing.T, dTable *db.DataTable, srcs []string) *pb.Table {
+	tbl, err := Encode(dTable, srcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tbl
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package transform has per-column transforms such as smoothing,
+// normalization and differences, which may be chained in a Pipeline.
+//
+// Transforms see only the non-null values of a column, in row order, and leave
+// null rows null.  Results which are not finite are null.
+package transform
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"math"
+)
+
+// Func returns a transformed copy of column c, whose rows have X-axis values x.
+type Func func(c, x *column.Floats) *column.Floats
+
+// Pipeline is a series of transforms applied in order.
+type Pipeline []Func
+
+func (p Pipeline) Apply(c, x *column.Floats) *column.Floats {
+	for _, f := range p {
+		c = f(c, x)
+	}
+	return c
+}
+
+// FirstRow selects the first non-null value as the baseline for Normalize.
+const FirstRow = -1
+
+// mapValues returns a column with f applied to each non-null value of c along
+// with its row.
+func mapValues(c *column.Floats, f func(row int, v float64) float64) *column.Floats {
+	result := column.NewFloats(c.Len())
+	for i := 0; i < c.Len(); i++ {
+		if v, ok := c.Get(i); ok {
+			setFinite(result, i, f(i, v))
+		}
+	}
+	return result
+}
+
+func setFinite(c *column.Floats, i int, v float64) {
+	if !math.IsNaN(v) && !math.IsInf(v, 0) {
+		c.Set(i, v)
+	}
+}
+
+// MovingAverage averages each value with up to window-1 values before it.
+func MovingAverage(window int) Func {
+	return func(c, x *column.Floats) *column.Floats {
+		ring := make([]float64, window)
+		var n int
+		var sum float64
+		return mapValues(c, func(row int, v float64) float64 {
+			sum += v - ring[n%window]
+			ring[n%window] = v
+			n++
+			if n < window {
+				return sum / float64(n)
+			}
+			return sum / float64(window)
+		})
+	}
+}
+
+// ExponentialSmoothing smooths with the weight 2/(window+1) for each new value,
+// as for an exponential moving average over window values.
+func ExponentialSmoothing(window int) Func {
+	alpha := 2 / (float64(window) + 1)
+	return func(c, x *column.Floats) *column.Floats {
+		first := true
+		var s float64
+		return mapValues(c, func(row int, v float64) float64 {
+			if first {
+				s, first = v, false
+			} else {
+				s += alpha * (v - s)
+			}
+			return s
+		})
+	}
+}
+
+// Normalize divides each value by the value in baseRow, or the first non-null
+// value for FirstRow.  With percent it instead returns the percent change from
+// the baseline.  If the baseline is null or 0 all values are null.
+func Normalize(baseRow int, percent bool) Func {
+	return func(c, x *column.Floats) *column.Floats {
+		var base float64
+		ok := false
+		if baseRow == FirstRow {
+			for i := 0; (i < c.Len()) && !ok; i++ {
+				base, ok = c.Get(i)
+			}
+		} else if baseRow < c.Len() {
+			base, ok = c.Get(baseRow)
+		}
+		if !ok || (base == 0) {
+			return column.NewFloats(c.Len())
+		}
+		return mapValues(c, func(row int, v float64) float64 {
+			if percent {
+				return 100 * (v - base) / math.Abs(base)
+			}
+			return v / base
+		})
+	}
+}
+
+// ZScore returns the number of standard deviations each value is from the mean
+// of the column.
+func ZScore() Func {
+	return func(c, x *column.Floats) *column.Floats {
+		var n, sum float64
+		for i := 0; i < c.Len(); i++ {
+			if v, ok := c.Get(i); ok {
+				n++
+				sum += v
+			}
+		}
+		mean := sum / n
+		var sumSq float64
+		for i := 0; i < c.Len(); i++ {
+			if v, ok := c.Get(i); ok {
+				sumSq += (v - mean) * (v - mean)
+			}
+		}
+		stdDev := math.Sqrt(sumSq / n)
+		return mapValues(c, func(row int, v float64) float64 {
+			return (v - mean) / stdDev
+		})
+	}
+}
+
+// Diff returns the difference of each value from the one before it.  The first
+// value has no difference and is null.
+func Diff() Func {
+	return Rate(0)
+}
+
+// Rate returns the difference of each value from the one before it per
+// unitMillis of the X-axis, or the plain difference for unitMillis 0.  Values
+// whose X is null are skipped.
+func Rate(unitMillis float64) Func {
+	return func(c, x *column.Floats) *column.Floats {
+		result := column.NewFloats(c.Len())
+		prev := -1
+		for i := 0; i < c.Len(); i++ {
+			v, ok := c.Get(i)
+			if !ok {
+				continue
+			}
+			if unitMillis == 0 {
+				if prev >= 0 {
+					setFinite(result, i, v-c.Values[prev])
+				}
+				prev = i
+				continue
+			}
+			xi, ok := x.Get(i)
+			if !ok {
+				continue
+			}
+			if prev >= 0 {
+				setFinite(result, i, (v-c.Values[prev])*unitMillis/(xi-x.Values[prev]))
+			}
+			prev = i
+		}
+		return result
+	}
+}
+
+// CumulativeSum returns the sum of each value and all values before it.
+func CumulativeSum() Func {
+	return func(c, x *column.Floats) *column.Floats {
+		var sum float64
+		return mapValues(c, func(row int, v float64) float64 {
+			sum += v
+			return sum
+		})
+	}
+}
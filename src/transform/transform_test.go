@@ -0,0 +1,68 @@
+/*
+Copyright 2013 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"github.com/google/tsviewdb/src/column"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func f(v float64) *float64 { return &v }
+
+var sqrt5 = math.Sqrt(5)
+
+var (
+	testX      = column.FloatsFromPtrs([]*float64{f(0), f(1000), f(2000), f(4000), f(5000)})
+	testColumn = column.FloatsFromPtrs([]*float64{f(2), f(4), nil, f(8), f(6)})
+)
+
+type testCase struct {
+	name string
+	p    Pipeline
+	want []*float64
+}
+
+var testCases = []testCase{
+	{"movingAverage", Pipeline{MovingAverage(2)}, []*float64{f(2), f(3), nil, f(6), f(7)}},
+	{"ema", Pipeline{ExponentialSmoothing(3)}, []*float64{f(2), f(3), nil, f(5.5), f(5.75)}},
+	{"normFirst", Pipeline{Normalize(FirstRow, false)}, []*float64{f(1), f(2), nil, f(4), f(3)}},
+	{"pctChangeRow", Pipeline{Normalize(1, true)}, []*float64{f(-50), f(0), nil, f(100), f(50)}},
+	{"nullBaseline", Pipeline{Normalize(2, false)}, []*float64{nil, nil, nil, nil, nil}},
+	{"zscore", Pipeline{ZScore()}, []*float64{f(-3 / sqrt5), f(-1 / sqrt5), nil, f(3 / sqrt5), f(1 / sqrt5)}},
+	{"diff", Pipeline{Diff()}, []*float64{nil, f(2), nil, f(4), f(-2)}},
+	{"rate", Pipeline{Rate(1000)}, []*float64{nil, f(2), nil, f(4.0 / 3), f(-2)}},
+	{"cumsum", Pipeline{CumulativeSum()}, []*float64{f(2), f(6), nil, f(14), f(20)}},
+	{"chain", Pipeline{Diff(), CumulativeSum()}, []*float64{nil, f(2), nil, f(6), f(4)}},
+}
+
+func TestTransforms(t *testing.T) {
+	for _, c := range testCases {
+		got := c.p.Apply(testColumn, testX)
+		if want := column.FloatsFromPtrs(c.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s got: %v want: %v", c.name, got.Values, want.Values)
+		}
+	}
+}
+
+func TestConstantZScore(t *testing.T) {
+	c := column.FloatsFromPtrs([]*float64{f(3), f(3)})
+	if got := ZScore()(c, testX).Ptrs(); !reflect.DeepEqual(got, []*float64{nil, nil}) {
+		t.Errorf("got: %v want all null", got)
+	}
+}